@@ -0,0 +1,204 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WithAnonymousFile makes a disk-backed buffer use an anonymous temp file,
+// which never appears in the temp directory, and whose disk space the
+// kernel reclaims as soon as it's closed, even if the process dies without
+// removing it: on linux, it's created with O_TMPFILE; elsewhere (or if the
+// filesystem doesn't support O_TMPFILE), it's unlinked right after it's
+// created, where the OS allows it (but not on windows, where it's a named
+// temp file, as usual). Its name (see Buffer.File) is not the path of a
+// file, unless it's a named temp file.
+//
+// The file is an OS file: it can still be reopened for reading (e.g. by
+// Reader), and handed to the kernel for copies. It replaces the FS of the
+// buffer (see WithFS).
+func WithAnonymousFile() Option {
+	return func(b *Buffer) {
+		b.fs = anonFS
+	}
+}
+
+// anonFS is the FS of the anonymous temp files.
+var anonFS = newAnonymousFS("anonymous", createAnonymousFile)
+
+// anonymousFS is an FS of anonymous files, created by create, which are
+// reopened by their name while they're open; kind is in their name.
+type anonymousFS struct {
+	kind   string
+	create func(dir, pattern, name string) (f *os.File, named bool, err error)
+
+	mu    sync.Mutex
+	files map[string]anonymousFile
+	next  int64
+}
+
+func newAnonymousFS(kind string, create func(dir, pattern, name string) (*os.File, bool, error)) *anonymousFS {
+	return &anonymousFS{
+		kind:   kind,
+		create: create,
+		files:  make(map[string]anonymousFile),
+	}
+}
+
+// anonymousFile is an open anonymous file; named is true
+// if it's a named temp file, which couldn't be unlinked.
+type anonymousFile struct {
+	file  *os.File
+	named bool
+}
+
+func (fsys *anonymousFS) CreateTemp(dir, pattern string) (File, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	for {
+		fsys.mu.Lock()
+		fsys.next++
+		name := filepath.Join(dir, fmt.Sprintf("(%s %d)", fsys.kind, fsys.next))
+		fsys.mu.Unlock()
+		f, named, err := fsys.create(dir, pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		fsys.mu.Lock()
+		_, taken := fsys.files[f.Name()]
+		if !taken {
+			fsys.files[f.Name()] = anonymousFile{f, named}
+		}
+		fsys.mu.Unlock()
+		if !taken {
+			return f, nil
+		}
+		// The path of an unlinked file was reused by the new one,
+		// which can't be told apart from it.
+		f.Close()
+	}
+}
+
+// createUnlinkedFile creates a temp file in dir, and unlinks it, if the OS
+// allows it (then named is false, and the name of the file is the path it
+// had); name is not used.
+func createUnlinkedFile(dir, pattern, name string) (f *os.File, named bool, err error) {
+	f, err = ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		return f, true, nil
+	}
+	return f, false, nil
+}
+
+func (fsys *anonymousFS) Open(name string) (File, error) {
+	fsys.mu.Lock()
+	af, ok := fsys.files[name]
+	fsys.mu.Unlock()
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &fileView{file: af.file}, nil
+}
+
+func (fsys *anonymousFS) Remove(name string) error {
+	fsys.mu.Lock()
+	af, ok := fsys.files[name]
+	delete(fsys.files, name)
+	fsys.mu.Unlock()
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if af.named {
+		return os.Remove(name)
+	}
+	return nil
+}
+
+func (fsys *anonymousFS) SyncDir(dir string) error {
+	// The anonymous files have no directory entry.
+	return nil
+}
+
+var errReadOnlyView = errors.New("read-only")
+
+// fileView is a read-only handle of an open file, with its own offset;
+// closing it doesn't close the file.
+type fileView struct {
+	file *os.File
+	off  int64
+}
+
+func (v *fileView) Name() string {
+	return v.file.Name()
+}
+
+func (v *fileView) Read(p []byte) (int, error) {
+	n, err := v.file.ReadAt(p, v.off)
+	v.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (v *fileView) ReadAt(p []byte, off int64) (int, error) {
+	return v.file.ReadAt(p, off)
+}
+
+func (v *fileView) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += v.off
+	case io.SeekEnd:
+		info, err := v.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset += info.Size()
+	default:
+		return 0, &os.PathError{Op: "seek", Path: v.Name(), Err: os.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: v.Name(), Err: os.ErrInvalid}
+	}
+	v.off = offset
+	return offset, nil
+}
+
+func (v *fileView) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: v.Name(), Err: errReadOnlyView}
+}
+
+func (v *fileView) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: v.Name(), Err: errReadOnlyView}
+}
+
+func (v *fileView) WriteString(s string) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: v.Name(), Err: errReadOnlyView}
+}
+
+func (v *fileView) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: v.Name(), Err: errReadOnlyView}
+}
+
+func (v *fileView) Stat() (os.FileInfo, error) {
+	return v.file.Stat()
+}
+
+func (v *fileView) Sync() error {
+	return nil
+}
+
+func (v *fileView) Close() error {
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package ramdiskbuffer
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// createAnonymousFile creates an anonymous file named name in dir, with
+// O_TMPFILE; if the kernel or the filesystem doesn't support it, it falls
+// back to createUnlinkedFile.
+func createAnonymousFile(dir, pattern, name string) (f *os.File, named bool, err error) {
+	fd, err := unix.Open(dir, unix.O_RDWR|unix.O_TMPFILE|unix.O_CLOEXEC, 0600)
+	if err != nil {
+		return createUnlinkedFile(dir, pattern, name)
+	}
+	return os.NewFile(uintptr(fd), name), false, nil
+}
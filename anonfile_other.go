@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package ramdiskbuffer
+
+import (
+	"os"
+)
+
+// createAnonymousFile creates an anonymous file named name in dir
+// (see createUnlinkedFile): O_TMPFILE is supported only on linux.
+func createAnonymousFile(dir, pattern, name string) (f *os.File, named bool, err error) {
+	return createUnlinkedFile(dir, pattern, name)
+}
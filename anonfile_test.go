@@ -0,0 +1,50 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWithAnonymousFile(t *testing.T) {
+	dir := t.TempDir()
+	b := New(true, WithTempDir(dir), WithAnonymousFile())
+	want := strings.Repeat("anonymous ", 1000)
+	b.WriteString(want)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 && runtime.GOOS != "windows" {
+		t.Errorf("got %d entries in the temp dir, want none", len(entries))
+	}
+	if _, ok := b.File(); !ok {
+		t.Error("the anonymous file is not an OS file")
+	}
+
+	// The file can be reopened, and copied.
+	got, err := b.String()
+	if err != nil || got != want {
+		t.Errorf("String: got %d bytes, %v, want %d bytes", len(got), err, len(want))
+	}
+	c, err := b.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.PrepareForReading()
+	if got, err := io.ReadAll(c); err != nil || string(got) != want {
+		t.Errorf("clone: got %d bytes, %v, want %d bytes", len(got), err, len(want))
+	}
+	if err := c.Remove(); err != nil {
+		t.Errorf("Remove the clone: %v", err)
+	}
+	name := b.file.Name()
+	if err := b.Remove(); err != nil {
+		t.Errorf("Remove: %v", err)
+	}
+	if _, err := anonFS.Open(name); err == nil {
+		t.Error("the removed file can still be opened")
+	}
+}
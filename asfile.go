@@ -0,0 +1,104 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// AsFile returns a read-only file over the contents of the buffer, named
+// name (its base name is the name of Stat) and last modified at modTime,
+// e.g. to serve them with http.ServeContent or http.FileServer, or from an
+// fs.FS. Besides fs.File, it implements io.Seeker and io.ReaderAt, and the
+// Readdir method of http.File, which returns nothing, like ReadDir.
+//
+// The file reads the contents through ReadAt, from its own offset, without
+// copying them nor affecting the read offset of the buffer: sink and
+// transformed buffers (see WithWritePipeline) can't be read, and several
+// files can be read at once, but not while the buffer is written. The file
+// has the size of the contents when AsFile was called. Closing it doesn't
+// remove the buffer.
+func (b *Buffer) AsFile(name string, modTime time.Time) fs.File {
+	return &bufferFile{
+		SectionReader: io.NewSectionReader(b, 0, b.Size()),
+		info: bufferFileInfo{
+			name:    path.Base(name),
+			size:    b.Size(),
+			modTime: modTime,
+		},
+	}
+}
+
+// bufferFile is the file returned by AsFile.
+type bufferFile struct {
+	*io.SectionReader
+	info   bufferFileInfo
+	closed bool
+}
+
+func (f *bufferFile) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, fs.ErrClosed
+	}
+	return f.info, nil
+}
+
+func (f *bufferFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.SectionReader.Read(p)
+}
+
+func (f *bufferFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.SectionReader.ReadAt(p, off)
+}
+
+func (f *bufferFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	return f.SectionReader.Seek(offset, whence)
+}
+
+// ReadDir returns nothing: the file is not a directory.
+func (f *bufferFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n > 0 {
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+// Readdir is ReadDir for http.File.
+func (f *bufferFile) Readdir(n int) ([]fs.FileInfo, error) {
+	if n > 0 {
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+func (f *bufferFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+// bufferFileInfo is the fs.FileInfo of the files returned by AsFile.
+type bufferFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi bufferFileInfo) Name() string       { return fi.name }
+func (fi bufferFileInfo) Size() int64        { return fi.size }
+func (fi bufferFileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi bufferFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi bufferFileInfo) IsDir() bool        { return false }
+func (fi bufferFileInfo) Sys() interface{}   { return nil }
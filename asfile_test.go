@@ -0,0 +1,48 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsFile(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		b.WriteString(strings.Repeat("served contents ", 100))
+		f := b.AsFile("assets/page.txt", modTime)
+		if _, ok := f.(http.File); !ok {
+			t.Fatalf("toDisk %v: got %T, want an http.File", toDisk, f)
+		}
+
+		info, err := f.Stat()
+		if err != nil || info.Name() != "page.txt" || info.Size() != b.Size() || !info.ModTime().Equal(modTime) || info.IsDir() {
+			t.Errorf("toDisk %v: got %+v, %v, want page.txt of %d bytes", toDisk, info, err, b.Size())
+		}
+
+		req := httptest.NewRequest("GET", "/page.txt", nil)
+		req.Header.Set("Range", "bytes=7-14")
+		rec := httptest.NewRecorder()
+		http.ServeContent(rec, req, info.Name(), info.ModTime(), f.(io.ReadSeeker))
+		if rec.Code != http.StatusPartialContent || rec.Body.String() != "contents" {
+			t.Errorf("toDisk %v: got %d %q, want 206 %q", toDisk, rec.Code, rec.Body.String(), "contents")
+		}
+
+		if entries, err := f.(fs.ReadDirFile).ReadDir(-1); len(entries) != 0 || err != nil {
+			t.Errorf("toDisk %v: ReadDir: got (%v, %v), want nothing", toDisk, entries, err)
+		}
+		f.Close()
+		if _, err := f.Read(make([]byte, 1)); err != fs.ErrClosed {
+			t.Errorf("toDisk %v: got %v after Close, want fs.ErrClosed", toDisk, err)
+		}
+		if b.State() != StateWriting {
+			t.Errorf("toDisk %v: got %v, want the buffer left as is", toDisk, b.State())
+		}
+		b.Remove()
+	}
+}
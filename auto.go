@@ -0,0 +1,52 @@
+package ramdiskbuffer
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMemoryHighWater is the default heap size
+// above which NewAuto returns disk-backed buffers.
+const DefaultMemoryHighWater = 1 << 30
+
+// memStatsInterval is how long a sample of the heap size is reused
+// by NewAuto: runtime.ReadMemStats is too expensive to call
+// for every buffer.
+const memStatsInterval = time.Second
+
+var (
+	memoryHighWater uint64 = DefaultMemoryHighWater
+
+	heapMu     sync.Mutex
+	heapAlloc  uint64
+	heapSample time.Time
+)
+
+// SetMemoryHighWater sets the heap size (in bytes) above which
+// NewAuto returns disk-backed buffers.
+func SetMemoryHighWater(bytes uint64) {
+	atomic.StoreUint64(&memoryHighWater, bytes)
+}
+
+// NewAuto returns a new buffer whose backing depends on the current
+// memory pressure of the process: it's disk-backed if the heap is larger
+// than the high-water mark (see SetMemoryHighWater), RAM-backed otherwise.
+// The heap size is sampled at most once per second.
+func NewAuto(opts ...Option) *Buffer {
+	return New(currentHeapAlloc() > atomic.LoadUint64(&memoryHighWater), opts...)
+}
+
+// currentHeapAlloc returns the size of the heap, as sampled recently.
+func currentHeapAlloc() uint64 {
+	heapMu.Lock()
+	defer heapMu.Unlock()
+	if time.Since(heapSample) >= memStatsInterval {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		heapAlloc = stats.HeapAlloc
+		heapSample = time.Now()
+	}
+	return heapAlloc
+}
@@ -0,0 +1,62 @@
+package ramdiskbuffer
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewAuto(t *testing.T) {
+	saved := atomic.LoadUint64(&memoryHighWater)
+	defer SetMemoryHighWater(saved)
+	// A recent sample of the heap size.
+	heapMu.Lock()
+	heapAlloc, heapSample = 1000, time.Now()
+	heapMu.Unlock()
+	defer func() {
+		heapMu.Lock()
+		heapSample = time.Time{}
+		heapMu.Unlock()
+	}()
+
+	for _, tc := range []struct {
+		highWater uint64
+		toDisk    bool
+	}{
+		{0, true},
+		{999, true},
+		{1000, false},
+		{math.MaxUint64, false},
+	} {
+		SetMemoryHighWater(tc.highWater)
+		b := NewAuto(WithLazyFile())
+		if b.toDisk != tc.toDisk {
+			t.Errorf("high water %d, heap 1000: got toDisk %v, want %v", tc.highWater, b.toDisk, tc.toDisk)
+		}
+		b.WriteString("abc")
+		if got, err := b.String(); err != nil || got != "abc" {
+			t.Errorf("high water %d: got %q, %v", tc.highWater, got, err)
+		}
+		b.Remove()
+	}
+}
+
+func TestNewAutoSamplesHeap(t *testing.T) {
+	heapMu.Lock()
+	heapAlloc, heapSample = 1, time.Time{}
+	heapMu.Unlock()
+	if got := currentHeapAlloc(); got <= 1 {
+		t.Errorf("got a heap of %d bytes, want it sampled", got)
+	}
+	// Not sampled again within memStatsInterval.
+	heapMu.Lock()
+	heapAlloc = 1
+	heapMu.Unlock()
+	if got := currentHeapAlloc(); got != 1 {
+		t.Errorf("got %d, want the previous sample", got)
+	}
+	heapMu.Lock()
+	heapSample = time.Time{}
+	heapMu.Unlock()
+}
@@ -0,0 +1,94 @@
+package ramdiskbuffer
+
+import (
+	"sync"
+)
+
+// batchSyncWorkers is the number of files fsynced in parallel
+// by syncFiles.
+const batchSyncWorkers = 8
+
+// PrepareForReadingBatchSync is like PrepareForReading, but it flushes all
+// the buffers to disk at once before seeking to the beginning of them,
+// instead of fsyncing them one at a time: on linux, with one syncfs per
+// filesystem holding the temp files; otherwise (and for the temp files of
+// an FS other than the OS one, see WithFS), with parallel fsyncs.
+// The mirrors of the mirrored buffers (see NewMirrored) are flushed too;
+// the files not modified since they were last fsynced (see Buffer.Sync)
+// are skipped.
+//
+// syncfs flushes everything that was written to the filesystem, not only
+// the buffers: it's faster than many fsyncs when there are many buffers on
+// a filesystem used mostly by them (e.g. a dedicated temp disk).
+func (ba BufferArray) PrepareForReadingBatchSync() error {
+	var (
+		files []File
+		dirty []*Buffer
+	)
+	for _, buf := range ba {
+		if buf.removed {
+			return ErrRemoved
+		}
+		if buf.file != nil {
+			if err := buf.closePipeline(); err != nil {
+				return err
+			}
+		}
+		if !buf.dirty {
+			continue
+		}
+		switch {
+		case buf.file != nil:
+			files = append(files, buf.file)
+		case buf.mirror != nil && buf.mirrorErr == nil:
+			files = append(files, buf.mirror)
+		default:
+			continue
+		}
+		dirty = append(dirty, buf)
+	}
+	if err := syncFiles(files); err != nil {
+		return err
+	}
+	for _, buf := range dirty {
+		buf.dirty = false
+	}
+	return ba.PrepareForReadingNoSync()
+}
+
+// syncFiles flushes files to disk, via syncfs if possible,
+// and otherwise via parallel fsyncs.
+func syncFiles(files []File) error {
+	rest, err := syncFilesystems(files)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	next := make(chan File)
+	for i := 0; i < batchSyncWorkers && i < len(rest); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range next {
+				if err := f.Sync(); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, f := range rest {
+		next <- f
+	}
+	close(next)
+	wg.Wait()
+	return firstErr
+}
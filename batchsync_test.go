@@ -0,0 +1,35 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+// BenchmarkPrepareForReading500Shards compares finalizing 500 disk-backed
+// buffers one fsync at a time with finalizing them via a batch sync.
+func BenchmarkPrepareForReading500Shards(b *testing.B) {
+	chunk := bytes.Repeat([]byte("x"), 4096)
+	for _, tc := range []struct {
+		name    string
+		prepare func(BufferArray) error
+	}{
+		{"PrepareForReading", BufferArray.PrepareForReading},
+		{"PrepareForReadingBatchSync", BufferArray.PrepareForReadingBatchSync},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			ba := NewArray(500, true)
+			defer ba.Remove()
+			for i := 0; i < b.N; i++ {
+				// Dirty all the files again.
+				b.StopTimer()
+				for _, buf := range ba {
+					buf.Write(chunk)
+				}
+				b.StartTimer()
+				if err := tc.prepare(ba); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
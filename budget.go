@@ -0,0 +1,106 @@
+package ramdiskbuffer
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Budget bounds the total RAM held by a group of RAM-backed buffers
+// (see WithBudget), e.g. the thousands of buffers of a job, to run
+// within the memory of a container.
+type Budget struct {
+	max int64
+	// used is the total logical length of the RAM-backed
+	// buffers of the budget.
+	used int64
+
+	mu      sync.Mutex
+	buffers map[*Buffer]struct{}
+}
+
+// NewBudget returns a budget of maxRAM bytes (see WithBudget).
+func NewBudget(maxRAM int64) *Budget {
+	return &Budget{
+		max:     maxRAM,
+		buffers: make(map[*Buffer]struct{}),
+	}
+}
+
+// WithBudget makes a buffer count its RAM against bg: when a write to the
+// buffer would make the total length of the RAM-backed buffers of bg go
+// past its limit, the buffer spills to disk first (see SpillToDisk), and
+// the bytes are written to its temp file. A buffer counts against the
+// budget from its creation until its Remove or Close; the clones and
+// snapshots of a buffer count against its budget. Disk-backed buffers
+// count when they're reset to RAM (see ResetTo). Mirrored buffers (see
+// NewMirrored), which can't spill, count but never spill.
+//
+// Since buffers aren't safe for concurrent use, a write never spills a
+// buffer other than the one written to: it's the buffer that would go
+// past the limit that spills, whatever its size. To spill the largest
+// buffers instead, call Enforce (from the goroutine that uses them).
+// The limit can be overshot by the concurrent writes to buffers of bg,
+// by the size of the writes in flight.
+func WithBudget(bg *Budget) Option {
+	return func(b *Buffer) {
+		b.budget = bg
+	}
+}
+
+// Used returns the total length of the RAM-backed buffers of bg.
+func (bg *Budget) Used() int64 {
+	return atomic.LoadInt64(&bg.used)
+}
+
+// Max returns the limit of bg.
+func (bg *Budget) Max() int64 {
+	return bg.max
+}
+
+// Enforce keeps the RAM used by the buffers of bg within its limit, by
+// spilling the largest ones to disk, like BufferArray.EnforceMemoryBudget.
+// None of the buffers of bg may be in use while it runs.
+func (bg *Budget) Enforce() error {
+	bg.mu.Lock()
+	buffers := make(BufferArray, 0, len(bg.buffers))
+	for b := range bg.buffers {
+		buffers = append(buffers, b)
+	}
+	bg.mu.Unlock()
+	return buffers.EnforceMemoryBudget(bg.max)
+}
+
+// add adds n (which may be negative) to the RAM used by the buffers
+// of bg, if not nil.
+func (bg *Budget) add(n int64) {
+	if bg != nil {
+		atomic.AddInt64(&bg.used, n)
+	}
+}
+
+// overBudget reports whether writing n more bytes to the RAM backing
+// would make the buffer go past the limit of its budget; the degraded
+// buffers (see DidDegrade) stay in RAM.
+func (b *Buffer) overBudget(n int64) bool {
+	return b.budget != nil && b.mirror == nil && !b.degraded && n > 0 && b.budget.Used()+n > b.budget.max
+}
+
+// joinBudget adds the buffer to its budget, if any.
+func (b *Buffer) joinBudget() {
+	if b.budget == nil {
+		return
+	}
+	b.budget.mu.Lock()
+	b.budget.buffers[b] = struct{}{}
+	b.budget.mu.Unlock()
+}
+
+// leaveBudget removes the buffer from its budget, if any.
+func (b *Buffer) leaveBudget() {
+	if b.budget == nil {
+		return
+	}
+	b.budget.mu.Lock()
+	delete(b.budget.buffers, b)
+	b.budget.mu.Unlock()
+}
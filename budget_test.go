@@ -0,0 +1,60 @@
+package ramdiskbuffer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBudget(t *testing.T) {
+	bg := NewBudget(1000)
+	a := New(false, WithBudget(bg))
+	defer a.Remove()
+	b := New(false, WithBudget(bg))
+	defer b.Remove()
+	c := New(false, WithBudget(bg))
+	defer c.Remove()
+
+	a.WriteString(strings.Repeat("a", 400))
+	b.WriteString(strings.Repeat("b", 400))
+	// c would go past the budget: it spills.
+	c.WriteString(strings.Repeat("c", 400))
+	if a.toDisk || b.toDisk || !c.toDisk {
+		t.Errorf("got toDisk %v, %v, %v, want false, false, true", a.toDisk, b.toDisk, c.toDisk)
+	}
+	if bg.Used() != 800 {
+		t.Errorf("Used: got %d, want 800", bg.Used())
+	}
+	if got, _ := c.String(); got != strings.Repeat("c", 400) {
+		t.Errorf("c: got %d bytes, want 400", len(got))
+	}
+
+	// Mirrored buffers count, but don't spill.
+	m := NewMirrored(WithBudget(bg))
+	defer m.Remove()
+	m.WriteString(strings.Repeat("m", 500))
+	if bg.Used() != 1300 {
+		t.Errorf("Used: got %d, want 1300", bg.Used())
+	}
+	if err := bg.Enforce(); err != nil {
+		t.Fatal(err)
+	}
+	if !a.toDisk && !b.toDisk || bg.Used() > 1000 {
+		t.Errorf("after Enforce: got toDisk %v, %v, Used %d", a.toDisk, b.toDisk, bg.Used())
+	}
+
+	// Clones count against the budget: this one would go past it.
+	clone, err := m.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clone.Remove()
+	used := bg.Used()
+	if !clone.toDisk || used != 900 {
+		t.Errorf("clone: got toDisk %v, Used %d, want true, 900", clone.toDisk, used)
+	}
+	// Closing releases the RAM.
+	m.Close()
+	if bg.Used() != 400 {
+		t.Errorf("Used after Close: got %d, want 400", bg.Used())
+	}
+}
@@ -0,0 +1,456 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// NewChunked returns a buffer like New, but whose contents, if disk-backed,
+// are split across several temp files of at most maxFileBytes each: when the
+// current file is full, the buffer rolls over to a new one. This allows
+// buffering more than the maximum size of a single file of the filesystem.
+//
+// The files are presented as a single stream: Read, Size, Reader and the
+// other methods of the buffer work across all of them, and Remove removes
+// all of them. RAM-backed buffers are not affected by maxFileBytes.
+// Like New, it panics if the buffer can't be created (e.g. if maxFileBytes
+// is zero or negative); see NewChunkedBuffer.
+func NewChunked(maxFileBytes int64, toDisk bool, opts ...Option) *Buffer {
+	return mustBuffer(NewChunkedBuffer(maxFileBytes, toDisk, opts...))
+}
+
+// NewChunkedBuffer is like NewChunked, but it returns an error instead of
+// panicking: ErrInvalidSize if maxFileBytes is zero or negative.
+func NewChunkedBuffer(maxFileBytes int64, toDisk bool, opts ...Option) (*Buffer, error) {
+	// Don't append to the array of the caller.
+	return NewBuffer(toDisk, append(opts[:len(opts):len(opts)], WithChunkSize(maxFileBytes))...)
+}
+
+// WithChunkSize is the option of NewChunked: it splits the temp file of a
+// disk-backed buffer in chunk files of at most n bytes each. It wraps the
+// FS of the buffer, so it must be given after WithFS. If n is zero or
+// negative, NewBuffer returns ErrInvalidSize (and New panics).
+func WithChunkSize(n int64) Option {
+	return func(b *Buffer) {
+		if n <= 0 {
+			b.optErr = ErrInvalidSize
+			return
+		}
+		withChunks(n)(b)
+	}
+}
+
+// WithDropReadChunks makes a chunked buffer (see WithChunkSize) remove each
+// chunk file as soon as Read has gone past it, to reclaim the disk space of
+// a large buffer while it's consumed; the last chunk is kept, and Remove
+// removes the rest. The contents before the chunk of the read offset are
+// gone: reading them again (e.g. after Seek, or PrepareForReading) fails,
+// and so do Reader (and the methods that use it), ResetTo and DropPrefix.
+// CurrentDiskBytes counts the bytes of the dropped chunks until Remove.
+// It has no effect on transformed buffers (see WithWritePipeline).
+func WithDropReadChunks() Option {
+	return func(b *Buffer) {
+		b.dropReadChunks = true
+	}
+}
+
+// dropChunksBeforeRead removes the chunks of the temp file before the read
+// offset, if the buffer drops them (see WithDropReadChunks). It's best
+// effort: the chunks that can't be removed are left to Remove.
+func (b *Buffer) dropChunksBeforeRead() {
+	if f, ok := b.file.(*chunkedFile); ok && b.dropReadChunks && !b.transformed() {
+		f.dropBefore(b.roff)
+	}
+}
+
+// withChunks wraps the FS of the buffer so that its files
+// are split in chunks of max bytes.
+func withChunks(max int64) Option {
+	return func(b *Buffer) {
+		b.fs = &chunkedFS{
+			fs:   b.fs,
+			max:  max,
+			sets: make(map[string]*chunkSet),
+		}
+	}
+}
+
+// chunkedFS is an FS whose files are made of chunk files of an underlying FS;
+// a file is named after its first chunk.
+type chunkedFS struct {
+	fs  FS
+	max int64
+
+	mu   sync.Mutex
+	sets map[string]*chunkSet
+}
+
+// chunkSet is the list of the chunks of a file of a chunkedFS.
+// All the chunks but the last one are full; the first dropped ones
+// have been removed (see WithDropReadChunks).
+type chunkSet struct {
+	mu           sync.Mutex
+	dir, pattern string
+	names        []string
+	dropped      int
+}
+
+func (s *chunkSet) chunkNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.names...)
+}
+
+// liveChunkNames returns the names of the chunks that have not been dropped.
+func (s *chunkSet) liveChunkNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.names[s.dropped:]...)
+}
+
+func (fsys *chunkedFS) CreateTemp(dir, pattern string) (File, error) {
+	first, err := fsys.fs.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	set := &chunkSet{
+		dir:     dir,
+		pattern: pattern,
+		names:   []string{first.Name()},
+	}
+	fsys.mu.Lock()
+	fsys.sets[first.Name()] = set
+	fsys.mu.Unlock()
+	return &chunkedFile{fsys: fsys, set: set, files: []File{first}}, nil
+}
+
+func (fsys *chunkedFS) Open(name string) (File, error) {
+	fsys.mu.Lock()
+	set, ok := fsys.sets[name]
+	fsys.mu.Unlock()
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	first, err := fsys.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkedFile{fsys: fsys, set: set, files: []File{first}, readOnly: true}, nil
+}
+
+func (fsys *chunkedFS) Remove(name string) error {
+	fsys.mu.Lock()
+	set, ok := fsys.sets[name]
+	delete(fsys.sets, name)
+	fsys.mu.Unlock()
+	if !ok {
+		return fsys.fs.Remove(name)
+	}
+	var err error
+	for _, chunk := range set.liveChunkNames() {
+		if rerr := fsys.fs.Remove(chunk); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+func (fsys *chunkedFS) SyncDir(dir string) error {
+	if s, ok := fsys.fs.(dirSyncer); ok {
+		return s.SyncDir(dir)
+	}
+	return nil
+}
+
+// chunkedFile is an open handle of a file of a chunkedFS; it opens
+// the chunks as needed, and creates new ones unless it's read-only.
+type chunkedFile struct {
+	fsys     *chunkedFS
+	set      *chunkSet
+	files    []File
+	readOnly bool
+	off      int64
+}
+
+var (
+	errChunkedWhence = errors.New("invalid whence")
+	errChunksDropped = errors.New("chunks dropped")
+)
+
+// chunk returns the handle of the chunk i, opening it, or creating it
+// (and the ones before it) if needed.
+func (f *chunkedFile) chunk(i int, create bool) (File, error) {
+	if i < len(f.files) && f.files[i] != nil {
+		return f.files[i], nil
+	}
+	f.set.mu.Lock()
+	defer f.set.mu.Unlock()
+	if i < f.set.dropped {
+		return nil, &os.PathError{Op: "open", Path: f.set.names[i], Err: errChunksDropped}
+	}
+	for len(f.set.names) <= i {
+		if !create || f.readOnly {
+			return nil, io.EOF
+		}
+		file, err := f.fsys.fs.CreateTemp(f.set.dir, f.set.pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.set.names = append(f.set.names, file.Name())
+		f.setHandle(len(f.set.names)-1, file)
+	}
+	if i < len(f.files) && f.files[i] != nil {
+		return f.files[i], nil
+	}
+	file, err := f.fsys.fs.Open(f.set.names[i])
+	if err != nil {
+		return nil, err
+	}
+	f.setHandle(i, file)
+	return file, nil
+}
+
+func (f *chunkedFile) setHandle(i int, file File) {
+	for len(f.files) <= i {
+		f.files = append(f.files, nil)
+	}
+	f.files[i] = file
+}
+
+func (f *chunkedFile) Name() string {
+	// The name of the first chunk, even once it's dropped.
+	return f.set.names[0]
+}
+
+// dropBefore removes the chunks entirely before the offset off,
+// but for the last one (see WithDropReadChunks).
+func (f *chunkedFile) dropBefore(off int64) error {
+	f.set.mu.Lock()
+	defer f.set.mu.Unlock()
+	n := int(off / f.fsys.max)
+	if n > len(f.set.names)-1 {
+		n = len(f.set.names) - 1
+	}
+	for ; f.set.dropped < n; f.set.dropped++ {
+		i := f.set.dropped
+		if i < len(f.files) && f.files[i] != nil {
+			f.files[i].Close()
+			f.files[i] = nil
+		}
+		if err := f.fsys.fs.Remove(f.set.names[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *chunkedFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *chunkedFile) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		i, o := int(off/f.fsys.max), off%f.fsys.max
+		want := len(p) - n
+		if int64(want) > f.fsys.max-o {
+			want = int(f.fsys.max - o)
+		}
+		chunk, err := f.chunk(i, false)
+		if err != nil {
+			return n, err
+		}
+		m, err := chunk.ReadAt(p[n:n+want], o)
+		n += m
+		off += int64(m)
+		if m < want {
+			if err == nil {
+				err = io.EOF
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (f *chunkedFile) Write(p []byte) (int, error) {
+	n, err := f.WriteAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *chunkedFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *chunkedFile) WriteAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		i, o := int(off/f.fsys.max), off%f.fsys.max
+		want := len(p) - n
+		if int64(want) > f.fsys.max-o {
+			want = int(f.fsys.max - o)
+		}
+		chunk, err := f.chunk(i, true)
+		if err != nil {
+			return n, err
+		}
+		m, err := chunk.WriteAt(p[n:n+want], o)
+		n += m
+		off += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (f *chunkedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		size, err := f.size()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: errChunkedWhence}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: os.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// size returns the total size of the chunks.
+func (f *chunkedFile) size() (int64, error) {
+	last := len(f.set.chunkNames()) - 1
+	chunk, err := f.chunk(last, false)
+	if err != nil {
+		return 0, err
+	}
+	info, err := chunk.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return int64(last)*f.fsys.max + info.Size(), nil
+}
+
+func (f *chunkedFile) Stat() (os.FileInfo, error) {
+	first := f.files[0]
+	if first == nil {
+		// Dropped: stat the last chunk instead.
+		chunk, err := f.chunk(len(f.set.chunkNames())-1, false)
+		if err != nil {
+			return nil, err
+		}
+		first = chunk
+	}
+	info, err := first.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size, err := f.size()
+	if err != nil {
+		return nil, err
+	}
+	return chunkedFileInfo{info, size}, nil
+}
+
+func (f *chunkedFile) Sync() error {
+	for _, file := range f.files {
+		if file == nil {
+			continue
+		}
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Truncate changes the size of the file, creating or removing chunks as needed.
+func (f *chunkedFile) Truncate(size int64) error {
+	if f.readOnly {
+		return &os.PathError{Op: "truncate", Path: f.Name(), Err: os.ErrPermission}
+	}
+	f.set.mu.Lock()
+	dropped := f.set.dropped
+	f.set.mu.Unlock()
+	if dropped > 0 {
+		return &os.PathError{Op: "truncate", Path: f.Name(), Err: errChunksDropped}
+	}
+	keep := 1
+	if size > 0 {
+		keep = int((size + f.fsys.max - 1) / f.fsys.max)
+	}
+	old := len(f.set.chunkNames())
+	for i := 0; i < keep; i++ {
+		if i < old-1 && i < keep-1 {
+			// Already full.
+			continue
+		}
+		chunk, err := f.chunk(i, true)
+		if err != nil {
+			return err
+		}
+		chunkSize := f.fsys.max
+		if i == keep-1 {
+			chunkSize = size - int64(i)*f.fsys.max
+		}
+		if err := chunk.Truncate(chunkSize); err != nil {
+			return err
+		}
+	}
+
+	f.set.mu.Lock()
+	defer f.set.mu.Unlock()
+	for i := len(f.set.names) - 1; i >= keep; i-- {
+		if i < len(f.files) && f.files[i] != nil {
+			f.files[i].Close()
+		}
+		if err := f.fsys.fs.Remove(f.set.names[i]); err != nil {
+			return err
+		}
+		f.set.names = f.set.names[:i]
+	}
+	if len(f.files) > keep {
+		f.files = f.files[:keep]
+	}
+	return nil
+}
+
+func (f *chunkedFile) Close() error {
+	var err error
+	for _, file := range f.files {
+		if file == nil {
+			continue
+		}
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// chunkedFileInfo is the info of the first chunk of a file,
+// with the size of the whole file.
+type chunkedFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (info chunkedFileInfo) Size() int64 {
+	return info.size
+}
@@ -0,0 +1,200 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithDropReadChunks(t *testing.T) {
+	fsys := NewMemFS()
+	b := New(true, WithFS(fsys), WithChunkSize(100), WithDropReadChunks())
+	want := strings.Repeat("0123456789", 100)
+	b.WriteString(want)
+	if err := b.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	set := b.fs.(*chunkedFS).sets[b.file.Name()]
+	names := set.chunkNames()
+	if len(names) != 10 {
+		t.Fatalf("got %d chunks, want 10", len(names))
+	}
+
+	got := make([]byte, 350)
+	if _, err := io.ReadFull(b, got); err != nil || string(got) != want[:350] {
+		t.Fatalf("got (%q, %v)", got, err)
+	}
+	for i, name := range names {
+		_, err := fsys.Open(name)
+		if dropped := err != nil; dropped != (i < 3) {
+			t.Errorf("chunk %d: dropped %v, want %v", i, dropped, i < 3)
+		}
+	}
+	rest, err := ioutil.ReadAll(b)
+	if err != nil || string(rest) != want[350:] {
+		t.Errorf("rest: got %d bytes, %v, want %d bytes", len(rest), err, len(want)-350)
+	}
+	if len(set.liveChunkNames()) != 1 {
+		t.Errorf("got %d live chunks after reading all, want 1", len(set.liveChunkNames()))
+	}
+	if _, err := b.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Read(got); err == nil {
+		t.Error("reading a dropped chunk: got no error")
+	}
+	if err := b.Remove(); err != nil {
+		t.Errorf("Remove: %v", err)
+	}
+	if _, err := fsys.Open(names[9]); err == nil {
+		t.Error("the last chunk was not removed")
+	}
+}
+
+func TestWithChunkSizeInvalid(t *testing.T) {
+	if _, err := NewBuffer(true, WithChunkSize(0)); err != ErrInvalidSize {
+		t.Errorf("got %v, want ErrInvalidSize", err)
+	}
+}
+
+func TestNewChunkedBufferInvalid(t *testing.T) {
+	for _, max := range []int64{0, -1} {
+		if _, err := NewChunkedBuffer(max, true); err != ErrInvalidSize {
+			t.Errorf("max %d: got %v, want ErrInvalidSize", max, err)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("NewChunked(0) didn't panic")
+		}
+	}()
+	NewChunked(0, true)
+}
+
+func TestNewChunkedDoesNotAliasOptions(t *testing.T) {
+	// Room in the array of opts for the option of NewChunked.
+	opts := make([]Option, 1, 2)
+	opts[0] = WithFS(NewMemFS())
+	b := NewChunked(10, true, opts...)
+	defer b.Remove()
+	if opts[:2][1] != nil {
+		t.Error("NewChunked appended its option to the array of the caller")
+	}
+}
+
+// chunkNames returns the names of the chunk files of a chunked buffer.
+func chunkNames(b *Buffer) []string {
+	return b.fs.(*chunkedFS).sets[b.file.Name()].chunkNames()
+}
+
+func TestChunkedRollover(t *testing.T) {
+	b := NewChunked(100, true, WithFS(NewMemFS()))
+	defer b.Remove()
+	b.WriteString(strings.Repeat("x", 100))
+	if n := len(chunkNames(b)); n != 1 {
+		t.Errorf("full chunk: got %d chunks, want 1", n)
+	}
+	b.WriteString("y")
+	if n := len(chunkNames(b)); n != 2 {
+		t.Errorf("one byte past the chunk: got %d chunks, want 2", n)
+	}
+	b.WriteString(strings.Repeat("y", 99))
+	if n := len(chunkNames(b)); n != 2 {
+		t.Errorf("two full chunks: got %d chunks, want 2", n)
+	}
+	if got, err := b.String(); err != nil || got != strings.Repeat("x", 100)+strings.Repeat("y", 100) {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestChunkedReads(t *testing.T) {
+	want := strings.Repeat("0123456789", 35)
+	for _, opts := range [][]Option{nil, {WithFS(NewMemFS())}} {
+		b := NewChunked(100, true, opts...)
+		b.WriteString(want)
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Read, across the chunks.
+		p := make([]byte, 150)
+		if _, err := io.ReadFull(b, p); err != nil || string(p) != want[:150] {
+			t.Errorf("Read: got %q, %v", p, err)
+		}
+		// Seek, to the end of a chunk.
+		if off, err := b.Seek(99, io.SeekStart); err != nil || off != 99 {
+			t.Errorf("Seek: got (%d, %v), want 99", off, err)
+		}
+		p = p[:2]
+		if _, err := io.ReadFull(b, p); err != nil || string(p) != want[99:101] {
+			t.Errorf("Read after Seek: got %q, %v, want %q", p, err, want[99:101])
+		}
+		// ReadAt, across three chunks.
+		p = make([]byte, 210)
+		if n, err := b.ReadAt(p, 95); err != nil || string(p[:n]) != want[95:305] {
+			t.Errorf("ReadAt: got %d bytes, %v", n, err)
+		}
+		// ReadAt, up to the end.
+		if n, err := b.ReadAt(p, 300); err != io.EOF || string(p[:n]) != want[300:] {
+			t.Errorf("ReadAt at the end: got (%q, %v), want (%q, EOF)", p[:n], err, want[300:])
+		}
+		// WriteTo, from the read offset.
+		var sb strings.Builder
+		if n, err := b.WriteTo(&sb); err != nil || sb.String() != want[101:] {
+			t.Errorf("WriteTo: got %d bytes, %v, want %d bytes", n, err, len(want)-101)
+		}
+		b.Remove()
+	}
+}
+
+func TestChunkedTruncate(t *testing.T) {
+	fsys := NewMemFS()
+	b := NewChunked(100, true, WithFS(fsys))
+	defer b.Remove()
+	want := strings.Repeat("0123456789", 35)
+	b.WriteString(want)
+	names := chunkNames(b)
+	if len(names) != 4 {
+		t.Fatalf("got %d chunks, want 4", len(names))
+	}
+	if err := b.Truncate(150); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(chunkNames(b)); n != 2 {
+		t.Errorf("got %d chunks, want 2", n)
+	}
+	for _, name := range names[2:] {
+		if _, err := fsys.Open(name); err == nil {
+			t.Errorf("chunk %s was not removed", name)
+		}
+	}
+	b.WriteString("abc")
+	if got, err := b.String(); err != nil || got != want[:150]+"abc" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if err := b.Truncate(100); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := b.String(); err != nil || got != want[:100] {
+		t.Errorf("got %q, %v, want %q", got, err, want[:100])
+	}
+}
+
+func TestChunkedRemove(t *testing.T) {
+	b := NewChunked(100, true)
+	b.WriteString(strings.Repeat("x", 450))
+	names := chunkNames(b)
+	if len(names) != 5 {
+		t.Fatalf("got %d chunks, want 5", len(names))
+	}
+	if err := b.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("chunk %s: got %v, want it removed", name, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultFilePrefix is the beginning of the names of the temp files,
+// unless changed by WithFilePrefix.
+const defaultFilePrefix = "ramdiskbuffer"
+
+// WithFinalizer makes the buffer remove itself (see Remove) when it's
+// garbage collected without having been removed, so that a buffer dropped
+// by mistake (e.g. on a panic) doesn't leak its temp file forever.
+// It's a safety net, not a substitute for Remove: the garbage collector
+// gives no guarantee of when, or whether, it runs the finalizer. The
+// buffers tracked by the registry (see EnableRegistry), or by a budget
+// (see WithBudget), are never garbage collected. The clones and snapshots
+// of the buffer get a finalizer too.
+func WithFinalizer() Option {
+	return func(b *Buffer) {
+		b.finalize = true
+	}
+}
+
+// WithNoFinalizer undoes WithFinalizer, given before it (e.g. in options
+// shared by several call sites), for the callers that always call Remove
+// and don't want the overhead of a finalizer, which also delays the
+// collection of the buffer. The caller is then fully responsible for the
+// cleanup: a buffer dropped without Remove leaks its temp file (or its
+// file descriptor) until the process exits, and nothing reclaims it.
+func WithNoFinalizer() Option {
+	return func(b *Buffer) {
+		b.finalize = false
+	}
+}
+
+// setFinalizer sets the finalizer of the buffer, if it has one
+// (see WithFinalizer).
+func (b *Buffer) setFinalizer() {
+	if b.finalize {
+		runtime.SetFinalizer(b, (*Buffer).Remove)
+	}
+}
+
+// clearFinalizer clears the finalizer of the buffer, if it has one.
+func (b *Buffer) clearFinalizer() {
+	if b.finalize {
+		runtime.SetFinalizer(b, nil)
+	}
+}
+
+// CleanupOrphans removes the temp files of buffers left in dir (the default
+// temp directory if empty) by the processes that crashed, or that didn't
+// remove them: the regular files whose name starts with "ramdiskbuffer" (the
+// default prefix, see WithFilePrefix), not modified for more than olderThan.
+// It returns the number of files removed, and the errors joined (see
+// errors.Join); the files that can't be removed are skipped.
+//
+// It can't tell whether a file is still used by a live buffer, of this
+// process or of another one: olderThan must be longer than the time for
+// which a buffer may go without being written to.
+func CleanupOrphans(dir string, olderThan time.Duration) (int, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		removed int
+		errs    []error
+	)
+	cutoff := time.Now().Add(-olderThan)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasPrefix(entry.Name(), defaultFilePrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
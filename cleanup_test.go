@@ -0,0 +1,75 @@
+package ramdiskbuffer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWithFinalizer(t *testing.T) {
+	fsys := NewMemFS()
+	name := func() string {
+		b := New(true, WithFS(fsys), WithFinalizer())
+		b.WriteString("dropped")
+		return b.file.Name()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runtime.GC()
+		if _, err := fsys.Open(name); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the temp file of the dropped buffer was not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWithNoFinalizer(t *testing.T) {
+	fsys := NewMemFS()
+	name := func() string {
+		b := New(true, WithFS(fsys), WithFinalizer(), WithNoFinalizer())
+		if b.finalize {
+			t.Error("the buffer has a finalizer")
+		}
+		b.WriteString("dropped")
+		return b.file.Name()
+	}()
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := fsys.Open(name); err != nil {
+		t.Errorf("the temp file of the dropped buffer was removed: %v", err)
+	}
+	fsys.Remove(name)
+}
+
+func TestCleanupOrphans(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"ramdiskbuffer123", "ramdiskbuffer-456.json", "other", "ramdiskbuffer789"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if name != "ramdiskbuffer789" {
+			os.Chtimes(path, old, old)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "ramdiskbufferdir"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	n, err := CleanupOrphans(dir, time.Hour)
+	if n != 2 || err != nil {
+		t.Errorf("got (%d, %v), want (2, nil)", n, err)
+	}
+	for _, name := range []string{"other", "ramdiskbuffer789", "ramdiskbufferdir"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was removed", name)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ramdiskbuffer
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// WithCompressor makes a disk-backed buffer compress the contents of its
+// temp file: the writes go through the writer returned by newWriter, which
+// is closed by PrepareForReading (and by Close), and the reads go through
+// the reader returned by newReader. It's a stage of the write and read
+// pipelines (see WithWritePipeline), and it has no effect on RAM-backed
+// buffers.
+//
+// The codec is pluggable so that the package doesn't depend on any codec
+// but gzip (see WithGzip): e.g. the zstd encoder and decoder of
+// github.com/klauspost/compress can be plugged in. Since writing after
+// PrepareForReading appends a new compressed stream after the previous one,
+// the reader must decode concatenated streams (like gzip and zstd readers
+// do).
+func WithCompressor(newWriter func(io.Writer) io.WriteCloser, newReader func(io.Reader) io.Reader) Option {
+	return func(b *Buffer) {
+		WithWritePipeline(newWriter)(b)
+		WithReadPipeline(newReader)(b)
+	}
+}
+
+// WithGzip makes a disk-backed buffer compress the contents of its temp
+// file with gzip, at the default compression level (see WithCompressor).
+// If gzip is the only stage of the pipelines, the temp file can be read
+// back even by a buffer without any read pipeline.
+func WithGzip() Option {
+	return WithCompression(gzip.DefaultCompression)
+}
+
+// WithCompression is like WithGzip, but it compresses at the given gzip
+// level: from gzip.BestSpeed to gzip.BestCompression, or one of the other
+// levels of compress/gzip (e.g. gzip.HuffmanOnly); otherwise NewBuffer
+// returns the error of gzip.NewWriterLevel (and New panics). Size is the
+// logical length, and PhysicalLen the size of the compressed temp file.
+func WithCompression(level int) Option {
+	return func(b *Buffer) {
+		if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+			b.optErr = err
+			return
+		}
+		only := !b.transformed()
+		WithCompressor(func(w io.Writer) io.WriteCloser {
+			zw, _ := gzip.NewWriterLevel(w, level)
+			return zw
+		}, GzipDecompressor)(b)
+		if only {
+			b.codec = codecGzip
+		}
+	}
+}
+
+// GzipCompressor returns a gzip writer on w, at the default compression level.
+func GzipCompressor(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}
+
+// GzipDecompressor returns a gzip reader on r; if r has no gzip header,
+// the reader fails with the error of gzip.NewReader (io.EOF if r is empty).
+func GzipDecompressor(r io.Reader) io.Reader {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return errReader{err}
+	}
+	return zr
+}
@@ -0,0 +1,92 @@
+package ramdiskbuffer
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReaderOfGzipBufferInWriteMode(t *testing.T) {
+	b := New(true, WithGzip())
+	defer b.Remove()
+	want := strings.Repeat("compressible ", 1000)
+	if _, err := b.WriteString(want); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := b.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != want {
+		t.Fatalf("Reader: got %d bytes, %v, want %d bytes", len(got), err, len(want))
+	}
+
+	// The writes go on in a new stream.
+	if _, err := b.WriteString("more"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := b.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Remove()
+	if err := c.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	got, err = io.ReadAll(c)
+	if err != nil || string(got) != want+"more" {
+		t.Fatalf("Clone: got %d bytes, %v, want %d bytes", len(got), err, len(want)+4)
+	}
+}
+
+func TestPhysicalLen(t *testing.T) {
+	plain := New(true)
+	defer plain.Remove()
+	plain.WriteString("hello")
+	if n, err := plain.PhysicalLen(); n != 5 || err != nil {
+		t.Errorf("plain: got %d, %v, want 5", n, err)
+	}
+
+	zipped := New(true, WithGzip())
+	defer zipped.Remove()
+	zipped.WriteString(strings.Repeat("a", 100000))
+	if err := zipped.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := zipped.PhysicalLen()
+	if err != nil || n <= 0 || n >= zipped.Size() {
+		t.Errorf("gzip: got %d, %v, want 0 < n < %d", n, err, zipped.Size())
+	}
+}
+
+func TestCompressionLevels(t *testing.T) {
+	want := strings.Repeat("compressible log line\n", 10000)
+	var sizes []int64
+	for _, level := range []int{gzip.NoCompression, gzip.BestSpeed, gzip.BestCompression} {
+		b := New(true, WithCompression(level))
+		b.WriteString(want)
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+		n, err := b.PhysicalLen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, n)
+		got, err := io.ReadAll(b)
+		if err != nil || string(got) != want || b.Size() != int64(len(want)) {
+			t.Errorf("level %d: got %d bytes, %v, Size %d, want %d bytes", level, len(got), err, b.Size(), len(want))
+		}
+		b.Remove()
+	}
+	if sizes[0] <= int64(len(want)) || sizes[2] > sizes[1] || sizes[1] >= sizes[0] {
+		t.Errorf("got physical sizes %v for the levels none, speed and best", sizes)
+	}
+
+	if _, err := NewBuffer(true, WithCompression(42)); err == nil {
+		t.Error("got no error for level 42")
+	}
+}
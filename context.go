@@ -0,0 +1,53 @@
+package ramdiskbuffer
+
+import (
+	"context"
+)
+
+// contextChunk is the size of the chunks in which the buffers bound to a
+// context (see WithContext) write their temp file, checking the context
+// before each one.
+const contextChunk = 1 << 20
+
+// WithContext binds the buffer to ctx, e.g. the context of the HTTP request
+// or of the job it buffers for: once ctx is done, the writes, reads and
+// spills (see SpillToDisk) of the buffer fail with ctx.Err(), and the buffer
+// is removed (see Remove), releasing its temp file or its RAM; from then on,
+// it's like any removed buffer. The clones and snapshots of the buffer are
+// bound to ctx too.
+//
+// The writes to the temp file (including the copy of the RAM backing by
+// SpillToDisk) are done in chunks of 1MiB, and ctx is checked before each
+// chunk, so that a long write stops soon after ctx is done, with the error
+// and the number of bytes written before it; ReadFrom and WriteTo check it
+// before each chunk they copy. The write limiter waits with ctx, unless it
+// has its own (see WithWriteLimiterContext). A single read or write syscall
+// in progress is not interrupted.
+func WithContext(ctx context.Context) Option {
+	return func(b *Buffer) {
+		b.ctx = ctx
+	}
+}
+
+// contextErr returns the error of the context of the buffer,
+// if any and done.
+func (b *Buffer) contextErr() error {
+	if b.ctx == nil {
+		return nil
+	}
+	return b.ctx.Err()
+}
+
+// checkContext removes the buffer if its context is done,
+// and returns the error of the context; once the buffer is
+// removed, it returns nil, leaving the error to the caller.
+func (b *Buffer) checkContext() error {
+	if b.removed {
+		return nil
+	}
+	err := b.contextErr()
+	if err != nil {
+		b.Remove()
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package ramdiskbuffer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// cancellingFile cancels a context when it's written to.
+type cancellingFile struct {
+	File
+	cancel context.CancelFunc
+}
+
+func (f cancellingFile) Write(p []byte) (int, error) {
+	f.cancel()
+	return f.File.Write(p)
+}
+
+func (f cancellingFile) WriteString(s string) (int, error) {
+	f.cancel()
+	return f.File.WriteString(s)
+}
+
+func TestWithContext(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		fsys := NewMemFS()
+		b := New(toDisk, WithContext(ctx), WithFS(fsys))
+		if _, err := b.WriteString("hello"); err != nil {
+			t.Fatal(err)
+		}
+		name := b.filePath()
+		cancel()
+		if _, err := b.WriteString("world"); err != context.Canceled {
+			t.Errorf("toDisk %v: Write: got %v, want context.Canceled", toDisk, err)
+		}
+		if !b.removed {
+			t.Errorf("toDisk %v: the buffer was not removed", toDisk)
+		}
+		if _, err := fsys.Open(name); toDisk && err == nil {
+			t.Errorf("toDisk %v: the temp file was not removed", toDisk)
+		}
+		if _, err := b.Read(make([]byte, 1)); err != ErrRemoved {
+			t.Errorf("toDisk %v: Read: got %v, want ErrRemoved", toDisk, err)
+		}
+	}
+}
+
+func TestWithContextStopsLongWrite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fsys := newWrapFS(func(f File) File { return cancellingFile{f, cancel} })
+	b := New(true, WithContext(ctx), WithFS(fsys))
+	n, err := b.WriteString(strings.Repeat("x", 3*contextChunk))
+	if n != contextChunk || err != context.Canceled {
+		t.Errorf("got (%d, %v), want (%d, context.Canceled)", n, err, contextChunk)
+	}
+	if !b.removed {
+		t.Error("the buffer was not removed")
+	}
+
+	// Spilling stops too, and the buffer stays in RAM until removed.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	fsys = newWrapFS(func(f File) File { return cancellingFile{f, cancel} })
+	b = New(false, WithContext(ctx), WithFS(fsys))
+	b.WriteString(strings.Repeat("x", 3*contextChunk))
+	if err := b.SpillToDisk(); err != context.Canceled {
+		t.Errorf("SpillToDisk: got %v, want context.Canceled", err)
+	}
+	if b.toDisk || b.file != nil {
+		t.Error("the buffer didn't stay in RAM")
+	}
+	if _, err := b.WriteString("x"); err != context.Canceled || !b.removed {
+		t.Errorf("Write after the spill: got %v, removed %v", err, b.removed)
+	}
+}
+
+func TestWithContextClone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := New(true, WithContext(ctx))
+	defer b.Remove()
+	b.WriteString("hello")
+	c, err := b.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Remove()
+	cancel()
+	if _, err := c.WriteString("x"); err != context.Canceled || !c.removed {
+		t.Errorf("clone: got %v, removed %v, want context.Canceled, true", err, c.removed)
+	}
+}
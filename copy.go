@@ -0,0 +1,216 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// fder is implemented by the files that have an OS file descriptor
+// (e.g. *os.File).
+type fder interface {
+	Fd() uintptr
+}
+
+var errNoFastCopy = errors.New("ramdiskbuffer: no fast copy between these files")
+
+// Append appends the contents of src to the buffer, and returns the number
+// of bytes appended. The read offset of src is not affected.
+//
+// When both buffers are disk-backed on OS files, the contents are copied
+// by the kernel (via copy_file_range on linux), without going through
+// userspace, if the filesystem allows it; otherwise they're copied
+// via src.Reader.
+func (b *Buffer) Append(src *Buffer) (int64, error) {
+	if b.removed {
+		return 0, ErrRemoved
+	}
+	if b.writeClosed {
+		return 0, ErrWriteClosed
+	}
+	if err := b.resumeWriting(); err != nil {
+		return 0, err
+	}
+	if b.sink == nil {
+		if err := b.ensureFile(); err != nil {
+			return 0, err
+		}
+	}
+	return copyFast(b, src)
+}
+
+// Clone returns a new buffer with the same kind of backing and the same
+// configuration as b (but for WithReadHash), and a copy of its contents
+// (see Append). It's not in read mode, and it's independent of b.
+// Sink buffers can't be cloned.
+func (b *Buffer) Clone() (*Buffer, error) {
+	if b.removed {
+		return nil, ErrRemoved
+	}
+	if b.sink != nil {
+		return nil, ErrUnsupported
+	}
+	c, err := b.newLike()
+	if err != nil {
+		return nil, err
+	}
+	if !c.toDisk {
+		c.growMem(len(b.data))
+	} else if !c.lazy || b.file != nil {
+		if err := c.ensureFile(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := copyFast(c, b); err != nil {
+		c.Remove()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Snapshot returns a new buffer with the contents of b at this point in
+// time, which is independent of b: the writes to either one don't affect
+// the other. It's not in read mode.
+//
+// For RAM-backed buffers, the snapshot is copy-on-write: it shares the
+// RAM backing of b, and it's cheap until one of the two is written to
+// (but for the buffers created by NewFromSlice, whose snapshots are copies).
+// Other buffers fall back to a full copy (see Clone), via the kernel where
+// possible (on filesystems like XFS and Btrfs, copy_file_range shares the
+// extents of the temp file, so that the copy is cheap too). Snapshot panics
+// if it fails, like New; see SnapshotBuffer.
+//
+// Since the snapshot is independent of b, it can be read from another
+// goroutine while b is written to, without any locking.
+func (b *Buffer) Snapshot() *Buffer {
+	return mustBuffer(b.SnapshotBuffer())
+}
+
+// SnapshotBuffer is like Snapshot, but it returns an error instead of
+// panicking if the snapshot can't be created, like NewBuffer. Sink buffers
+// can't be snapshotted.
+func (b *Buffer) SnapshotBuffer() (*Buffer, error) {
+	if b.toDisk || b.sink != nil || b.removed {
+		return b.Clone()
+	}
+	s, err := b.newLike()
+	if err != nil {
+		return nil, err
+	}
+	if b.borrowed {
+		// The caller may reuse the scratch slice: don't share it.
+		s.data = append([]byte(nil), b.data...)
+		s.addLength(int64(len(s.data)))
+		s.hashWritten(s.data, "", len(s.data))
+		s.countWritten(int64(len(s.data)))
+		return s, nil
+	}
+	// With no spare capacity, the first append to the snapshot
+	// reallocates; b appends past the end of the bytes it shares.
+	s.data = b.data[:len(b.data):len(b.data)]
+	s.addLength(int64(len(s.data)))
+	s.hashWritten(s.data, "", len(s.data))
+	s.countWritten(int64(len(s.data)))
+	s.shared = true
+	b.shared = true
+	return s, nil
+}
+
+// newLike returns a new empty buffer with the same configuration as b,
+// but for WithReadHash. It fails if the limit of SetMaxLiveBuffers
+// is reached.
+func (b *Buffer) newLike() (*Buffer, error) {
+	c := &Buffer{
+		fs:                 b.fs,
+		growIncrement:      b.growIncrement,
+		spills:             b.spills,
+		spillAbove:         b.spillAbove,
+		toDisk:             b.toDisk,
+		lazy:               b.lazy,
+		durableDir:         b.durableDir,
+		lenientRead:        b.lenientRead,
+		tempDir:            b.tempDir,
+		prefix:             b.prefix,
+		suffix:             b.suffix,
+		fileMode:           b.fileMode,
+		writeStages:        b.writeStages,
+		readStages:         b.readStages,
+		codec:              b.codec,
+		readBufferSize:     b.readBufferSize,
+		tailPollInterval:   b.tailPollInterval,
+		statsHook:          b.statsHook,
+		slowWriteThreshold: b.slowWriteThreshold,
+		limiter:            b.limiter,
+		limiterCtx:         b.limiterCtx,
+		ctx:                b.ctx,
+		blockSize:          b.blockSize,
+		noFileWait:         b.noFileWait,
+		memFallback:        b.memFallback,
+		minFreeBytes:       b.minFreeBytes,
+		diskFullPolicy:     b.diskFullPolicy,
+		altTempDirs:        b.altTempDirs,
+		maxSize:            b.maxSize,
+		dropReadChunks:     b.dropReadChunks,
+		budget:             b.budget,
+		finalize:           b.finalize,
+		newHash:            b.newHash,
+		strictLifecycle:    b.strictLifecycle,
+		mmapReads:          b.mmapReads,
+	}
+	if c.newHash != nil {
+		c.writeHash = c.newHash()
+	}
+	if err := c.acquireLiveSlot(); err != nil {
+		return nil, err
+	}
+	c.register()
+	c.setFinalizer()
+	return c, nil
+}
+
+// copyFast appends the contents of src to dst, in the kernel if possible.
+func copyFast(dst, src *Buffer) (int64, error) {
+	if src.removed {
+		return 0, ErrRemoved
+	}
+	if src.file == nil && !src.toDisk && src.sink == nil {
+		n, err := dst.Write(src.data)
+		return int64(n), err
+	}
+
+	size := src.Size()
+	var copied int64
+	if dst.file != nil && src.file != nil && !dst.transformed() && !src.transformed() && dst.fitsMaxSize(size) && dst.writeHash == nil {
+		if err := src.flushWrites(); err != nil {
+			return 0, err
+		}
+		if err := dst.flushWrites(); err != nil {
+			return 0, err
+		}
+		dst.dirty = true
+		n, err := dst.copyFileRangeLimited(src.file, size)
+		copied = n
+		dst.addLength(n)
+		dst.countWritten(n)
+		if err != nil || copied == size {
+			return copied, err
+		}
+	}
+
+	// Copy the rest in userspace.
+	r, err := src.Reader()
+	if err != nil {
+		return copied, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	if copied > 0 {
+		if _, err := io.CopyN(ioutil.Discard, r, copied); err != nil {
+			return copied, err
+		}
+	}
+	chunk := make([]byte, copyChunkSize(size-copied))
+	n, err := io.CopyBuffer(dst, io.LimitReader(r, size-copied), chunk)
+	return copied + n, err
+}
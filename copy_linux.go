@@ -0,0 +1,43 @@
+//go:build linux
+// +build linux
+
+package ramdiskbuffer
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// copyFileRange copies n bytes of src, from offset off, to the current
+// offset of dst, in the kernel (via copy_file_range), if both are OS files.
+// It returns the number of bytes copied; if it fails before copying
+// anything, the caller falls back to copying in userspace.
+func copyFileRange(dst, src File, off, n int64) (int64, error) {
+	dfd, ok := dst.(fder)
+	if !ok {
+		return 0, errNoFastCopy
+	}
+	sfd, ok := src.(fder)
+	if !ok {
+		return 0, errNoFastCopy
+	}
+	var copied int64
+	for copied < n {
+		want := n - copied
+		if want > 1<<30 {
+			want = 1 << 30
+		}
+		m, err := unix.CopyFileRange(int(sfd.Fd()), &off, int(dfd.Fd()), nil, int(want), 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return copied, err
+		}
+		if m == 0 {
+			// src is shorter than n.
+			break
+		}
+		copied += int64(m)
+	}
+	return copied, nil
+}
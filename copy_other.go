@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package ramdiskbuffer
+
+// copyFileRange is not available: the caller copies in userspace.
+func copyFileRange(dst, src File, off, n int64) (int64, error) {
+	return 0, errNoFastCopy
+}
@@ -0,0 +1,97 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSnapshotOfScratchBackedBuffer(t *testing.T) {
+	scratch := make([]byte, 0, 16)
+	b := NewFromSlice(scratch, false)
+	b.WriteString("aaaa")
+	s := b.Snapshot()
+	defer s.Remove()
+	b.Remove()
+
+	// The next request reuses the arena.
+	next := NewFromSlice(scratch, false)
+	defer next.Remove()
+	next.WriteString("cccc")
+
+	if err := s.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 8)
+	n, _ := s.Read(got)
+	if string(got[:n]) != "aaaa" {
+		t.Errorf("snapshot: got %q, want %q", got[:n], "aaaa")
+	}
+}
+
+func TestSnapshotWhileWriting(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		b.WriteString("stable")
+		s, err := b.SnapshotBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan string)
+		go func() {
+			s.PrepareForReading()
+			got, _ := io.ReadAll(s)
+			done <- string(got)
+		}()
+		for i := 0; i < 100; i++ {
+			b.WriteString(" more")
+		}
+		if got := <-done; got != "stable" {
+			t.Errorf("toDisk %v: got %q, want %q", toDisk, got, "stable")
+		}
+		s.Remove()
+		b.Remove()
+	}
+
+	sink := NewSink(io.Discard)
+	defer sink.Remove()
+	if _, err := sink.SnapshotBuffer(); err != ErrUnsupported {
+		t.Errorf("sink: got %v, want ErrUnsupported", err)
+	}
+}
+
+// BenchmarkAppend compares Append, which copies between temp files via
+// copy_file_range where supported, with a naive io.Copy through userspace.
+func BenchmarkAppend(b *testing.B) {
+	const size = 16 << 20
+	src := New(true)
+	defer src.Remove()
+	src.Write(bytes.Repeat([]byte("0123456789abcdef"), size/16))
+	if err := src.PrepareForReadingNoSync(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Append", func(b *testing.B) {
+		b.SetBytes(size)
+		for i := 0; i < b.N; i++ {
+			dst := New(true)
+			if _, err := dst.Append(src); err != nil {
+				b.Fatal(err)
+			}
+			dst.Remove()
+		}
+	})
+	b.Run("io.Copy", func(b *testing.B) {
+		b.SetBytes(size)
+		for i := 0; i < b.N; i++ {
+			dst := New(true)
+			if err := src.PrepareForReadingNoSync(); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.Copy(dst, src); err != nil {
+				b.Fatal(err)
+			}
+			dst.Remove()
+		}
+	})
+}
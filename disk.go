@@ -1,161 +1,2469 @@
 package ramdiskbuffer
 
 import (
+	"bufio"
 	"bytes"
-	"io/ioutil"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 type Buffer struct {
-	file *os.File
-	buf  bytes.Buffer
+	fs   FS
+	file File
+	// data is the backing of RAM-backed buffers.
+	data []byte
+	// shared is true if data is shared with snapshots (see Snapshot):
+	// then it must not be modified in place, but only appended to.
+	// borrowed is true if data is the scratch slice of the caller
+	// (see NewFromSlice), which the caller may reuse.
+	shared   bool
+	borrowed bool
+	// growIncrement, if positive, is the number of bytes by which data grows
+	// when it runs out of capacity, instead of doubling.
+	growIncrement int
+	// spills is true if the buffer moves to disk (see SpillToDisk)
+	// when data would grow past spillAbove bytes.
+	spills     bool
+	spillAbove int64
+	// memFallback is true if the buffer moves to RAM when the disk is full,
+	// and degraded is true once it did (see WithSpillFallbackToMemory), or
+	// once it stayed in RAM for lack of disk space (see DiskFullStayInRAM).
+	memFallback bool
+	degraded    bool
+	// minFreeBytes is the free space to keep on the disk when spilling;
+	// diskFullPolicy is what to do if it can't (see WithMinFreeBytes).
+	minFreeBytes   int64
+	diskFullPolicy DiskFullPolicy
+	altTempDirs    []string
+	// budget, if not nil, is the budget the RAM backing
+	// counts against (see WithBudget).
+	budget *Budget
+	// maxSize, if positive, is the cap of the size of the buffer
+	// (see WithMaxSize).
+	maxSize int64
+	// dropReadChunks is true if the chunks of the temp file are removed
+	// once read (see WithDropReadChunks).
+	dropReadChunks bool
+	// finalize is true if the buffer removes itself when it's
+	// garbage collected (see WithFinalizer).
+	finalize bool
+
+	// blockSize, if positive, is the size of the blocks in which the
+	// file is written (see WithBlockSize); wbuf holds the bytes written
+	// since the last whole block, at the offset wbufOff of the file.
+	blockSize int
+	wbuf      []byte
+	wbufOff   int64
+
+	// mirror, if not nil, is the temp file that mirrors the RAM backing
+	// (see NewMirrored); mirrorErr is the error that degraded it.
+	mirror    File
+	mirrorErr error
+	// teePath is the path that the mirror of a tee buffer is renamed to
+	// by Commit (see NewTee).
+	teePath string
+	// persisted is true once the temp file has been renamed by Persist.
+	persisted bool
+	// mmapReads is true if the temp file is mapped in read mode
+	// (see WithMmapReads); mapped is the mapping.
+	mmapReads bool
+	mapped    []byte
+
+	// dirty is true if the temp file (or the mirror) was modified
+	// since it was last fsynced (see Sync).
+	dirty bool
+
+	// fileSlots is the number of slots of the limit of SetMaxOpenFiles
+	// held by the open files of the buffer; noFileWait is true if taking
+	// one fails instead of waiting (see WithoutOpenFileWait).
+	fileSlots  int
+	noFileWait bool
+
+	// toDisk is true for disk-backed buffers, even before the
+	// backing file has been created (see WithLazyFile).
+	toDisk      bool
+	lazy        bool
+	durableDir  bool
+	lenientRead bool
+	// tempDir is the directory of the temp file;
+	// if empty, it's the default temp directory.
+	// prefix and suffix are the beginning (see WithFilePrefix) and the
+	// extension (see WithSuffix) of its name, and fileMode, if not zero,
+	// its permissions (see WithFileMode).
+	tempDir  string
+	prefix   string
+	suffix   string
+	fileMode os.FileMode
+
+	// reading is true once PrepareForReading has been called,
+	// until the next write.
+	reading bool
+	// roff is the read offset: the number of bytes read
+	// since the last PrepareForReading.
+	roff int64
+
+	// sink, if not nil, receives all the writes (see NewSink).
+	sink io.Writer
+
+	// length is the logical length: the number of bytes written to the
+	// buffer by the caller, whatever the backing (before the transforms,
+	// for transformed files). It's atomic so that Size can be called
+	// while another goroutine writes.
+	length atomic.Int64
+
+	// writeStages and readStages are the pipelines that transform the
+	// contents of the temp file (see WithWritePipeline); pw and pr are the
+	// current write and read pipelines.
+	writeStages []func(io.Writer) io.WriteCloser
+	readStages  []func(io.Reader) io.Reader
+	pw          io.WriteCloser
+	pr          io.Reader
+	// codec identifies the pipeline in the header of transformed files;
+	// hasHeader is true once the header has been written to the file.
+	codec     byte
+	hasHeader bool
+
+	// readBufferSize, if positive, is the size of br, the read-ahead
+	// buffer of the file in read mode (see WithReadBufferSize).
+	readBufferSize int
+	br             *bufio.Reader
+
+	// limiter, if not nil, paces the writes to the file, waiting
+	// with limiterCtx (see WithWriteLimiterContext).
+	limiter    WriteLimiter
+	limiterCtx context.Context
+	// ctx, if not nil, is the context the buffer is bound to
+	// (see WithContext).
+	ctx context.Context
+
+	// readHash, if not nil, hashes the bytes returned by Read
+	// (see WithReadHash).
+	readHash hash.Hash
+	// writeHash, if not nil, hashes the bytes written, with a hash
+	// returned by newHash (see WithHash).
+	writeHash hash.Hash
+	newHash   func() hash.Hash
+
+	// optErr is the error of an option that is invalid
+	// (e.g. the key of WithEncryption); NewBuffer returns it.
+	optErr error
+
+	// failed is the error of creating a failed buffer
+	// (see SetErrorHandler).
+	failed error
+
+	// strictLifecycle is true if the buffer can't be written after
+	// PrepareForReading (see WithStrictLifecycle).
+	strictLifecycle bool
+
+	// removed is true once Remove has been called;
+	// closed is true once Close has been called;
+	// writeClosed is true once CloseWrite has been called.
+	removed     bool
+	closed      bool
+	writeClosed bool
+
+	// done is closed when the writer is done with the buffer,
+	// to stop the tail readers (see TailReader); it's created lazily.
+	doneMu           sync.Mutex
+	done             chan struct{}
+	doneClosed       bool
+	tailPollInterval time.Duration
+
+	// statsHook, if not nil, is called after the disk operations
+	// (see WithStatsHook).
+	statsHook          func(StatsEvent)
+	slowWriteThreshold time.Duration
+
+	// written, readCount and spillCount are the counters returned by
+	// Stats; progress, if not nil, is called when they move
+	// (see WithProgress).
+	written    atomic.Int64
+	readCount  atomic.Int64
+	spillCount atomic.Int64
+	progress   func(written, read int64)
+
+	// recorded is true once the size of the buffer
+	// has been recorded in the size histogram.
+	recorded bool
+	// registered is true while the buffer is tracked
+	// by the registry (see EnableRegistry); counted is true while it's
+	// counted as live (see SetMaxLiveBuffers).
+	registered bool
+	counted    bool
 }
 
+// CommonInterface is the method set shared by Buffer and SafeBuffer.
+// It's kept for compatibility: new code should accept the smaller
+// interfaces it needs, like ReadWriteBuffer, Remover and Sizer.
 type CommonInterface interface {
-	Write(p []byte) (n int, err error)
-	WriteString(s string) (n int, err error)
-	Read(p []byte) (n int, err error)
+	io.Writer
+	io.StringWriter
+	io.Reader
 
+	// Deprecated: use Size, which doesn't overflow on 32-bit platforms.
 	Len() int
-	Close() error
+	io.Closer
 
+	// Deprecated: use Size.
 	LenInt64() int64
-	Remove() error
+	Remover
+
+	Sizer
 }
 
 // Write appends the contents of p to the buffer, growing the buffer as
-// needed. The return value n is the length of p; err is always nil. If the
-// buffer becomes too large, Write will panic with ErrTooLarge.
+// needed. The return value n is the length of p, unless writing to the
+// backing fails, in which case n is the number of bytes written before
+// the failure, and err is the error. If a RAM-backed buffer becomes too
+// large, Write will panic with bytes.ErrTooLarge.
 func (b *Buffer) Write(p []byte) (n int, err error) {
+	if err := b.checkOpen(); err != nil {
+		return 0, err
+	}
+	if err := b.checkContext(); err != nil {
+		return 0, err
+	}
+	if b.writeClosed {
+		return 0, ErrWriteClosed
+	}
+	if !b.fitsMaxSize(int64(len(p))) {
+		return b.writeUpToMaxSize(p, "")
+	}
+	if err := b.resumeWriting(); err != nil {
+		return 0, err
+	}
+	if b.sink != nil {
+		n, err = b.sink.Write(p)
+		b.addLength(int64(n))
+		b.hashWritten(p, "", n)
+		b.countWritten(int64(n))
+		return n, err
+	}
+	if err := b.ensureFile(); err != nil {
+		return 0, err
+	}
+	if b.file != nil {
+		if b.limiter != nil || b.ctx != nil {
+			n, err = b.writeLimited(p, "", b.writeToFile)
+		} else {
+			n, err = b.writeToFile(p, "")
+		}
+		if err != nil && b.degradeToMemory(err) {
+			m, err := b.writeMem(p[n:], "")
+			return n + m, err
+		}
+		if err != nil {
+			b.checkContext()
+		}
+		return n, err
+	}
+	return b.writeMem(p, "")
+}
+
+// WriteString appends the contents of s to the buffer, growing the buffer as
+// needed. The return value n is the length of s, unless writing to the
+// backing fails (see Write). If a RAM-backed buffer becomes too large,
+// WriteString will panic with bytes.ErrTooLarge.
+func (b *Buffer) WriteString(s string) (n int, err error) {
+	if err := b.checkOpen(); err != nil {
+		return 0, err
+	}
+	if err := b.checkContext(); err != nil {
+		return 0, err
+	}
+	if b.writeClosed {
+		return 0, ErrWriteClosed
+	}
+	if !b.fitsMaxSize(int64(len(s))) {
+		return b.writeUpToMaxSize(nil, s)
+	}
+	if err := b.resumeWriting(); err != nil {
+		return 0, err
+	}
+	if b.sink != nil {
+		n, err = io.WriteString(b.sink, s)
+		b.addLength(int64(n))
+		b.hashWritten(nil, s, n)
+		b.countWritten(int64(n))
+		return n, err
+	}
+	if err := b.ensureFile(); err != nil {
+		return 0, err
+	}
+	if b.file != nil {
+		if b.limiter != nil || b.ctx != nil {
+			n, err = b.writeLimited(nil, s, b.writeToFile)
+		} else {
+			n, err = b.writeToFile(nil, s)
+		}
+		if err != nil && b.degradeToMemory(err) {
+			m, err := b.writeMem(nil, s[n:])
+			return n + m, err
+		}
+		if err != nil {
+			b.checkContext()
+		}
+		return n, err
+	}
+	return b.writeMem(nil, s)
+}
+
+// Printf formats according to format, like fmt.Printf, and appends the
+// result to the buffer with a single Write (unlike fmt.Fprintf, which may
+// issue many small writes: one syscall each, for disk-backed buffers).
+// It returns the number of bytes written, and the error of the Write.
+func (b *Buffer) Printf(format string, args ...interface{}) (int, error) {
+	scratch := printfPool.Get().(*bytes.Buffer)
+	scratch.Reset()
+	fmt.Fprintf(scratch, format, args...)
+	n, err := b.Write(scratch.Bytes())
+	if scratch.Cap() <= maxPrintfScratch {
+		printfPool.Put(scratch)
+	}
+	return n, err
+}
+
+// printfPool holds the scratch buffers of Printf.
+var printfPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// maxPrintfScratch is the capacity above which the scratch buffers
+// of Printf are not kept in the pool.
+const maxPrintfScratch = 64 * 1024
+
+// writeToFile appends p, or s if p is nil, to the file, and counts the
+// bytes in the logical length.
+func (b *Buffer) writeToFile(p []byte, s string) (n int, err error) {
+	if b.statsHook != nil {
+		start := time.Now()
+		defer func() {
+			b.emitStats(StatsWrite, start, int64(n), err)
+		}()
+	}
+	n, err = b.writeBacking(p, s)
+	b.addLength(int64(n))
+	b.hashWritten(p, s, n)
+	b.countWritten(int64(n))
+	return n, err
+}
+
+// writeBacking appends p, or s if p is nil, to the file, through the write
+// pipeline if any, without counting the bytes: SpillToDisk uses it for the
+// bytes already counted when they were written to RAM.
+func (b *Buffer) writeBacking(p []byte, s string) (int, error) {
+	b.dirty = true
+	switch {
+	case b.transformed():
+		return b.writeTransformed(p, s)
+	case p != nil:
+		return b.writeFile(p)
+	default:
+		return b.writeFileString(s)
+	}
+}
+
+// writeMem appends p, or s if p is nil, to a RAM-backed buffer.
+func (b *Buffer) writeMem(p []byte, s string) (int, error) {
+	n := len(p) + len(s)
+	if (b.spills && int64(len(b.data))+int64(n) > b.spillAbove) || b.overBudget(int64(n)) {
+		if err := b.SpillToDisk(); err != nil {
+			return 0, err
+		}
+		if b.toDisk {
+			if p != nil {
+				return b.Write(p)
+			}
+			return b.WriteString(s)
+		}
+		// Staying in RAM (see DiskFullStayInRAM).
+	}
+	b.growMem(n)
+	if p != nil {
+		b.data = append(b.data, p...)
+	} else {
+		b.data = append(b.data, s...)
+	}
+	b.addLength(int64(n))
+	b.hashWritten(p, s, n)
+	b.countWritten(int64(n))
+	if err := b.writeMirror(p, s); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// growMem makes room for n more bytes in the RAM backing.
+func (b *Buffer) growMem(n int) {
+	if cap(b.data)-len(b.data) >= n {
+		return
+	}
+	need := len(b.data) + n
+	if need < 0 {
+		panic(bytes.ErrTooLarge)
+	}
+	var c int
+	switch {
+	case len(b.data) == 0:
+		// Most buffers are written only once: allocate exactly what's needed.
+		c = need
+	case b.growIncrement > 0:
+		c = len(b.data) + b.growIncrement
+		if c < need {
+			c = need
+		}
+	default:
+		c = 2 * cap(b.data)
+		if c < need {
+			c = need
+		}
+	}
+	data := makeSlice(len(b.data), c)
+	copy(data, b.data)
+	b.data = data
+	b.borrowed = false
+}
+
+// makeSlice allocates a slice of length l and capacity c;
+// if the allocation fails, it panics with bytes.ErrTooLarge.
+func makeSlice(l, c int) []byte {
+	defer func() {
+		if recover() != nil {
+			panic(bytes.ErrTooLarge)
+		}
+	}()
+	return make([]byte, l, c)
+}
+
+// resumeWriting ends the read phase started by PrepareForReading, if any,
+// so that the next write is appended after the existing contents
+// instead of overwriting them at the read offset.
+func (b *Buffer) resumeWriting() error {
+	if !b.reading {
+		return nil
+	}
+	if b.strictLifecycle {
+		return ErrWriteAfterRead
+	}
+	var s io.Seeker
+	if b.sink != nil {
+		s, _ = b.sink.(io.Seeker)
+	} else if b.file != nil {
+		s = b.file
+	}
+	if s != nil {
+		if _, err := s.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	b.reading = false
+	b.pr = nil
+	b.br = nil
+	return b.unmapFile()
+}
+
+// writeFile writes all of p to the file, through the write buffer
+// if enabled (see WithBlockSize).
+func (b *Buffer) writeFile(p []byte) (int, error) {
+	if b.blockSize > 0 {
+		return b.writeBlocks(p, "")
+	}
+	return b.writeFileDirect(p)
+}
+
+// writeFileDirect writes all of p to the file (see writeFull).
+func (b *Buffer) writeFileDirect(p []byte) (int, error) {
+	return writeFull(b.file, p)
+}
+
+// writeFull writes all of p to f: a short write
+// without an error, or interrupted by a signal (EINTR),
+// is retried with the rest of p.
+func writeFull(f File, p []byte) (n int, err error) {
+	for n < len(p) {
+		m, err := f.Write(p[n:])
+		n += m
+		if isEINTR(err) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+	return n, nil
+}
+
+// writeFileString is like writeFile, for strings.
+func (b *Buffer) writeFileString(s string) (int, error) {
+	if b.blockSize > 0 {
+		return b.writeBlocks(nil, s)
+	}
+	return writeFullString(b.file, s)
+}
+
+// writeFullString is like writeFull, for strings.
+func writeFullString(f File, s string) (n int, err error) {
+	for n < len(s) {
+		m, err := f.WriteString(s[n:])
+		n += m
+		if isEINTR(err) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+	return n, nil
+}
+
+// Read reads the next len(p) bytes from the buffer or until the buffer
+// is drained. The return value n is the number of bytes read. If the
+// buffer has no data to return, err is io.EOF; otherwise it is nil.
+// A zero-length read returns (0, nil), whatever the backing and the read
+// mode, even at the end of the contents (unless the buffer was removed).
+//
+// Reading doesn't discard the contents of the buffer: after
+// PrepareForReading, the buffer can be read again from the beginning.
+// Reading a buffer that has contents but isn't in read mode (i.e.
+// PrepareForReading wasn't called after the last write) is almost always
+// a mistake, so Read returns ErrNotPrepared, unless the buffer was
+// created with WithLenientRead.
+func (b *Buffer) Read(p []byte) (n int, err error) {
+	if err := b.checkContext(); err != nil {
+		return 0, err
+	}
+	n, err = b.read(p)
+	if b.readHash != nil && n > 0 {
+		b.readHash.Write(p[:n])
+	}
+	b.countRead(int64(n))
+	return n, err
+}
+
+// ReadFull reads exactly len(p) bytes from the read offset into p, like
+// io.ReadFull: it returns io.EOF if no bytes were read, and
+// io.ErrUnexpectedEOF if the contents end after some of them.
+func (b *Buffer) ReadFull(p []byte) (int, error) {
+	return io.ReadFull(b, p)
+}
+
+func (b *Buffer) read(p []byte) (n int, err error) {
+	if err := b.checkOpen(); err != nil {
+		return 0, err
+	}
+	if len(p) == 0 {
+		// Don't depend on the backing, nor on the read mode.
+		return 0, nil
+	}
+	if _, ok := b.sink.(io.ReadSeeker); b.sink != nil && !ok {
+		return 0, ErrUnsupported
+	}
+	if !b.reading && !b.lenientRead && b.hasContents() {
+		return 0, ErrNotPrepared
+	}
+	if b.sink != nil {
+		n, err = b.sink.(io.ReadSeeker).Read(p)
+		b.roff += int64(n)
+		return n, err
+	}
+	if b.pr != nil {
+		n, err = b.pr.Read(p)
+		b.roff += int64(n)
+		return n, err
+	}
+	if b.mapped != nil {
+		return b.readMapped(p)
+	}
+	if b.br != nil {
+		n, err = b.br.Read(p)
+		b.roff += int64(n)
+		b.dropChunksBeforeRead()
+		return n, err
+	}
+	if b.file != nil {
+		n, err = b.readFile(p)
+		b.roff += int64(n)
+		b.dropChunksBeforeRead()
+		return n, err
+	}
+	if b.toDisk {
+		// Lazy file not created yet: nothing was ever written.
+		return 0, io.EOF
+	}
+	if b.roff >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	n = copy(p, b.data[b.roff:])
+	b.roff += int64(n)
+	return n, nil
+}
+
+// WriteTo writes the contents of the buffer from the read offset to w,
+// until the buffer is drained or writing fails; it implements io.WriterTo,
+// so that io.Copy uses it. The return value n is the number of bytes
+// written to w, and the read offset is moved by exactly n bytes, even if
+// w fails midway: e.g. after a dropped connection, the write can be
+// resumed by calling WriteTo again, with another writer.
+//
+// If w is an io.ReaderFrom (e.g. a TCP connection, or an *os.File), the
+// temp file of a disk-backed buffer is handed to it, so that the kernel can
+// copy it where supported (sendfile, copy_file_range), without going
+// through userspace.
+func (b *Buffer) WriteTo(w io.Writer) (n int64, err error) {
+	if err := b.checkOpen(); err != nil {
+		return 0, err
+	}
+	if err := b.checkContext(); err != nil {
+		return 0, err
+	}
+	if rest := b.contiguousRest(); rest != nil {
+		// Write the rest in one go, without copying it.
+		m, err := w.Write(rest)
+		if b.readHash != nil {
+			b.readHash.Write(rest[:m])
+		}
+		b.countRead(int64(m))
+		b.roff += int64(m)
+		if err == nil && m < len(rest) {
+			err = io.ErrShortWrite
+		}
+		return int64(m), err
+	}
+
+	if rf, ok := w.(io.ReaderFrom); ok && b.canHandOverFile() {
+		return b.writeFileTo(rf)
+	}
+
+	chunk := make([]byte, copyChunkSize(b.Remaining()))
+	for {
+		if err := b.checkContext(); err != nil {
+			return n, err
+		}
+		m, rerr := b.read(chunk)
+		if m > 0 {
+			k, werr := w.Write(chunk[:m])
+			if b.readHash != nil {
+				b.readHash.Write(chunk[:k])
+			}
+			b.countRead(int64(k))
+			n += int64(k)
+			if k < m {
+				// Give back what w didn't take.
+				if err := b.setReadOffset(b.roff - int64(m-k)); err != nil {
+					return n, err
+				}
+				if werr == nil {
+					werr = io.ErrShortWrite
+				}
+				return n, werr
+			}
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// contiguousRest returns the rest of the contents from the read offset, if
+// it's in memory (in the RAM backing, or in the mapping of the temp file,
+// see WithMmapReads), not empty, and can be read; otherwise it returns nil.
+func (b *Buffer) contiguousRest() []byte {
+	switch {
+	case b.mapped != nil && b.roff < int64(len(b.mapped)):
+		return b.mapped[b.roff:]
+	case b.file == nil && !b.toDisk && b.sink == nil &&
+		(b.reading || b.lenientRead) && b.roff < int64(len(b.data)):
+		return b.data[b.roff:]
+	}
+	return nil
+}
+
+// canHandOverFile reports whether the rest of the contents can be read
+// straight from the temp file, bypassing Read: the buffer is in read mode,
+// and its temp file is an OS file, read without any transform, read-ahead
+// nor hash.
+func (b *Buffer) canHandOverFile() bool {
+	if b.removed || !b.reading || b.file == nil || b.transformed() || b.br != nil || b.mapped != nil || b.readHash != nil || b.ctx != nil {
+		return false
+	}
+	_, ok := b.file.(*os.File)
+	return ok
+}
+
+// writeFileTo hands the rest of the temp file over to rf (see WriteTo).
+func (b *Buffer) writeFileTo(rf io.ReaderFrom) (int64, error) {
+	n, err := rf.ReadFrom(io.LimitReader(b.file, b.Remaining()))
+	// rf may have read more than it took: set the offset of the file
+	// after exactly what it took.
+	if serr := b.setReadOffset(b.roff + n); serr != nil && err == nil {
+		err = serr
+	}
+	b.countRead(n)
+	return n, err
+}
+
+// ReadFrom appends the contents of r, until its io.EOF, to the buffer; it
+// implements io.ReaderFrom, so that io.Copy uses it. The return value n is
+// the number of bytes appended, and err the error of r (but io.EOF),
+// or of the backing.
+//
+// RAM-backed buffers read r straight into their backing. Disk-backed
+// buffers hand r over to their temp file, if it's an OS file written
+// without any transform (so that the kernel can copy r where supported,
+// e.g. from another file); otherwise they write in chunks, through a
+// pooled copy buffer.
+func (b *Buffer) ReadFrom(r io.Reader) (n int64, err error) {
+	if err := b.checkOpen(); err != nil {
+		return 0, err
+	}
+	if b.writeClosed {
+		return 0, ErrWriteClosed
+	}
+	if err := b.resumeWriting(); err != nil {
+		return 0, err
+	}
+	if b.sink == nil && !b.toDisk && !b.spills && b.mirror == nil && b.budget == nil && b.maxSize <= 0 && b.writeHash == nil {
+		return b.readMemFrom(r)
+	}
+	if err := b.ensureFile(); err != nil {
+		return 0, err
+	}
+	if f, ok := b.file.(*os.File); ok && !b.transformed() && b.blockSize <= 0 &&
+		b.limiter == nil && b.statsHook == nil && !b.memFallback && b.ctx == nil && b.maxSize <= 0 && b.writeHash == nil {
+		b.dirty = true
+		n, err = f.ReadFrom(r)
+		b.addLength(n)
+		b.countWritten(n)
+		return n, err
+	}
+
+	chunk := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(chunk)
+	for {
+		m, rerr := r.Read(*chunk)
+		if m > 0 {
+			k, werr := b.Write((*chunk)[:m])
+			n += int64(k)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// minReadFrom is the minimum spare capacity of the RAM backing
+// that readMemFrom reads into.
+const minReadFrom = 512
+
+// readMemFrom is ReadFrom for RAM-backed buffers.
+func (b *Buffer) readMemFrom(r io.Reader) (n int64, err error) {
+	for {
+		if err := b.checkContext(); err != nil {
+			return n, err
+		}
+		if cap(b.data)-len(b.data) < minReadFrom {
+			b.growMem(minReadFrom)
+		}
+		size := len(b.data)
+		m, rerr := r.Read(b.data[size:cap(b.data)])
+		if m < 0 {
+			panic("ramdiskbuffer: reader returned a negative count")
+		}
+		b.data = b.data[:size+m]
+		b.addLength(int64(m))
+		b.countWritten(int64(m))
+		n += int64(m)
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// copyBufPool holds the copy buffers of ReadFrom.
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		chunk := make([]byte, smallCopy)
+		return &chunk
+	},
+}
+
+// The bounds of the chunks of the copy loops (see copyChunkSize).
+const (
+	minCopyChunk = 512
+	smallCopy    = 32 * 1024
+	maxCopyChunk = 1024 * 1024
+)
+
+// copyChunkSize returns the size of the chunks in which to copy n bytes:
+// small copies are done in one chunk, and large ones in chunks of about
+// 1/16 of n, up to maxCopyChunk, so that very large buffers are copied
+// with fewer syscalls than with the usual 32KiB.
+func copyChunkSize(n int64) int {
+	switch {
+	case n < minCopyChunk:
+		// Room to see the end of the contents, even if n is off.
+		return minCopyChunk
+	case n <= smallCopy:
+		return int(n)
+	case n/16 < smallCopy:
+		return smallCopy
+	case n/16 > maxCopyChunk:
+		return maxCopyChunk
+	}
+	return int(n / 16)
+}
+
+// setReadOffset moves the read offset of a buffer in read mode to off.
+func (b *Buffer) setReadOffset(off int64) error {
+	switch {
+	case b.sink != nil:
+		if _, err := b.sink.(io.Seeker).Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+	case b.file != nil && b.transformed():
+		// The transformed stream can't be seeked: read up to off from the
+		// beginning, without resetting the read hash.
+		h := b.readHash
+		b.readHash = nil
+		err := b.prepareForReading(false)
+		b.readHash = h
+		if err != nil {
+			return err
+		}
+		if _, err := io.CopyN(io.Discard, readerFunc(b.read), off); err != nil {
+			return err
+		}
+	case b.file != nil:
+		if _, err := b.file.Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+		b.newReadBuffer()
+	}
+	b.roff = off
+	return nil
+}
+
+// newReadBuffer sets up the read-ahead buffer on the file, from its current
+// offset, if the buffer has a read buffer size; it reports whether it did.
+func (b *Buffer) newReadBuffer() bool {
+	if b.readBufferSize <= 0 || b.file == nil || b.mapped != nil {
+		b.br = nil
+		return false
+	}
+	if b.br == nil {
+		b.br = bufio.NewReaderSize(readerFunc(b.readFile), b.readBufferSize)
+	} else {
+		b.br.Reset(readerFunc(b.readFile))
+	}
+	return true
+}
+
+// ReadByte reads and returns the next byte from the buffer, like Read.
+// If no byte is available, it returns an error (io.EOF at the end).
+func (b *Buffer) ReadByte() (byte, error) {
+	var c [1]byte
+	n, err := b.Read(c[:])
+	if n == 1 {
+		return c[0], nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	return 0, err
+}
+
+// ReadBytes reads until the first occurrence of delim, like
+// bufio.Reader.ReadBytes: it returns the bytes read, including delim,
+// and an error (io.EOF at the end) if and only if they don't end in delim.
+func (b *Buffer) ReadBytes(delim byte) ([]byte, error) {
+	if b.br != nil && b.pr == nil && !b.removed {
+		line, err := b.br.ReadBytes(delim)
+		b.roff += int64(len(line))
+		if b.readHash != nil {
+			b.readHash.Write(line)
+		}
+		b.countRead(int64(len(line)))
+		return line, err
+	}
+	var line []byte
+	for {
+		c, err := b.ReadByte()
+		if err != nil {
+			return line, err
+		}
+		line = append(line, c)
+		if c == delim {
+			return line, nil
+		}
+	}
+}
+
+// hasContents reports whether anything was written to the buffer,
+// without querying the backing.
+func (b *Buffer) hasContents() bool {
+	return b.length.Load() > 0
+}
+
+// readFile reads from the file, retrying the reads
+// interrupted by a signal (EINTR) before reading anything.
+func (b *Buffer) readFile(p []byte) (int, error) {
+	for {
+		n, err := b.file.Read(p)
+		if n == 0 && isEINTR(err) {
+			continue
+		}
+		return n, err
+	}
+}
+
+// readAt reads len(p) bytes of the contents starting at offset off,
+// like io.ReaderAt, without affecting the read offset.
+func (b *Buffer) readAt(p []byte, off int64) (int, error) {
+	if b.removed {
+		return 0, ErrRemoved
+	}
+	if b.sink != nil || (b.file != nil && b.transformed()) {
+		return 0, ErrUnsupported
+	}
+	if b.mapped != nil {
+		return b.readMappedAt(p, off)
+	}
+	if b.file != nil {
+		if err := b.flushWrites(); err != nil {
+			return 0, err
+		}
+		for {
+			n, err := b.file.ReadAt(p, off)
+			if n == 0 && isEINTR(err) {
+				continue
+			}
+			return n, err
+		}
+	}
+	if b.toDisk || off >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// isEINTR reports whether err is an interrupted system call.
+func isEINTR(err error) bool {
+	return err != nil && errors.Is(err, syscall.EINTR)
+}
+
+// ReadProgress returns the read offset: the number of bytes read
+// since the last PrepareForReading, or since the offset set by Seek.
+func (b *Buffer) ReadProgress() int64 {
+	return b.roff
+}
+
+// Remaining returns the number of bytes left to read
+// from the current read offset.
+func (b *Buffer) Remaining() int64 {
+	remaining := b.Size() - b.roff
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// IsDrained reports whether all the contents of the buffer have been read,
+// i.e. whether the read offset is at Size.
+func (b *Buffer) IsDrained() bool {
+	return b.roff >= b.Size()
+}
+
+// Seek sets the read offset for the next Read, like io.Seeker.
+//
+// If the buffer is still in write mode, the first Seek ends the write
+// phase: it finalizes the buffer (see PrepareForReading) before moving
+// the read offset, so that Seek(0, io.SeekStart) can be used as
+// "rewind to read". A later write starts a new write phase, as usual.
+//
+// The offset can't be past Size: if whence is invalid, or the resulting
+// offset is negative or past Size, ErrInvalidSize is returned.
+// Seeking a transformed buffer (see WithWritePipeline) backward reads it
+// again from the beginning, up to the offset.
+func (b *Buffer) Seek(offset int64, whence int) (int64, error) {
+	if b.removed {
+		return 0, ErrRemoved
+	}
+	if !b.reading {
+		if err := b.PrepareForReading(); err != nil {
+			return 0, err
+		}
+	}
+	var off int64
+	switch whence {
+	case io.SeekStart:
+		off = offset
+	case io.SeekCurrent:
+		off = b.roff + offset
+	case io.SeekEnd:
+		off = b.Size() + offset
+	default:
+		return 0, ErrInvalidSize
+	}
+	if off < 0 || off > b.Size() {
+		return 0, ErrInvalidSize
+	}
+	if off == b.roff {
+		return off, nil
+	}
+	if b.file != nil && b.transformed() && off > b.roff {
+		// Forward: skip the bytes in between.
+		if _, err := io.CopyN(io.Discard, readerFunc(b.read), off-b.roff); err != nil {
+			return b.roff, err
+		}
+		return off, nil
+	}
+	if err := b.setReadOffset(off); err != nil {
+		return 0, err
+	}
+	return off, nil
+}
+
+// ReadRangeFrom appends the n bytes of r starting at offset off
+// (i.e. the range [off, off+n)) to the buffer.
+// The return value is the number of bytes copied; if r has fewer
+// than n bytes past off, the error is io.ErrUnexpectedEOF.
+// If off or n is negative, ErrInvalidSize is returned.
+func (b *Buffer) ReadRangeFrom(r io.ReaderAt, off, n int64) (int64, error) {
+	if off < 0 || n < 0 {
+		return 0, ErrInvalidSize
+	}
+	copied, err := io.CopyN(b, io.NewSectionReader(r, off, n), n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return copied, err
+}
+
+// LimitedWriter returns a writer that appends to the buffer at most max bytes:
+// a write that goes past max writes what fits, and returns ErrTooLarge.
+// It's meant for buffering up to max bytes of an untrusted stream, e.g. via
+// io.Copy; the progress of the copy can be followed via b.Size.
+func (b *Buffer) LimitedWriter(max int64) io.Writer {
+	return &limitedWriter{b: b, left: max}
+}
+
+type limitedWriter struct {
+	b    *Buffer
+	left int64
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) <= w.left {
+		n, err := w.b.Write(p)
+		w.left -= int64(n)
+		return n, err
+	}
+	if w.left < 0 {
+		w.left = 0
+	}
+	n, err := w.b.Write(p[:w.left])
+	w.left -= int64(n)
+	if err == nil {
+		err = ErrTooLarge
+	}
+	return n, err
+}
+
+func (w *limitedWriter) WriteString(s string) (int, error) {
+	if int64(len(s)) <= w.left {
+		n, err := w.b.WriteString(s)
+		w.left -= int64(n)
+		return n, err
+	}
+	if w.left < 0 {
+		w.left = 0
+	}
+	n, err := w.b.WriteString(s[:w.left])
+	w.left -= int64(n)
+	if err == nil {
+		err = ErrTooLarge
+	}
+	return n, err
+}
+
+// New returns a new buffer, disk-backed if toDisk is true, RAM-backed
+// otherwise. It panics if the buffer can't be created (e.g. its temp file),
+// unless an error handler is set (see SetErrorHandler); see NewBuffer.
+func New(toDisk bool, opts ...Option) *Buffer {
+	return mustBuffer(NewBuffer(toDisk, opts...))
+}
+
+// NewBuffer is like New, but it returns an error instead of panicking
+// if the buffer can't be created: e.g. if the temp file can't be created
+// (unless WithLazyFile is used), because of the limits of
+// SetMaxLiveBuffers and SetMaxOpenFiles, or if an option is invalid.
+func NewBuffer(toDisk bool, opts ...Option) (*Buffer, error) {
+	b := &Buffer{
+		fs:     osFS{},
+		toDisk: toDisk,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.optErr != nil {
+		return nil, b.optErr
+	}
+	if err := b.acquireLiveSlot(); err != nil {
+		return nil, err
+	}
+	if toDisk && !b.lazy {
+		if err := b.ensureFile(); err != nil {
+			b.releaseLiveSlot()
+			return nil, err
+		}
+	}
+	b.register()
+	b.setFinalizer()
+	return b, nil
+}
+
+// NewSink returns a buffer that sends all the writes straight to w,
+// instead of keeping them in RAM or in a temp file; the length of the
+// buffer is the number of bytes written to w.
+//
+// Reading is supported only if w is an io.ReadSeeker (e.g. an *os.File):
+// PrepareForReading returns ErrNotSeekable otherwise, and Read returns
+// ErrUnsupported. Close closes w if it's an io.Closer; Remove doesn't
+// do anything to w. Like New, it panics if the limit of SetMaxLiveBuffers
+// is reached; see NewSinkBuffer.
+func NewSink(w io.Writer) *Buffer {
+	return mustBuffer(NewSinkBuffer(w))
+}
+
+// NewSinkBuffer is like NewSink, but it returns an error instead of
+// panicking if the limit of SetMaxLiveBuffers is reached.
+func NewSinkBuffer(w io.Writer) (*Buffer, error) {
+	b := &Buffer{
+		fs:   osFS{},
+		sink: w,
+	}
+	if err := b.acquireLiveSlot(); err != nil {
+		return nil, err
+	}
+	b.register()
+	return b, nil
+}
+
+// NewFromSlice returns a RAM-backed buffer, like New, that writes into
+// scratch (from its beginning) as long as the contents fit in its capacity,
+// without allocating: e.g. a scratch arena can be reused across requests,
+// so that the common small payloads don't allocate. When the contents would
+// outgrow cap(scratch), the buffer moves to disk (see SpillToDisk) if
+// toDiskOnOverflow is true, and grows normally otherwise, leaving scratch
+// untouched from then on. The snapshots of the buffer (see Snapshot) don't
+// share scratch: they're copies, so that it can be reused while they're
+// alive.
+func NewFromSlice(scratch []byte, toDiskOnOverflow bool, opts ...Option) *Buffer {
+	b := New(false, opts...)
+	b.data = scratch[:0]
+	b.borrowed = true
+	if toDiskOnOverflow {
+		b.spills = true
+		b.spillAbove = int64(cap(scratch))
+	}
+	return b
+}
+
+// NewSpill returns a RAM-backed buffer, like New, that moves to disk (see
+// SpillToDisk) when its contents would grow past maxRAMBytes: the contents
+// written so far are copied to a new temp file, and the writes continue
+// there. Until then, no temp file is created. With a maxRAMBytes of 0 or
+// less, the buffer moves to disk on the first write.
+func NewSpill(maxRAMBytes int64, opts ...Option) *Buffer {
+	if maxRAMBytes < 0 {
+		maxRAMBytes = 0
+	}
+	b := New(false, opts...)
+	b.spills = true
+	b.spillAbove = maxRAMBytes
+	return b
+}
+
+// ensureFile creates the temp file of a disk-backed buffer
+// if it doesn't exist yet.
+func (b *Buffer) ensureFile() error {
+	if !b.toDisk || b.file != nil {
+		return nil
+	}
+	file, err := b.createFile()
+	if err != nil {
+		return err
+	}
+	b.file = file
+	b.updateRegistry()
+	return nil
+}
+
+// tempPattern returns the pattern of the names of the temp files
+// (see os.CreateTemp).
+func (b *Buffer) tempPattern() string {
+	prefix := b.prefix
+	if prefix == "" {
+		prefix = defaultFilePrefix
+	}
+	if b.suffix == "" {
+		return prefix
+	}
+	return prefix + "-*." + b.suffix
+}
+
+// createFile creates a new temp file for the buffer.
+func (b *Buffer) createFile() (File, error) {
+	if err := b.acquireFileSlot(); err != nil {
+		return nil, err
+	}
+	if file := b.cachedFile(); file != nil {
+		if err := b.setFileMode(file); err != nil {
+			file.Close()
+			b.releaseFileSlot()
+			b.fs.Remove(file.Name())
+			return nil, err
+		}
+		return file, nil
+	}
+	file, err := b.fs.CreateTemp(b.tempDir, b.tempPattern())
+	if err != nil {
+		b.releaseFileSlot()
+		return nil, err
+	}
+	err = b.setFileMode(file)
+	if err == nil && b.durableDir {
+		err = syncParentDir(b.fs, file.Name())
+	}
+	if err != nil {
+		file.Close()
+		b.releaseFileSlot()
+		b.fs.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// setFileMode sets the permissions of the temp file (see WithFileMode),
+// if it's an OS file.
+func (b *Buffer) setFileMode(file File) error {
+	if b.fileMode == 0 {
+		return nil
+	}
+	if f, ok := file.(interface{ Chmod(os.FileMode) error }); ok {
+		return f.Chmod(b.fileMode)
+	}
+	return nil
+}
+
+// File returns the temp file of a disk-backed buffer, if it's an OS file,
+// for the APIs that need one (e.g. to pass its descriptor to a subprocess
+// via os.ProcAttr.Files); it returns false for the other buffers
+// (RAM-backed, sinks, or temp files of another FS).
+// If the temp file doesn't exist yet (see WithLazyFile), it's created.
+//
+// The file is still owned by the buffer: it must not be closed, truncated
+// or removed by the caller. Its offset is the one the buffer writes and
+// reads at: seeking it, or reading from or writing to it, confuses the
+// buffer, unless it's done with ReadAt/WriteAt, or the offset is restored.
+func (b *Buffer) File() (*os.File, bool) {
+	if b.removed || b.sink != nil {
+		return nil, false
+	}
+	if err := b.ensureFile(); err != nil {
+		return nil, false
+	}
+	if err := b.flushWrites(); err != nil {
+		return nil, false
+	}
+	file, ok := b.file.(*os.File)
+	return file, ok
+}
+
+// SpillToDisk moves the contents of a RAM-backed buffer to a new temp file,
+// making it a disk-backed buffer; the read mode and the read offset
+// are preserved. It does nothing for buffers that are not RAM-backed.
+func (d *Buffer) SpillToDisk() error {
+	if d.removed {
+		return ErrRemoved
+	}
+	if err := d.checkContext(); err != nil {
+		return err
+	}
+	if d.toDisk || d.sink != nil {
+		return nil
+	}
+	if d.mirror != nil {
+		return ErrUnsupported
+	}
+	if stay, err := d.checkFreeSpace(d.length.Load()); stay || err != nil {
+		return err
+	}
+	file, err := d.createFile()
+	if err != nil {
+		return err
+	}
+	d.file = file
+	var start time.Time
+	if d.statsHook != nil {
+		start = time.Now()
+	}
+	err = d.spillData()
+	if d.statsHook != nil {
+		d.emitStats(StatsSpill, start, d.length.Load(), err)
+	}
+	if err != nil {
+		d.file = nil
+		file.Close()
+		d.releaseFileSlot()
+		d.fs.Remove(file.Name())
+		return err
+	}
+	// The bytes moved from RAM to disk.
+	size := d.length.Load()
+	atomic.AddInt64(&ramBytes, -size)
+	atomic.AddInt64(&diskBytes, size)
+	d.budget.add(-size)
+	d.spillCount.Add(1)
+	if c := metricsCollector(); c != nil {
+		c.BufferSpilled(size)
+	}
+	d.toDisk = true
+	d.data = nil
+	d.updateRegistry()
+	return nil
+}
+
+// spillData writes the RAM backing to the newly created file.
+func (d *Buffer) spillData() error {
+	// The bytes were counted in the logical length when written to RAM.
+	var err error
+	if d.limiter != nil || d.ctx != nil {
+		_, err = d.writeLimited(d.data, "", d.writeBacking)
+	} else {
+		_, err = d.writeBacking(d.data, "")
+	}
+	if err != nil {
+		return err
+	}
+	if !d.reading {
+		return nil
+	}
+	if err := d.flushWrites(); err != nil {
+		return err
+	}
+	return d.setReadOffset(d.roff)
+}
+
+// Remove removes the temp file of a disk-backed buffer, or releases
+// the RAM backing of a RAM-backed buffer. After Remove, the buffer
+// can't be used anymore: writes and reads return ErrRemoved.
+func (d *Buffer) Remove() error {
+	if d.removed {
+		return nil
+	}
+	d.removed = true
+	d.unmapFile()
+	d.clearFinalizer()
+	d.recordSize()
+	d.deregister()
+	d.signalDone()
+	d.setLength(0)
+	if err := d.removeMirror(); err != nil {
+		return err
+	}
+	if d.sink != nil {
+		return nil
+	}
+	if d.file != nil {
+		d.pw = nil
+		d.pr = nil
+		d.br = nil
+		d.wbuf = nil
+		cached := !d.persisted && d.cacheFile()
+		if !cached {
+			d.file.Close()
+		}
+		d.releaseFileSlot()
+		if cached || d.persisted {
+			return nil
+		}
+		return d.fs.Remove(d.file.Name())
+	}
+	d.data = nil
+	d.roff = 0
+	return nil
+}
+
+// Grow makes room for n more bytes after the current contents of the
+// buffer, so that writing them doesn't need to allocate: for RAM-backed
+// buffers, it grows the backing; for disk-backed buffers, it preallocates
+// the disk space (on linux, via fallocate, without changing the size of the
+// temp file), which fails early if there isn't enough space.
+// For sink and transformed buffers (see WithWritePipeline), whose size
+// on disk isn't known, it does nothing. If n is negative, too large to be
+// allocated, or more than the buffer can take (see WithMaxSize),
+// ErrInvalidSize is returned.
+func (b *Buffer) Grow(n int64) error {
+	if b.removed {
+		return ErrRemoved
+	}
+	if n < 0 || !b.fitsMaxSize(n) {
+		return ErrInvalidSize
+	}
+	if n == 0 || b.sink != nil || b.transformed() {
+		return nil
+	}
+	if !b.toDisk {
+		if int64(int(n)) != n || len(b.data)+int(n) < 0 {
+			return ErrInvalidSize
+		}
+		return b.tryGrowMem(int(n))
+	}
+	if err := b.ensureFile(); err != nil {
+		return err
+	}
+	size := b.Size()
+	if n > math.MaxInt64-size {
+		return ErrInvalidSize
+	}
+	return preallocate(b.file, size, n)
+}
+
+// tryGrowMem is like growMem, but it returns ErrInvalidSize
+// instead of panicking if the RAM backing can't be allocated.
+func (b *Buffer) tryGrowMem(n int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != bytes.ErrTooLarge {
+				panic(r)
+			}
+			err = ErrInvalidSize
+		}
+	}()
+	b.growMem(n)
+	return nil
+}
+
+// DropPrefix discards the first n bytes of the buffer (e.g. the ones already
+// consumed), keeping the rest: e.g. a long-lived buffer used as a sliding
+// window can reclaim the space of what was processed. The read offset is
+// moved back by n bytes (to 0, if it's less than n).
+//
+// For RAM-backed buffers, the rest of the contents is moved to the beginning
+// of the backing, which keeps its capacity; for disk-backed buffers, it's
+// moved to the beginning of the temp file, which is then truncated.
+// If n is negative or greater than Size, ErrInvalidSize is returned.
+// Sink and transformed buffers (see WithWritePipeline) don't support it.
+func (b *Buffer) DropPrefix(n int64) error {
+	if b.removed {
+		return ErrRemoved
+	}
+	if b.sink != nil || b.transformed() || b.mirror != nil || b.writeHash != nil {
+		return ErrUnsupported
+	}
+	size := b.Size()
+	if n < 0 || n > size {
+		return ErrInvalidSize
+	}
+	if n == 0 {
+		return nil
+	}
 	if b.file != nil {
-		return b.file.Write(p)
+		if err := b.unmapFile(); err != nil {
+			return err
+		}
+		if err := b.flushWrites(); err != nil {
+			return err
+		}
+		if err := b.dropFilePrefix(n, size); err != nil {
+			return err
+		}
+	} else {
+		if b.shared {
+			// Don't overwrite the bytes seen by the snapshots.
+			b.data = append([]byte(nil), b.data[n:]...)
+			b.shared = false
+		} else {
+			b.data = b.data[:copy(b.data, b.data[n:])]
+		}
+	}
+	b.setLength(size - n)
+	b.roff -= n
+	if b.roff < 0 {
+		b.roff = 0
+	}
+	if b.file != nil && b.reading {
+		if _, err := b.file.Seek(b.roff, io.SeekStart); err != nil {
+			return err
+		}
+		b.newReadBuffer()
 	}
-	return b.buf.Write(p)
+	return nil
 }
 
-// WriteString appends the contents of s to the buffer, growing the buffer as
-// needed. The return value n is the length of s; err is always nil. If the
-// buffer becomes too large, WriteString will panic with ErrTooLarge.
-func (b *Buffer) WriteString(s string) (n int, err error) {
-	if b.file != nil {
-		return b.file.WriteString(s)
+// Truncate keeps the first n bytes of the contents, and drops the rest,
+// e.g. to roll back a partial write; the read offset is moved back to n if
+// it's past it. For RAM-backed buffers, the backing keeps its capacity; for
+// disk-backed buffers, the temp file is truncated to n bytes, and stays
+// open. If n is negative or greater than Size, ErrInvalidSize is returned.
+// Sink, transformed (see WithWritePipeline), mirrored and hashed (see
+// WithHash) buffers don't support it.
+func (b *Buffer) Truncate(n int64) error {
+	if err := b.checkOpen(); err != nil {
+		return err
+	}
+	if b.sink != nil || b.transformed() || b.mirror != nil || b.writeHash != nil {
+		return ErrUnsupported
+	}
+	size := b.Size()
+	if n < 0 || n > size {
+		return ErrInvalidSize
+	}
+	if n == size {
+		return nil
+	}
+	if b.roff > n {
+		b.roff = n
+	}
+	if err := b.unmapFile(); err != nil {
+		return err
+	}
+	if b.file == nil {
+		if b.shared {
+			// Don't overwrite the bytes seen by the snapshots.
+			b.data = append([]byte(nil), b.data[:n]...)
+			b.shared = false
+		} else {
+			b.data = b.data[:n]
+		}
+		b.setLength(n)
+		return nil
+	}
+	if err := b.flushWrites(); err != nil {
+		return err
+	}
+	b.dirty = true
+	if err := b.file.Truncate(n); err != nil {
+		return err
+	}
+	b.setLength(n)
+	if b.reading {
+		return b.setReadOffset(b.roff)
 	}
-	return b.buf.WriteString(s)
+	// Writes append at the end of the file.
+	_, err := b.file.Seek(0, io.SeekEnd)
+	return err
 }
 
-// Read reads the next len(p) bytes from the buffer or until the buffer
-// is drained. The return value n is the number of bytes read. If the
-// buffer has no data to return, err is io.EOF (unless len(p) is zero);
-// otherwise it is nil.
-func (b *Buffer) Read(p []byte) (n int, err error) {
-	if b.file != nil {
-		return b.file.Read(p)
+// dropFilePrefix moves the contents of the file after its first n bytes
+// to its beginning, and truncates it to size-n bytes.
+func (b *Buffer) dropFilePrefix(n, size int64) error {
+	b.dirty = true
+	chunk := make([]byte, 32*1024)
+	for off := n; off < size; {
+		m, err := b.file.ReadAt(chunk, off)
+		if m > 0 {
+			if _, werr := b.file.WriteAt(chunk[:m], off-n); werr != nil {
+				return werr
+			}
+			off += int64(m)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !isEINTR(err) {
+			return err
+		}
 	}
-	return b.buf.Read(p)
+	if err := b.file.Truncate(size - n); err != nil {
+		return err
+	}
+	// Writes append at the end of the file.
+	_, err := b.file.Seek(0, io.SeekEnd)
+	return err
 }
 
-func New(toDisk bool) *Buffer {
-	if toDisk {
-		file, err := ioutil.TempFile("", "ramdiskbuffer")
+// ResetTo empties the buffer, and switches its backing to disk (toDisk true)
+// or RAM (toDisk false), so that the buffer can be reused for a payload
+// whose expected size calls for a different backing.
+//
+// RAM to disk creates a temp file (unless WithLazyFile was used);
+// disk to RAM closes and removes the temp file; a disk-backed buffer
+// that stays on disk keeps its temp file, truncated.
+// A sink buffer (see NewSink) is detached from its writer,
+// which is not closed.
+func (d *Buffer) ResetTo(toDisk bool) error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	defer d.updateRegistry()
+	d.recorded = false
+	d.reading = false
+	if err := d.unmapFile(); err != nil {
+		return err
+	}
+	d.roff = 0
+	d.setLength(0)
+	if d.writeHash != nil {
+		d.writeHash.Reset()
+	}
+	d.sink = nil
+	d.pw = nil
+	d.pr = nil
+	d.br = nil
+	d.hasHeader = false
+	d.wbuf = d.wbuf[:0]
+	if err := d.resetMirror(toDisk); err != nil {
+		return err
+	}
+
+	if d.file != nil {
+		if toDisk {
+			d.dirty = true
+			if err := d.file.Truncate(0); err != nil {
+				return err
+			}
+			_, err := d.file.Seek(0, io.SeekStart)
+			return err
+		}
+		d.file.Close()
+		d.releaseFileSlot()
+		err := d.fs.Remove(d.file.Name())
+		d.file = nil
+		d.toDisk = false
 		if err != nil {
-			panic(err)
+			return err
 		}
-		return &Buffer{
-			file: file,
+	}
+
+	d.toDisk = toDisk
+	if toDisk {
+		// Don't keep the RAM backing around.
+		d.data = nil
+		if !d.lazy {
+			return d.ensureFile()
 		}
+		return nil
+	}
+	if d.shared {
+		// Don't overwrite the bytes seen by the snapshots.
+		d.data = nil
+		d.shared = false
+		return nil
 	}
-	return &Buffer{}
+	d.data = d.data[:0]
+	return nil
 }
 
-func (d *Buffer) Remove() error {
-	if d.file != nil {
-		d.file.Close()
-		return os.Remove(d.file.Name())
+// Reset empties the buffer, keeping its backing, so that a long-lived
+// buffer can be reused for the next payload: like ResetTo with the current
+// backing, a disk-backed buffer keeps its temp file, truncated, and
+// a RAM-backed one keeps the capacity of its backing. Sink buffers don't
+// support it.
+func (d *Buffer) Reset() error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	if d.sink != nil {
+		return ErrUnsupported
+	}
+	return d.ResetTo(d.toDisk)
+}
+
+// FreeMemory releases any RAM held by a disk-backed buffer
+// (e.g. the leftover RAM backing of a buffer that moved to disk),
+// without waiting for the garbage collector to find out it's unused.
+// The paths that move a buffer to disk already do this; for RAM-backed
+// buffers, whose contents live in RAM, it does nothing.
+func (d *Buffer) FreeMemory() {
+	if d.toDisk || d.sink != nil {
+		d.data = nil
+	}
+}
+
+// Compact releases the excess capacity of the RAM backing of a RAM-backed
+// buffer, reallocating it to fit the current contents (none, after
+// ResetTo or DropPrefix of everything), so that e.g. a pooled buffer
+// doesn't keep the large backing of a payload it processed once.
+// The read offset is not affected. For disk-backed and sink buffers,
+// whose contents are not in RAM, it does nothing.
+func (d *Buffer) Compact() error {
+	if d.removed {
+		return ErrRemoved
+	}
+	if d.toDisk || d.sink != nil || cap(d.data) == len(d.data) {
+		return nil
 	}
-	// TODO: better remove buffer
-	d.buf.Reset()
+	if len(d.data) == 0 {
+		d.data = nil
+	} else {
+		d.data = append([]byte(nil), d.data...)
+	}
+	// The new backing is not shared with the snapshots, nor the caller.
+	d.shared = false
+	d.borrowed = false
 	return nil
 }
 
-func (d *Buffer) Size() int {
-	if d.file != nil {
-		err := d.file.Sync()
-		if err != nil {
-			// TODO: not panic??
-			panic(err)
-		}
+// Size returns the number of bytes in the buffer. It is the logical length
+// (see LogicalLen), and the canonical length method: unlike Len, it doesn't
+// overflow on 32-bit platforms for buffers larger than 2GiB.
+//
+// Size doesn't query the backing: it's the count of the bytes written, so
+// it's never behind the writes (even on the network filesystems where the
+// size reported by Stat lags behind them), and unlike the other methods, it
+// can be called (as Len and LenInt64) while another goroutine writes to the
+// buffer.
+func (d *Buffer) Size() int64 {
+	if d.removed {
+		return 0
+	}
+	return d.length.Load()
+}
+
+// SizeInt64 is the same as Size.
+//
+// Deprecated: use Size.
+func (d *Buffer) SizeInt64() int64 {
+	return d.Size()
+}
+
+// Len returns the number of bytes in the buffer, like Size.
+//
+// Deprecated: use Size; Len overflows on 32-bit platforms
+// for buffers larger than 2GiB.
+func (d *Buffer) Len() int {
+	return int(d.Size())
+}
+
+// LenInt64 is the same as Size.
+//
+// Deprecated: use Size.
+func (d *Buffer) LenInt64() int64 {
+	return d.Size()
+}
+
+// LogicalLen returns the number of bytes written to the buffer by the caller.
+func (d *Buffer) LogicalLen() int64 {
+	return d.Size()
+}
 
+// PhysicalLen returns the number of bytes the buffer occupies in its backing
+// (in RAM, or on disk). Without transforms on the written data, it's the
+// same as LogicalLen; for transformed buffers (see WithWritePipeline), it's
+// the size of the temp file, which doesn't include what the write pipeline
+// hasn't flushed yet; the error is the one of querying it.
+func (d *Buffer) PhysicalLen() (int64, error) {
+	if d.file != nil && d.transformed() && !d.removed {
 		info, err := d.file.Stat()
 		if err != nil {
-			// TODO: not panic??
-			panic(err)
+			return 0, err
 		}
-		return int(info.Size())
+		return info.Size(), nil
 	}
-	return d.buf.Len()
-}
-
-func (d *Buffer) SizeInt64() int64 {
-	return int64(d.Size())
+	return d.Size(), nil
 }
 
+// Close flushes the temp file of a disk-backed buffer to disk, and closes it;
+// for a sink buffer, it closes the sink if it's an io.Closer.
+//
+// All the operations of a Buffer are synchronous: there is never
+// an operation in flight when Close is called from the goroutine
+// that uses the buffer. Like the other methods, Close must not be
+// called concurrently with them. Closing a closed buffer does nothing.
+// After Close, the buffer can only be removed: writing, reading and
+// resetting it return ErrAlreadyClosed (see State).
 func (d *Buffer) Close() error {
+	if d.closed {
+		return nil
+	}
+	d.releaseRAMUsage()
+	d.closed = true
+	d.unmapFile()
+	d.recordSize()
+	d.deregister()
+	// Tell the tail readers once the file holds all the contents.
+	defer d.signalDone()
+	if d.sink != nil {
+		if c, ok := d.sink.(io.Closer); ok {
+			return c.Close()
+		}
+		return nil
+	}
 	if d.file != nil {
-		err := d.file.Sync()
+		if err := d.closePipeline(); err != nil {
+			return err
+		}
+		err := d.syncFile()
 		if err != nil {
 			return err
 		}
+		defer d.releaseFileSlot()
 		return d.file.Close()
 	}
+	if d.mirror != nil {
+		if err := d.syncMirror(); err != nil {
+			return err
+		}
+		defer d.releaseFileSlot()
+		return d.mirror.Close()
+	}
 	return nil
 }
 
+// PrepareForReading sets the buffer in read mode
+// (i.e. flushes to disk, and seeks to the beginning of the contents).
+//
+// A buffer can go through any number of write and read phases:
+// a write after PrepareForReading appends to the existing contents
+// (regardless of how much was read), and ends the read mode;
+// the next PrepareForReading seeks to the beginning again.
 func (d *Buffer) PrepareForReading() error {
+	return d.prepareForReading(true)
+}
+
+// PrepareForReadingNoSync is like PrepareForReading, but doesn't fsync
+// the temp file before seeking to the beginning of it.
+// Use it when the data doesn't need to be durable (e.g. the temp dir
+// is on tmpfs, or the data is throwaway anyway).
+func (d *Buffer) PrepareForReadingNoSync() error {
+	return d.prepareForReading(false)
+}
+
+// Sync flushes the writes of a disk-backed buffer to its temp file, and
+// fsyncs it, without ending the write mode: e.g. to checkpoint what was
+// written so far. It does nothing if the file wasn't modified since it was
+// last fsynced (by Sync, PrepareForReading or Close), so it can be called
+// defensively, e.g. in a loop.
+//
+// For mirrored buffers (see NewMirrored), it fsyncs the mirror; for the
+// other RAM-backed buffers, and sink buffers, it does nothing. For
+// transformed buffers (see WithWritePipeline), the bytes held by the
+// write stages reach the file only at the end of the write mode.
+func (d *Buffer) Sync() error {
+	if d.removed {
+		return ErrRemoved
+	}
+	if d.file != nil {
+		return d.syncFile()
+	}
+	return d.syncMirror()
+}
+
+func (d *Buffer) prepareForReading(sync bool) error {
+	if err := d.checkOpen(); err != nil {
+		return err
+	}
+	if d.sink != nil {
+		if err := d.rewindSink(); err != nil {
+			return err
+		}
+		d.reading = true
+		return nil
+	}
 	if d.file != nil {
-		err := d.file.Sync()
+		if err := d.closePipeline(); err != nil {
+			return err
+		}
+		if sync {
+			err := d.syncFile()
+			if err != nil {
+				return err
+			}
+		}
+		_, err := d.file.Seek(0, 0)
 		if err != nil {
 			return err
 		}
-		_, err = d.file.Seek(0, 0)
+		// The file is transformed if the buffer wrote the header.
+		pipeline, err := d.fileReadPipeline(d.file)
 		if err != nil {
 			return err
 		}
+		if pipeline == nil {
+			d.mapFile()
+		}
+		var src io.Reader = readerFunc(d.readFile)
+		if d.newReadBuffer() {
+			src = d.br
+		}
+		d.pr = nil
+		if pipeline != nil {
+			d.pr = pipeline(src)
+		}
+	}
+	if sync {
+		if err := d.syncMirror(); err != nil {
+			return err
+		}
+	}
+	d.roff = 0
+	d.reading = true
+	if d.readHash != nil {
+		d.readHash.Reset()
+	}
+	return nil
+}
+
+// Finalize prepares the buffer for reading, like PrepareForReading,
+// and returns its length, fsyncing the temp file only once.
+func (d *Buffer) Finalize() (int64, error) {
+	if err := d.prepareForReading(true); err != nil {
+		return 0, err
+	}
+	return d.Size(), nil
+}
+
+// InReadMode reports whether the buffer has been prepared for reading
+// by PrepareForReading (or PrepareForReadingNoSync).
+func (d *Buffer) InReadMode() bool {
+	return d.reading
+}
+
+// rewindSink seeks the sink to its beginning, if possible.
+func (d *Buffer) rewindSink() error {
+	s, ok := d.sink.(io.ReadSeeker)
+	if !ok {
+		return ErrNotSeekable
+	}
+	_, err := s.Seek(0, io.SeekStart)
+	return err
+}
+
+// Reader returns a new reader over the contents of the buffer, starting
+// at the beginning. The returned reader has its own offset, and doesn't
+// affect (nor is affected by) the offset used by b.Read.
+//
+// For disk-backed buffers, a new read-only file descriptor is opened
+// on the temp file; it is closed when the reader returns an error
+// (including io.EOF), or when it's closed via io.Closer.
+// For RAM-backed buffers, the reader is over a snapshot of the current
+// contents.
+//
+// For transformed buffers (see WithWritePipeline), the write pipeline is
+// closed first, so that the reader sees all the contents: like after
+// PrepareForReading, the next write starts a new transformed stream.
+func (b *Buffer) Reader() (io.Reader, error) {
+	if b.removed {
+		return nil, ErrRemoved
+	}
+	if b.sink != nil {
+		return nil, ErrUnsupported
+	}
+	if b.file != nil {
+		if err := b.closePipeline(); err != nil {
+			return nil, err
+		}
+		file, err := b.fs.Open(b.file.Name())
+		if err != nil {
+			return nil, err
+		}
+		pipeline, err := b.fileReadPipeline(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if pipeline != nil {
+			fr := &fileReader{file: file}
+			return readCloser{pipeline(fr), fr}, nil
+		}
+		return &fileReader{file: file}, nil
+	}
+	if b.toDisk {
+		return bytes.NewReader(nil), nil
+	}
+	snapshot := make([]byte, len(b.data))
+	copy(snapshot, b.data)
+	return bytes.NewReader(snapshot), nil
+}
+
+// Bytes returns a copy of the contents of the buffer. Like Reader, it
+// doesn't affect (nor is affected by) the offset used by b.Read, and can be
+// called before or after PrepareForReading; for disk-backed buffers, the
+// temp file is read back via a new file descriptor. If the contents don't
+// fit in a slice, ErrTooLarge is returned.
+func (b *Buffer) Bytes() ([]byte, error) {
+	if b.removed {
+		return nil, ErrRemoved
+	}
+	if b.file == nil && !b.toDisk && b.sink == nil {
+		contents := make([]byte, len(b.data))
+		copy(contents, b.data)
+		return contents, nil
+	}
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	size := b.Size()
+	if size > int64(math.MaxInt-bytes.MinRead) {
+		return nil, ErrTooLarge
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, int(size)+bytes.MinRead))
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// String returns the contents of the buffer as a string; see Bytes.
+func (b *Buffer) String() (string, error) {
+	contents, err := b.Bytes()
+	return string(contents), err
+}
+
+// RangeReader returns a new reader over the length bytes of the contents
+// starting at offset off; reads past the end of the range (or of the
+// contents) return io.EOF. Like the reader of Reader, it has its own offset,
+// so that e.g. many HTTP range requests can be served concurrently off one
+// buffer, and its Close releases its resources.
+//
+// For disk-backed buffers, a new read-only file descriptor is opened on the
+// temp file; it is closed by Close, or as soon as a read of the file fails.
+// For RAM-backed buffers, the reader is over a snapshot of the range.
+// If off or length is negative, ErrInvalidSize is returned; sink and
+// transformed buffers (see WithWritePipeline) don't support it.
+func (b *Buffer) RangeReader(off, length int64) (io.ReadCloser, error) {
+	if b.removed {
+		return nil, ErrRemoved
+	}
+	if off < 0 || length < 0 {
+		return nil, ErrInvalidSize
+	}
+	if b.sink != nil || (b.file != nil && b.transformed()) {
+		return nil, ErrUnsupported
+	}
+	if b.file != nil {
+		if err := b.flushWrites(); err != nil {
+			return nil, err
+		}
+		file, err := b.fs.Open(b.file.Name())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Seek(off, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		fr := &fileReader{file: file}
+		return readCloser{io.LimitReader(fr, length), fr}, nil
+	}
+	var snapshot []byte
+	if !b.toDisk && off < int64(len(b.data)) {
+		end := int64(len(b.data))
+		if length < end-off {
+			end = off + length
+		}
+		snapshot = append(snapshot, b.data[off:end]...)
+	}
+	return io.NopCloser(bytes.NewReader(snapshot)), nil
+}
+
+// LineScanner returns a scanner over the lines of the buffer, from the
+// beginning, using a new reader (see Reader). The buffer must be in read
+// mode (see PrepareForReading), otherwise ErrNotPrepared is returned.
+//
+// Like any bufio.Scanner, it fails on lines longer than
+// bufio.MaxScanTokenSize (64KiB); to allow longer lines, give the
+// scanner a larger buffer via its Buffer method before scanning.
+func (b *Buffer) LineScanner() (*bufio.Scanner, error) {
+	if !b.reading {
+		return nil, ErrNotPrepared
+	}
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewScanner(r), nil
+}
+
+// JSONDecoder prepares the buffer for reading (see PrepareForReading), and
+// returns a JSON decoder over a new reader of its contents (see Reader),
+// to decode them incrementally, e.g. one element of an array at a time,
+// without loading them all in memory.
+func (b *Buffer) JSONDecoder() (*json.Decoder, error) {
+	if err := b.PrepareForReading(); err != nil {
+		return nil, err
+	}
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return json.NewDecoder(r), nil
+}
+
+// WriteFile writes the contents of the buffer to the named file,
+// creating it with permissions perm if needed, or truncating it otherwise;
+// then it fsyncs the file.
+// The contents are always copied, so the file can be on any filesystem.
+// The read offset of the buffer is not affected.
+func (b *Buffer) WriteFile(path string, perm os.FileMode) error {
+	r, err := b.Reader()
+	if err != nil {
+		return err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if b.durableDir {
+		return syncDir(filepath.Dir(path))
 	}
 	return nil
 }
 
+// readerFunc adapts a function to io.Reader.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// fileReader is a reader over a file that closes the file
+// as soon as a read fails.
+type fileReader struct {
+	file File
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.file == nil {
+		return 0, io.EOF
+	}
+	n, err := r.file.Read(p)
+	if err != nil {
+		r.Close()
+	}
+	return n, err
+}
+
+func (r *fileReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
 type BufferArray []*Buffer
 
-func NewArray(length int, toDisk bool) BufferArray {
-	buffers := make([]*Buffer, length)
-	for i := range buffers {
-		buffers[i] = New(toDisk)
+// NewArray returns length new buffers (see New). If creating one of them
+// panics (e.g. because of the limit of SetMaxLiveBuffers), the ones created
+// before it are removed first.
+func NewArray(length int, toDisk bool, opts ...Option) BufferArray {
+	buffers := make(BufferArray, 0, length)
+	defer func() {
+		if r := recover(); r != nil {
+			buffers.Remove()
+			panic(r)
+		}
+	}()
+	for i := 0; i < length; i++ {
+		buffers = append(buffers, New(toDisk, opts...))
 	}
 	return buffers
 }
 
+// arrayWorkers is the number of buffers of an array that the methods
+// of BufferArray process in parallel (see forEach).
+const arrayWorkers = 8
+
+// forEach calls f on all the buffers, from arrayWorkers goroutines, and
+// returns all the errors joined (see errors.Join), in the order of the
+// buffers: a failure doesn't stop the other calls.
+func (ba BufferArray) forEach(f func(*Buffer) error) error {
+	errs := make([]error, len(ba))
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for i := 0; i < arrayWorkers && i < len(ba); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = f(ba[i])
+			}
+		}()
+	}
+	for i := range ba {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
 // PrepareForReading sets all the buffers in read mode
 // (i.e. flushes to disk, and seeks to the beginning of the file);
-// after PrepareForReading, no writing should be done.
+// see Buffer.PrepareForReading. The buffers are prepared in parallel,
+// by a few goroutines, and all of them are, even if some fail: the
+// errors are returned joined (see errors.Join).
 func (ba BufferArray) PrepareForReading() error {
+	return ba.forEach((*Buffer).PrepareForReading)
+}
+
+// Remove removes all the buffers (see Buffer.Remove), in parallel, like
+// PrepareForReading: a failure doesn't stop the others from being removed,
+// so that no temp file is left behind.
+func (ba BufferArray) Remove() error {
+	return ba.forEach((*Buffer).Remove)
+}
+
+// Close closes all the buffers (see Buffer.Close), flushing their temp files
+// to disk without removing them, so that they can still be removed later by
+// Remove. Like PrepareForReading, it closes the buffers in parallel, and
+// returns all the errors joined. Like Buffer.Close, closing a closed array
+// does nothing.
+func (ba BufferArray) Close() error {
+	return ba.forEach((*Buffer).Close)
+}
+
+// PrepareForReadingNoSync is like PrepareForReading, but doesn't fsync
+// the buffers (nor their mirrors, see NewMirrored) before seeking to the
+// beginning of them: use PrepareForReadingBatchSync to flush many buffers
+// efficiently.
+func (ba BufferArray) PrepareForReadingNoSync() error {
+	return ba.forEach((*Buffer).PrepareForReadingNoSync)
+}
+
+// SpillToDisk moves the RAM-backed buffers to disk (see Buffer.SpillToDisk),
+// in parallel, like PrepareForReading, e.g. to release the RAM of a whole
+// array at once.
+func (ba BufferArray) SpillToDisk() error {
+	return ba.forEach((*Buffer).SpillToDisk)
+}
+
+// Size returns the sum of the sizes of all the buffers (see Buffer.Size).
+func (ba BufferArray) Size() int64 {
+	var total int64
 	for _, buf := range ba {
-		// prepare for reading
-		err := buf.PrepareForReading()
-		if err != nil {
-			return err
+		total += buf.Size()
+	}
+	return total
+}
+
+// TotalLen is the same as Size.
+func (ba BufferArray) TotalLen() int64 {
+	return ba.Size()
+}
+
+// Reserve makes room in each buffer for bytesPerBuffer bytes in total
+// (see Buffer.Grow), e.g. to preallocate the disk space of all the buffers
+// before a long job rather than running out of it midway. If a buffer
+// can't take bytesPerBuffer bytes (see WithMaxSize), it returns
+// ErrInvalidSize without growing any buffer; otherwise, it stops at the
+// first buffer whose reservation fails, and returns the error.
+func (ba BufferArray) Reserve(bytesPerBuffer int64) error {
+	if bytesPerBuffer < 0 {
+		return ErrInvalidSize
+	}
+	for _, buf := range ba {
+		if n := bytesPerBuffer - buf.Size(); n > 0 && !buf.fitsMaxSize(n) {
+			return ErrInvalidSize
+		}
+	}
+	for _, buf := range ba {
+		if n := bytesPerBuffer - buf.Size(); n > 0 {
+			if err := buf.Grow(n); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-func (ba BufferArray) Remove() error {
+// EnforceMemoryBudget keeps the total length of the RAM-backed buffers
+// within maxRAM: if it's more than that, the largest RAM-backed buffers
+// are spilled to disk (see Buffer.SpillToDisk) until it isn't. Mirrored
+// buffers (see NewMirrored), which can't be spilled, are skipped, but
+// their length counts in the total.
+func (ba BufferArray) EnforceMemoryBudget(maxRAM int64) error {
+	type sized struct {
+		buf  *Buffer
+		size int64
+	}
+	var inRAM []sized
+	var total int64
 	for _, buf := range ba {
-		// remove
-		err := buf.Remove()
-		if err != nil {
-			// TODO: return error, or make an error array and return at the end?
+		if buf.toDisk || buf.sink != nil {
+			continue
+		}
+		size := buf.Size()
+		inRAM = append(inRAM, sized{buf, size})
+		total += size
+	}
+	sort.Slice(inRAM, func(i, j int) bool {
+		return inRAM[i].size > inRAM[j].size
+	})
+	for _, s := range inRAM {
+		if total <= maxRAM {
+			break
+		}
+		if s.buf.mirror != nil {
+			continue
+		}
+		if err := s.buf.SpillToDisk(); err != nil {
 			return err
 		}
+		total -= s.size
 	}
 	return nil
 }
+
+// WriteTo writes the contents of all the buffers to w, after preparing
+// each of them for reading (see Buffer.PrepareForReading).
+//
+// The buffers are written strictly in index order, each one in full
+// before the next: the output is exactly the concatenation of ba[0],
+// ba[1], ..., ba[len(ba)-1]. The return value n is the number of bytes
+// written to w.
+func (ba BufferArray) WriteTo(w io.Writer) (n int64, err error) {
+	for _, buf := range ba {
+		if err := buf.PrepareForReading(); err != nil {
+			return n, err
+		}
+		m, err := io.Copy(w, buf)
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Reader returns a reader of the concatenation of all the buffers, in index
+// order, like WriteTo: e.g. to hand the shards of one logical output to an
+// HTTP response, or to a hash, in one call. Each buffer is prepared for
+// reading (see Buffer.PrepareForReading) when the reader gets to it, and
+// read from its read offset, which the reader moves: the buffers must not
+// be used until the reader is done. The reader implements io.WriterTo,
+// so that io.Copy uses the WriteTo of each buffer.
+func (ba BufferArray) Reader() io.Reader {
+	return &arrayReader{ba: ba}
+}
+
+// arrayReader is the reader of BufferArray.Reader; the buffers before the
+// index next are drained, and the buffer next is prepared if prepared is
+// true.
+type arrayReader struct {
+	ba       BufferArray
+	next     int
+	prepared bool
+}
+
+// current returns the buffer being read, preparing it if needed,
+// or nil if all the buffers are drained.
+func (r *arrayReader) current() (*Buffer, error) {
+	if r.next >= len(r.ba) {
+		return nil, nil
+	}
+	buf := r.ba[r.next]
+	if !r.prepared {
+		if err := buf.PrepareForReading(); err != nil {
+			return nil, err
+		}
+		r.prepared = true
+	}
+	return buf, nil
+}
+
+// advance moves to the next buffer.
+func (r *arrayReader) advance() {
+	r.next++
+	r.prepared = false
+}
+
+func (r *arrayReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		buf, err := r.current()
+		if err != nil {
+			return 0, err
+		}
+		if buf == nil {
+			return 0, io.EOF
+		}
+		n, err := buf.Read(p)
+		if err == io.EOF {
+			r.advance()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *arrayReader) WriteTo(w io.Writer) (n int64, err error) {
+	for {
+		buf, err := r.current()
+		if err != nil || buf == nil {
+			return n, err
+		}
+		m, err := buf.WriteTo(w)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		r.advance()
+	}
+}
@@ -0,0 +1,1144 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestZeroLengthRead(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		for _, contents := range []string{"", "abc"} {
+			b := New(toDisk)
+			b.WriteString(contents)
+			// Not prepared, prepared, and drained.
+			for step := 0; step < 3; step++ {
+				for _, p := range [][]byte{nil, {}} {
+					if n, err := b.Read(p); n != 0 || err != nil {
+						t.Errorf("toDisk %v, contents %q, step %d: got (%d, %v), want (0, nil)", toDisk, contents, step, n, err)
+					}
+				}
+				switch step {
+				case 0:
+					if err := b.PrepareForReading(); err != nil {
+						t.Fatal(err)
+					}
+				case 1:
+					b.Read(make([]byte, 10))
+				}
+			}
+			b.Remove()
+		}
+	}
+}
+
+func TestWriteReadCycles(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		var want string
+		for i, chunk := range []string{"abc", "defgh", "", "ij"} {
+			b.WriteString(chunk)
+			want += chunk
+			if b.InReadMode() {
+				t.Fatalf("toDisk %v, cycle %d: still in read mode after a write", toDisk, i)
+			}
+			if err := b.PrepareForReading(); err != nil {
+				t.Fatal(err)
+			}
+			// Read only part of the contents: the next write appends anyway.
+			p := make([]byte, len(want)-1)
+			b.ReadFull(p)
+			if err := b.PrepareForReading(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(b)
+			if err != nil || string(got) != want {
+				t.Errorf("toDisk %v, cycle %d: got (%q, %v), want %q", toDisk, i, got, err, want)
+			}
+			if b.Len() != len(want) {
+				t.Errorf("toDisk %v, cycle %d: Len %d, want %d", toDisk, i, b.Len(), len(want))
+			}
+		}
+		b.Remove()
+	}
+}
+
+// slowFile is a File whose writes take some time.
+type slowFile struct {
+	File
+}
+
+func (f slowFile) Write(p []byte) (int, error) {
+	time.Sleep(10 * time.Millisecond)
+	return f.File.Write(p)
+}
+
+func TestCloseAfterSlowWrite(t *testing.T) {
+	fsys := newWrapFS(func(f File) File { return slowFile{f} })
+	b := New(true, WithFS(fsys))
+	b.WriteString("abc")
+	name := b.file.Name()
+
+	// Close must not be called concurrently with a write: the writing
+	// goroutine hands the buffer over when the write has returned.
+	done := make(chan error)
+	go func() {
+		_, err := b.Write([]byte("defgh"))
+		done <- err
+	}()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 8 {
+		t.Errorf("Len %d after Close, want 8", b.Len())
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := ioutil.ReadAll(f)
+	if err != nil || string(got) != "abcdefgh" {
+		t.Errorf("temp file contains (%q, %v), want %q", got, err, "abcdefgh")
+	}
+	b.Remove()
+}
+
+func TestBufferArrayWriteToOrder(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		ba := NewArray(20, toDisk)
+		var want bytes.Buffer
+		for i, buf := range ba {
+			marker := fmt.Sprintf("<shard %d>", i)
+			if i%3 == 0 {
+				marker = strings.Repeat(marker, 1000)
+			}
+			buf.WriteString(marker)
+			want.WriteString(marker)
+		}
+		var got bytes.Buffer
+		n, err := ba.WriteTo(&got)
+		if err != nil || n != int64(want.Len()) {
+			t.Errorf("toDisk %v: got (%d, %v), want (%d, nil)", toDisk, n, err, want.Len())
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("toDisk %v: the shards are not concatenated in index order", toDisk)
+		}
+		ba.Remove()
+	}
+}
+
+// eintrFile is a File whose reads and writes are each interrupted
+// by a signal (EINTR) once before succeeding.
+type eintrFile struct {
+	File
+	interrupted bool
+	eintrs      int
+}
+
+func (f *eintrFile) interrupt(op string) error {
+	f.interrupted = !f.interrupted
+	if !f.interrupted {
+		return nil
+	}
+	f.eintrs++
+	return &os.PathError{Op: op, Path: f.Name(), Err: syscall.EINTR}
+}
+
+func (f *eintrFile) Write(p []byte) (int, error) {
+	if err := f.interrupt("write"); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *eintrFile) WriteString(s string) (int, error) {
+	if err := f.interrupt("write"); err != nil {
+		return 0, err
+	}
+	return f.File.WriteString(s)
+}
+
+func (f *eintrFile) Read(p []byte) (int, error) {
+	if err := f.interrupt("read"); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *eintrFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.interrupt("read"); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func TestRetryEINTR(t *testing.T) {
+	var f *eintrFile
+	b := New(true, WithFS(newWrapFS(func(file File) File {
+		f = &eintrFile{File: file}
+		return f
+	})))
+	defer b.Remove()
+
+	for i := 0; i < 10; i++ {
+		if _, err := b.Write([]byte("abc")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.WriteString("def"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := strings.Repeat("abcdef", 10)
+	r, err := b.RangeReader(3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(got) != "def" {
+		t.Errorf("RangeReader: got (%q, %v), want %q", got, err, "def")
+	}
+	if err := b.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ioutil.ReadAll(b)
+	if err != nil || string(got) != want {
+		t.Errorf("got (%q, %v), want %q", got, err, want)
+	}
+	if f.eintrs < 20 {
+		t.Errorf("only %d interrupted calls, want at least 20", f.eintrs)
+	}
+}
+
+// laggingFile is a File whose Stat reports a size lagging behind
+// the writes, like on some network filesystems.
+type laggingFile struct {
+	File
+}
+
+func (f laggingFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return laggingInfo{info}, nil
+}
+
+type laggingInfo struct {
+	os.FileInfo
+}
+
+func (info laggingInfo) Size() int64 {
+	return info.FileInfo.Size() / 2
+}
+
+func TestLenWithLaggingStat(t *testing.T) {
+	b := New(true, WithFS(newWrapFS(func(f File) File { return laggingFile{f} })))
+	defer b.Remove()
+
+	want := strings.Repeat("0123456789", 100)
+	b.WriteString(want)
+	if b.Len() != len(want) {
+		t.Errorf("Len %d in write mode, want %d", b.Len(), len(want))
+	}
+	if err := b.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != len(want) {
+		t.Errorf("Len %d in read mode, want %d", b.Len(), len(want))
+	}
+	p := make([]byte, b.Len())
+	if _, err := b.ReadFull(p); err != nil || string(p) != want {
+		t.Errorf("reading Len bytes: got (%q, %v), want %q", p, err, want)
+	}
+}
+
+func TestLenCountsWriteAndWriteString(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		new  func() *Buffer
+	}{
+		{"ram", func() *Buffer { return New(false) }},
+		{"disk", func() *Buffer { return New(true) }},
+		{"gzip", func() *Buffer { return New(true, WithGzip()) }},
+		{"blocks", func() *Buffer { return New(true, WithBlockSize(64)) }},
+		{"spill", func() *Buffer { return NewFromSlice(make([]byte, 0, 100), true) }},
+	} {
+		b := tc.new()
+		want := 0
+		for i := 0; i < 50; i++ {
+			chunk := strings.Repeat("x", i)
+			var n int
+			var err error
+			if i%2 == 0 {
+				n, err = b.Write([]byte(chunk))
+			} else {
+				n, err = b.WriteString(chunk)
+			}
+			if err != nil || n != len(chunk) {
+				t.Fatalf("%s: write %d: got (%d, %v), want (%d, nil)", tc.name, i, n, err, len(chunk))
+			}
+			want += len(chunk)
+			if b.Len() != want {
+				t.Fatalf("%s: Len %d after write %d, want %d", tc.name, b.Len(), i, want)
+			}
+		}
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+		if b.Len() != want {
+			t.Errorf("%s: Len %d in read mode, want %d", tc.name, b.Len(), want)
+		}
+		b.Remove()
+	}
+}
+
+func TestInvalidSizes(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		b.WriteString("abc")
+		for _, tc := range []struct {
+			name string
+			call func(n int64) error
+			// max is the smallest invalid size above 0.
+			max int64
+		}{
+			{"Grow", b.Grow, math.MaxInt64},
+			{"DropPrefix", b.DropPrefix, 4},
+			{"Reserve", BufferArray{b}.Reserve, math.MaxInt64},
+			// Truncating to the size keeps the contents.
+			{"Truncate", func(n int64) error {
+				if n == 0 {
+					n = 3
+				}
+				return b.Truncate(n)
+			}, 4},
+		} {
+			for _, n := range []int64{-1, 0, tc.max} {
+				want := ErrInvalidSize
+				if n == 0 {
+					want = nil
+				}
+				if err := tc.call(n); err != want {
+					t.Errorf("toDisk %v: %s(%d): got %v, want %v", toDisk, tc.name, n, err, want)
+				}
+			}
+		}
+		for _, r := range [][2]int64{{-1, 0}, {0, -1}} {
+			if _, err := b.ReadRangeFrom(strings.NewReader(""), r[0], r[1]); err != ErrInvalidSize {
+				t.Errorf("toDisk %v: ReadRangeFrom(%d, %d): got %v, want ErrInvalidSize", toDisk, r[0], r[1], err)
+			}
+		}
+		if n, err := b.ReadRangeFrom(strings.NewReader(""), 0, 0); n != 0 || err != nil {
+			t.Errorf("toDisk %v: ReadRangeFrom of 0 bytes: got (%d, %v), want (0, nil)", toDisk, n, err)
+		}
+		// Past the end of the source.
+		if n, err := b.ReadRangeFrom(strings.NewReader("xy"), 1, 2); n != 1 || err != io.ErrUnexpectedEOF {
+			t.Errorf("toDisk %v: ReadRangeFrom past the end: got (%d, %v), want (1, ErrUnexpectedEOF)", toDisk, n, err)
+		}
+		if err := b.Truncate(3); err != nil {
+			t.Fatal(err)
+		}
+		if b.Len() != 3 {
+			t.Errorf("toDisk %v: Len %d, want 3", toDisk, b.Len())
+		}
+		b.Remove()
+	}
+}
+
+func TestInvalidSizesWithMaxSize(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk, WithMaxSize(10))
+		b.WriteString("abc")
+		if err := b.Grow(7); err != nil {
+			t.Errorf("toDisk %v: Grow up to the max: %v", toDisk, err)
+		}
+		if err := b.Grow(8); err != ErrInvalidSize {
+			t.Errorf("toDisk %v: Grow past the max: got %v, want ErrInvalidSize", toDisk, err)
+		}
+		other := New(toDisk)
+		if err := (BufferArray{other, b}).Reserve(11); err != ErrInvalidSize {
+			t.Errorf("toDisk %v: Reserve past the max: got %v, want ErrInvalidSize", toDisk, err)
+		}
+		if err := (BufferArray{other, b}).Reserve(10); err != nil {
+			t.Errorf("toDisk %v: Reserve up to the max: %v", toDisk, err)
+		}
+		if err := b.Truncate(11); err != ErrInvalidSize {
+			t.Errorf("toDisk %v: Truncate past the size: got %v, want ErrInvalidSize", toDisk, err)
+		}
+		other.Remove()
+		b.Remove()
+	}
+}
+
+func TestLenDuringWrites(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				b.Write([]byte("abc"))
+			}
+		}()
+		// Run with -race: Len, LenInt64 and Size can be called
+		// concurrently with the writes.
+		last := 0
+	poll:
+		for {
+			select {
+			case <-done:
+				break poll
+			default:
+			}
+			n := b.Len()
+			if n < last || b.LenInt64() < int64(n) || b.Size() < int64(n) {
+				t.Fatalf("toDisk %v: the length went back from %d", toDisk, last)
+			}
+			last = n
+		}
+		if b.Size() != 3000 {
+			t.Errorf("toDisk %v: Size %d, want 3000", toDisk, b.Size())
+		}
+		b.Remove()
+	}
+}
+
+// failingWriter accepts k bytes, then fails.
+type failingWriter struct {
+	k   int
+	got bytes.Buffer
+}
+
+var errWriterFailed = errors.New("writer failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.k {
+		n := w.k
+		w.got.Write(p[:n])
+		w.k = 0
+		return n, errWriterFailed
+	}
+	w.k -= len(p)
+	w.got.Write(p)
+	return len(p), nil
+}
+
+func TestWriteToPartialProgress(t *testing.T) {
+	want := strings.Repeat("0123456789", 10000)
+	const k = 40000
+	for _, tc := range []struct {
+		name string
+		new  func() *Buffer
+	}{
+		{"ram", func() *Buffer { return New(false) }},
+		{"disk", func() *Buffer { return New(true) }},
+		{"read buffer", func() *Buffer { return New(true, WithReadBufferSize(100)) }},
+		{"gzip", func() *Buffer { return New(true, WithGzip()) }},
+	} {
+		b := tc.new()
+		b.WriteString(want)
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+		w := &failingWriter{k: k}
+		n, err := b.WriteTo(w)
+		if n != k || err != errWriterFailed {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", tc.name, n, err, k, errWriterFailed)
+		}
+		if b.ReadProgress() != k {
+			t.Errorf("%s: read offset %d, want %d", tc.name, b.ReadProgress(), k)
+		}
+		// Resume.
+		var rest bytes.Buffer
+		if _, err := b.WriteTo(&rest); err != nil {
+			t.Fatal(err)
+		}
+		if w.got.String()+rest.String() != want {
+			t.Errorf("%s: the resumed copy differs from the contents", tc.name)
+		}
+		b.Remove()
+	}
+}
+
+// BenchmarkWriteOnceReadOnce measures the common write-once/read-once
+// pattern of a RAM-backed buffer: the payload should be copied (and
+// allocated) only once, like for a bytes.Buffer.
+func BenchmarkWriteOnceReadOnce(b *testing.B) {
+	payload := bytes.Repeat([]byte("x"), 64*1024)
+	b.Run("Buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			buf := New(false)
+			buf.Write(payload)
+			buf.PrepareForReading()
+			buf.WriteTo(ioutil.Discard)
+			buf.Remove()
+		}
+	})
+	b.Run("bytes.Buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			var buf bytes.Buffer
+			buf.Write(payload)
+			buf.WriteTo(ioutil.Discard)
+		}
+	})
+}
+
+// BenchmarkWriteString measures appending strings to disk-backed
+// buffers: the strings should be written without being converted
+// to []byte, i.e. without allocating.
+func BenchmarkWriteString(b *testing.B) {
+	s := strings.Repeat("x", 100)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"file", nil},
+		{"blocks", []Option{WithBlockSize(4096)}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			buf := New(true, tc.opts...)
+			defer buf.Remove()
+			b.ReportAllocs()
+			b.SetBytes(int64(len(s)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				buf.WriteString(s)
+			}
+		})
+	}
+}
+
+// BenchmarkWriteTo compares the chunks of WriteTo, sized after the
+// amount to copy (see copyChunkSize), with fixed 32KiB chunks.
+func BenchmarkWriteTo(b *testing.B) {
+	block := bytes.Repeat([]byte("x"), 1<<20)
+	for _, size := range []int{1 << 20, 100 << 20, 1 << 30} {
+		if size > 100<<20 && testing.Short() {
+			continue
+		}
+		buf := New(true)
+		for n := 0; n < size; n += len(block) {
+			buf.Write(block)
+		}
+		name := fmt.Sprintf("%dMB", size>>20)
+		b.Run(name+"/adaptive", func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				buf.PrepareForReadingNoSync()
+				if _, err := buf.WriteTo(ioutil.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(name+"/fixed32KiB", func(b *testing.B) {
+			b.SetBytes(int64(size))
+			chunk := make([]byte, 32*1024)
+			for i := 0; i < b.N; i++ {
+				buf.PrepareForReadingNoSync()
+				// Hide WriteTo and ReadFrom from io.CopyBuffer,
+				// so that it copies in chunks of 32KiB.
+				dst := struct{ io.Writer }{ioutil.Discard}
+				if _, err := io.CopyBuffer(dst, struct{ io.Reader }{buf}, chunk); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		buf.Remove()
+	}
+}
+
+func TestSeek(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		new  func() *Buffer
+	}{
+		{"ram", func() *Buffer { return New(false) }},
+		{"disk", func() *Buffer { return New(true) }},
+		{"read buffer", func() *Buffer { return New(true, WithReadBufferSize(4)) }},
+		{"gzip", func() *Buffer { return New(true, WithGzip()) }},
+	} {
+		b := tc.new()
+		b.WriteString("0123456789")
+		// In write mode: the first Seek finalizes the buffer.
+		if off, err := b.Seek(0, io.SeekStart); err != nil || off != 0 {
+			t.Fatalf("%s: rewind: got (%d, %v)", tc.name, off, err)
+		}
+		if !b.InReadMode() {
+			t.Errorf("%s: not in read mode after Seek", tc.name)
+		}
+		for _, step := range []struct {
+			offset int64
+			whence int
+			want   string
+		}{
+			{3, io.SeekStart, "34"},
+			{2, io.SeekCurrent, "78"},
+			{-4, io.SeekEnd, "67"},
+			{-6, io.SeekCurrent, "23"},
+			{0, io.SeekEnd, ""},
+		} {
+			off, err := b.Seek(step.offset, step.whence)
+			if err != nil {
+				t.Fatalf("%s: Seek(%d, %d): %v", tc.name, step.offset, step.whence, err)
+			}
+			if off != b.ReadProgress() {
+				t.Errorf("%s: Seek returned %d, read offset %d", tc.name, off, b.ReadProgress())
+			}
+			p := make([]byte, 2)
+			n, _ := b.Read(p)
+			if string(p[:n]) != step.want {
+				t.Errorf("%s: Seek(%d, %d): read %q, want %q", tc.name, step.offset, step.whence, p[:n], step.want)
+			}
+		}
+		for _, off := range []int64{-1, 11} {
+			if _, err := b.Seek(off, io.SeekStart); err != ErrInvalidSize {
+				t.Errorf("%s: Seek(%d): got %v, want ErrInvalidSize", tc.name, off, err)
+			}
+		}
+		if _, err := b.Seek(0, 42); err != ErrInvalidSize {
+			t.Errorf("%s: invalid whence: got %v, want ErrInvalidSize", tc.name, err)
+		}
+		b.Remove()
+	}
+}
+
+// syncCountingFile is a File that counts its fsyncs.
+type syncCountingFile struct {
+	File
+	syncs *int
+}
+
+func (f syncCountingFile) Sync() error {
+	*f.syncs++
+	return f.File.Sync()
+}
+
+func TestSyncOnlyIfDirty(t *testing.T) {
+	var syncs int
+	b := New(true, WithFS(newWrapFS(func(f File) File { return syncCountingFile{f, &syncs} })))
+	defer b.Remove()
+	check := func(step string, want int) {
+		t.Helper()
+		if syncs != want {
+			t.Errorf("%s: %d fsyncs, want %d", step, syncs, want)
+		}
+	}
+
+	b.Sync()
+	check("Sync of the new file", 0)
+	b.WriteString("abc")
+	for i := 0; i < 3; i++ {
+		if err := b.Sync(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check("Sync after a write", 1)
+	b.PrepareForReading()
+	check("PrepareForReading after Sync", 1)
+	b.WriteString("def")
+	b.PrepareForReading()
+	check("PrepareForReading after a write", 2)
+	BufferArray{b}.PrepareForReadingBatchSync()
+	check("batch sync", 2)
+	b.DropPrefix(1)
+	b.Close()
+	check("Close after DropPrefix", 3)
+}
+
+func TestNewSpill(t *testing.T) {
+	b := NewSpill(10)
+	defer b.Remove()
+	b.WriteString("0123456789")
+	if b.file != nil {
+		t.Fatal("moved to disk below the threshold")
+	}
+	b.WriteString("a")
+	if b.file == nil || b.data != nil {
+		t.Fatal("didn't move to disk above the threshold")
+	}
+	b.WriteString("bc")
+	b.PrepareForReading()
+	if got, _ := ioutil.ReadAll(b); string(got) != "0123456789abc" {
+		t.Errorf("got %q, want %q", got, "0123456789abc")
+	}
+}
+
+func TestSeekRewind(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		var _ io.ReadWriteSeeker = b
+		b.WriteString("contents")
+		for i := 0; i < 3; i++ {
+			if _, err := b.Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(b)
+			if err != nil || string(got) != "contents" {
+				t.Errorf("toDisk %v: pass %d: got (%q, %v)", toDisk, i, got, err)
+			}
+		}
+		b.Remove()
+	}
+}
+
+func TestReadFrom(t *testing.T) {
+	want := strings.Repeat("0123456789", 10000)
+	src, err := ioutil.TempFile(t.TempDir(), "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	src.WriteString(want)
+
+	for _, tc := range []struct {
+		name string
+		new  func() *Buffer
+	}{
+		{"ram", func() *Buffer { return New(false) }},
+		{"spill", func() *Buffer { return NewSpill(1000) }},
+		{"disk", func() *Buffer { return New(true) }},
+		{"blocks", func() *Buffer { return New(true, WithBlockSize(100)) }},
+		{"gzip", func() *Buffer { return New(true, WithGzip()) }},
+		{"memdisk", func() *Buffer { return NewMemDisk() }},
+	} {
+		for _, from := range []string{"reader", "file"} {
+			b := tc.new()
+			b.WriteString("x")
+			var r io.Reader = strings.NewReader(want)
+			if from == "file" {
+				src.Seek(0, io.SeekStart)
+				r = src
+			}
+			n, err := io.Copy(b, r)
+			if err != nil || n != int64(len(want)) {
+				t.Errorf("%s, from %s: got (%d, %v), want (%d, nil)", tc.name, from, n, err, len(want))
+			}
+			if b.Size() != int64(len(want))+1 {
+				t.Errorf("%s, from %s: Size %d, want %d", tc.name, from, b.Size(), len(want)+1)
+			}
+			// Hand the file over to an *os.File, and to a bytes.Buffer.
+			b.PrepareForReading()
+			b.Read(make([]byte, 1))
+			dst, err := ioutil.TempFile(t.TempDir(), "dst")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n, err := io.Copy(dst, io.LimitReader(b, 5000)); err != nil || n != 5000 {
+				t.Errorf("%s, from %s: LimitReader copy: got (%d, %v)", tc.name, from, n, err)
+			}
+			if n, err := b.WriteTo(dst); err != nil || n != int64(len(want))-5000 {
+				t.Errorf("%s, from %s: WriteTo a file: got (%d, %v)", tc.name, from, n, err)
+			}
+			dst.Seek(0, io.SeekStart)
+			got, _ := ioutil.ReadAll(dst)
+			dst.Close()
+			if string(got) != want {
+				t.Errorf("%s, from %s: the contents differ", tc.name, from)
+			}
+			b.Seek(1, io.SeekStart)
+			var buf bytes.Buffer
+			if b.WriteTo(&buf); buf.String() != want || !b.IsDrained() {
+				t.Errorf("%s, from %s: WriteTo a bytes.Buffer: the contents differ", tc.name, from)
+			}
+			b.Remove()
+		}
+	}
+}
+
+func TestBytesAndString(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		new  func() *Buffer
+	}{
+		{"ram", func() *Buffer { return New(false) }},
+		{"disk", func() *Buffer { return New(true) }},
+		{"blocks", func() *Buffer { return New(true, WithBlockSize(64)) }},
+		{"gzip", func() *Buffer { return New(true, WithGzip()) }},
+	} {
+		b := tc.new()
+		if got, err := b.Bytes(); err != nil || len(got) != 0 {
+			t.Errorf("%s: empty: got (%q, %v)", tc.name, got, err)
+		}
+		b.WriteString("hello, ")
+		if got, err := b.String(); err != nil || got != "hello, " {
+			t.Errorf("%s: got (%q, %v), want %q", tc.name, got, err, "hello, ")
+		}
+		// Bytes doesn't affect writing, nor the read offset.
+		b.WriteString("world")
+		b.PrepareForReading()
+		b.Read(make([]byte, 7))
+		got, err := b.Bytes()
+		if err != nil || string(got) != "hello, world" {
+			t.Errorf("%s: got (%q, %v), want %q", tc.name, got, err, "hello, world")
+		}
+		got[0] = 'j'
+		if rest, _ := ioutil.ReadAll(b); string(rest) != "world" {
+			t.Errorf("%s: Read after Bytes: got %q, want %q", tc.name, rest, "world")
+		}
+		b.Remove()
+		if _, err := b.Bytes(); err != ErrRemoved {
+			t.Errorf("%s: after Remove: got %v, want ErrRemoved", tc.name, err)
+		}
+	}
+}
+
+func TestBufferArrayContinuesOnError(t *testing.T) {
+	ba := NewArray(20, true)
+	for _, buf := range ba {
+		buf.WriteString("shard")
+	}
+	ba[3].Remove()
+	ba[11].Remove()
+	err := ba.PrepareForReading()
+	if !errors.Is(err, ErrRemoved) {
+		t.Errorf("got %v, want ErrRemoved", err)
+	}
+	if n := strings.Count(err.Error(), ErrRemoved.Error()); n != 2 {
+		t.Errorf("got %d errors, want 2: %v", n, err)
+	}
+	for i, buf := range ba {
+		if prepared := buf.InReadMode(); prepared == (i == 3 || i == 11) {
+			t.Errorf("buffer %d: got InReadMode %v", i, prepared)
+		}
+	}
+	if total := ba.TotalLen(); total != 18*5 {
+		t.Errorf("TotalLen: got %d, want %d", total, 18*5)
+	}
+	ba.Remove()
+	for i, buf := range ba {
+		if !buf.removed {
+			t.Errorf("buffer %d was not removed", i)
+		}
+	}
+}
+
+func TestBufferArrayReader(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		ba := NewArray(5, toDisk)
+		var want bytes.Buffer
+		for i, buf := range ba {
+			if i == 2 {
+				// Empty shards are skipped.
+				continue
+			}
+			marker := strings.Repeat(fmt.Sprintf("<shard %d>", i), 100*i+1)
+			buf.WriteString(marker)
+			want.WriteString(marker)
+		}
+		// Read in small chunks, to cross the shards.
+		got, err := ioutil.ReadAll(iotest.HalfReader(ba.Reader()))
+		if err != nil || !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("toDisk %v: Read: got %d bytes, %v, want %d bytes", toDisk, len(got), err, want.Len())
+		}
+		var copied bytes.Buffer
+		if n, err := io.Copy(&copied, ba.Reader()); err != nil || !bytes.Equal(copied.Bytes(), want.Bytes()) {
+			t.Errorf("toDisk %v: WriteTo: got (%d, %v), want %d bytes", toDisk, n, err, want.Len())
+		}
+		ba.Remove()
+	}
+}
+
+func TestFlush(t *testing.T) {
+	b := New(true, WithWriteBufferSize(1024))
+	defer b.Remove()
+	for _, s := range []string{"tiny", " writes", " held"} {
+		b.WriteString(s)
+	}
+	if info, _ := os.Stat(b.file.Name()); info.Size() != 0 {
+		t.Errorf("got %d bytes on disk before Flush, want 0", info.Size())
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(b.file.Name()); string(got) != "tiny writes held" {
+		t.Errorf("got %q on disk after Flush, want %q", got, "tiny writes held")
+	}
+	r := New(false)
+	defer r.Remove()
+	if err := r.Flush(); err != nil {
+		t.Errorf("RAM-backed: got %v, want nil", err)
+	}
+}
+
+func TestTruncateAndReset(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk, WithReadBufferSize(4))
+		b.WriteString("keep this, drop that")
+		if err := b.Truncate(9); err != nil {
+			t.Fatalf("toDisk %v: %v", toDisk, err)
+		}
+		b.WriteString("!")
+		if got, _ := b.String(); got != "keep this!" {
+			t.Errorf("toDisk %v: got %q, want %q", toDisk, got, "keep this!")
+		}
+
+		b.PrepareForReading()
+		p := make([]byte, 8)
+		b.Read(p)
+		if err := b.Truncate(4); err != nil {
+			t.Fatalf("toDisk %v: %v", toDisk, err)
+		}
+		if n, err := b.Read(p); n != 0 || err != io.EOF {
+			t.Errorf("toDisk %v: read past the truncation: got (%d, %v), want (0, EOF)", toDisk, n, err)
+		}
+		if err := b.Truncate(5); err != ErrInvalidSize {
+			t.Errorf("toDisk %v: got %v, want ErrInvalidSize", toDisk, err)
+		}
+
+		var name string
+		if toDisk {
+			name = b.file.Name()
+		}
+		if err := b.Reset(); err != nil {
+			t.Fatalf("toDisk %v: %v", toDisk, err)
+		}
+		if toDisk && b.file.Name() != name {
+			t.Errorf("got temp file %s after Reset, want %s kept", b.file.Name(), name)
+		}
+		b.WriteString("next")
+		if got, _ := b.String(); got != "next" || b.Size() != 4 {
+			t.Errorf("toDisk %v: got %q, want %q", toDisk, got, "next")
+		}
+		b.Remove()
+	}
+
+	b := New(false)
+	b.WriteString("shared bytes")
+	s := b.Snapshot()
+	b.Truncate(6)
+	b.WriteString(" again")
+	if got, _ := s.String(); got != "shared bytes" {
+		t.Errorf("snapshot: got %q, want %q", got, "shared bytes")
+	}
+	b.Remove()
+	s.Remove()
+}
+
+func TestBufferArraySpillToDisk(t *testing.T) {
+	ba := NewArray(3, false)
+	defer ba.Remove()
+	for _, b := range ba {
+		b.WriteString("in RAM")
+	}
+	var s Spiller = ba
+	if err := s.SpillToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range ba {
+		if got, _ := b.String(); b.Stats().Mode != "disk" || got != "in RAM" {
+			t.Errorf("buffer %d: got mode %s, contents %q, want %q on disk", i, b.Stats().Mode, got, "in RAM")
+		}
+	}
+}
+
+func TestJSONDecoder(t *testing.T) {
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		b.WriteString(`[{"id":1,"name":"a"},{"id":2,"name":"b"},{"id":3,"name":"c"}]`)
+		// JSONDecoder prepares the buffer for reading.
+		dec, err := b.JSONDecoder()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !b.InReadMode() {
+			t.Errorf("toDisk %v: not in read mode", toDisk)
+		}
+		// One element at a time.
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			t.Fatalf("toDisk %v: got %v, %v, want [", toDisk, tok, err)
+		}
+		var items []item
+		for dec.More() {
+			var it item
+			if err := dec.Decode(&it); err != nil {
+				t.Fatal(err)
+			}
+			items = append(items, it)
+		}
+		if want := []item{{1, "a"}, {2, "b"}, {3, "c"}}; fmt.Sprint(items) != fmt.Sprint(want) {
+			t.Errorf("toDisk %v: got %v, want %v", toDisk, items, want)
+		}
+
+		// Invalid JSON.
+		b.WriteString("{")
+		dec, err = b.JSONDecoder()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Errorf("toDisk %v: the first value: %v", toDisk, err)
+		}
+		if err := dec.Decode(&v); err != io.ErrUnexpectedEOF {
+			t.Errorf("toDisk %v: a truncated value: got %v, want io.ErrUnexpectedEOF", toDisk, err)
+		}
+		b.Remove()
+		if _, err := b.JSONDecoder(); err != ErrRemoved {
+			t.Errorf("toDisk %v: after Remove: got %v, want ErrRemoved", toDisk, err)
+		}
+	}
+}
+
+func TestLimitedWriter(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		w := b.LimitedWriter(10)
+		if n, err := w.Write([]byte("0123")); n != 4 || err != nil {
+			t.Errorf("toDisk %v: Write: got (%d, %v), want (4, nil)", toDisk, n, err)
+		}
+		if n, err := io.WriteString(w, "456"); n != 3 || err != nil {
+			t.Errorf("toDisk %v: WriteString: got (%d, %v), want (3, nil)", toDisk, n, err)
+		}
+		// Past the limit: what fits is written.
+		if n, err := w.Write([]byte("789abc")); n != 3 || err != ErrTooLarge {
+			t.Errorf("toDisk %v: Write past the limit: got (%d, %v), want (3, ErrTooLarge)", toDisk, n, err)
+		}
+		if n, err := io.WriteString(w, "d"); n != 0 || err != ErrTooLarge {
+			t.Errorf("toDisk %v: WriteString at the limit: got (%d, %v), want (0, ErrTooLarge)", toDisk, n, err)
+		}
+		if n, err := w.Write(nil); n != 0 || err != nil {
+			t.Errorf("toDisk %v: empty Write at the limit: got (%d, %v), want (0, nil)", toDisk, n, err)
+		}
+		if got, err := b.String(); err != nil || got != "0123456789" {
+			t.Errorf("toDisk %v: got %q, %v", toDisk, got, err)
+		}
+
+		// io.Copy of an untrusted stream.
+		b.ResetTo(toDisk)
+		n, err := io.Copy(b.LimitedWriter(100), strings.NewReader(strings.Repeat("x", 1000)))
+		if n != 100 || err != ErrTooLarge || b.Size() != 100 {
+			t.Errorf("toDisk %v: io.Copy: got (%d, %v), size %d, want (100, ErrTooLarge), 100", toDisk, n, err, b.Size())
+		}
+
+		if n, err := b.LimitedWriter(-1).Write([]byte("a")); n != 0 || err != ErrTooLarge {
+			t.Errorf("toDisk %v: negative limit: got (%d, %v), want (0, ErrTooLarge)", toDisk, n, err)
+		}
+
+		// The errors of the buffer are returned as is.
+		b.Remove()
+		if _, err := b.LimitedWriter(10).Write([]byte("a")); err != ErrRemoved {
+			t.Errorf("toDisk %v: after Remove: got %v, want ErrRemoved", toDisk, err)
+		}
+		if _, err := io.WriteString(b.LimitedWriter(10), "a"); err != ErrRemoved {
+			t.Errorf("toDisk %v: WriteString after Remove: got %v, want ErrRemoved", toDisk, err)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	want := strings.Repeat("0123456789", 100)
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		for i := 0; i < len(want); i += 30 {
+			end := i + 30
+			if end > len(want) {
+				end = len(want)
+			}
+			b.WriteString(want[i:end])
+		}
+		before := cap(b.data)
+		if !toDisk && before < len(want)+len(want)/2 {
+			t.Fatalf("got capacity %d, want some excess to release", before)
+		}
+		b.PrepareForReading()
+		p := make([]byte, 100)
+		b.ReadFull(p)
+		snapshot := b.Snapshot()
+
+		if err := b.Compact(); err != nil {
+			t.Fatal(err)
+		}
+		// Up to the size class of the allocation.
+		if !toDisk && (cap(b.data) >= before || cap(b.data) > len(want)+len(want)/8) {
+			t.Errorf("toDisk %v: got capacity %d, want about %d", toDisk, cap(b.data), len(want))
+		}
+		// The contents and the read offset are kept.
+		if b.Size() != int64(len(want)) || !b.InReadMode() {
+			t.Errorf("toDisk %v: got size %d, read mode %v", toDisk, b.Size(), b.InReadMode())
+		}
+		if rest, err := io.ReadAll(b); err != nil || string(rest) != want[100:] {
+			t.Errorf("toDisk %v: got %d bytes from the read offset, %v, want %d", toDisk, len(rest), err, len(want)-100)
+		}
+		// The writes after Compact don't reach the snapshot.
+		b.WriteString("more")
+		if got, err := snapshot.String(); err != nil || got != want {
+			t.Errorf("toDisk %v: snapshot: got %d bytes, %v, want %d", toDisk, len(got), err, len(want))
+		}
+		if got, err := b.String(); err != nil || got != want+"more" {
+			t.Errorf("toDisk %v: got %d bytes, %v, want %d", toDisk, len(got), err, len(want)+4)
+		}
+		snapshot.Remove()
+
+		// After dropping everything, the backing is released.
+		if err := b.DropPrefix(b.Size()); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Compact(); err != nil {
+			t.Fatal(err)
+		}
+		if b.data != nil {
+			t.Errorf("toDisk %v: got a backing of capacity %d for no contents", toDisk, cap(b.data))
+		}
+		b.Remove()
+		if err := b.Compact(); err != ErrRemoved {
+			t.Errorf("toDisk %v: after Remove: got %v, want ErrRemoved", toDisk, err)
+		}
+	}
+}
+
+func TestFreeMemory(t *testing.T) {
+	// RAM-backed buffers keep their contents.
+	b := New(false)
+	defer b.Remove()
+	b.WriteString("abc")
+	b.FreeMemory()
+	if got, err := b.String(); err != nil || got != "abc" {
+		t.Errorf("RAM-backed: got %q, %v, want %q", got, err, "abc")
+	}
+
+	// A buffer that spilled holds no RAM already.
+	s := NewSpill(10)
+	defer s.Remove()
+	s.WriteString(strings.Repeat("x", 100))
+	if !s.toDisk || s.data != nil {
+		t.Errorf("spilled: got toDisk %v, a backing of capacity %d", s.toDisk, cap(s.data))
+	}
+	s.FreeMemory()
+
+	// The leftover RAM of a disk-backed buffer is released.
+	d := New(true)
+	defer d.Remove()
+	d.WriteString("abc")
+	d.data = make([]byte, 0, 1000)
+	d.FreeMemory()
+	if d.data != nil {
+		t.Errorf("disk-backed: got a backing of capacity %d", cap(d.data))
+	}
+	if got, err := d.String(); err != nil || got != "abc" {
+		t.Errorf("disk-backed: got %q, %v, want %q", got, err, "abc")
+	}
+}
@@ -0,0 +1,92 @@
+package ramdiskbuffer
+
+import (
+	"os"
+)
+
+// DiskFullPolicy is what a buffer does when spilling to disk would leave
+// less free space than the minimum of WithMinFreeBytes
+// (see WithDiskFullPolicy).
+type DiskFullPolicy int
+
+const (
+	// DiskFullFail makes the spill fail with ErrInsufficientDiskSpace; the
+	// buffer stays RAM-backed, and the write that triggered it fails.
+	DiskFullFail DiskFullPolicy = iota
+	// DiskFullStayInRAM keeps the buffer in RAM, from then on:
+	// the spill does nothing, and the buffer doesn't spill anymore
+	// (see DidDegrade).
+	DiskFullStayInRAM
+	// DiskFullTryDirs spills to the first of the alternate directories
+	// that has enough free space, or fails like DiskFullFail if none has.
+	DiskFullTryDirs
+)
+
+// WithMinFreeBytes makes a RAM-backed buffer check, before spilling to disk
+// (see SpillToDisk, NewSpill and WithBudget), that the filesystem of its
+// temp directory keeps at least n bytes free once the contents are moved
+// there; otherwise, the buffer applies its disk-full policy (see
+// WithDiskFullPolicy), instead of failing midway when the disk fills up.
+//
+// The check is made only on the temp files of the OS filesystem (see
+// WithFS), and on linux; elsewhere the buffer spills as usual. It's a
+// pre-flight check: the writes after the spill can still fill the disk
+// (see WithSpillFallbackToMemory).
+func WithMinFreeBytes(n int64) Option {
+	return func(b *Buffer) {
+		b.minFreeBytes = n
+	}
+}
+
+// WithDiskFullPolicy sets what the buffer does when the check of
+// WithMinFreeBytes fails; the default is DiskFullFail. The dirs are the
+// alternate temp directories of DiskFullTryDirs, in order of preference.
+func WithDiskFullPolicy(policy DiskFullPolicy, dirs ...string) Option {
+	return func(b *Buffer) {
+		b.diskFullPolicy = policy
+		b.altTempDirs = dirs
+	}
+}
+
+// checkFreeSpace checks that spilling need bytes leaves enough free space
+// in the temp directory (see WithMinFreeBytes), applying the disk-full
+// policy if not. It reports whether the buffer must stay in RAM.
+func (b *Buffer) checkFreeSpace(need int64) (bool, error) {
+	if b.minFreeBytes <= 0 {
+		return false, nil
+	}
+	if _, ok := b.fs.(osFS); !ok {
+		return false, nil
+	}
+	if b.hasFreeSpace(b.tempDir, need) {
+		return false, nil
+	}
+	switch b.diskFullPolicy {
+	case DiskFullStayInRAM:
+		b.spills = false
+		b.degraded = true
+		return true, nil
+	case DiskFullTryDirs:
+		for _, dir := range b.altTempDirs {
+			if b.hasFreeSpace(dir, need) {
+				b.tempDir = dir
+				return false, nil
+			}
+		}
+	}
+	return false, ErrInsufficientDiskSpace
+}
+
+// hasFreeSpace reports whether the filesystem of dir (the default temp
+// directory if empty) keeps the minimum free space after writing need
+// bytes; if the free space can't be queried, it reports true.
+func (b *Buffer) hasFreeSpace(dir string, need int64) bool {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		return true
+	}
+	return free-need >= b.minFreeBytes
+}
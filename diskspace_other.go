@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package ramdiskbuffer
+
+// freeDiskSpace is not supported: the free space is not checked.
+func freeDiskSpace(dir string) (int64, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,47 @@
+package ramdiskbuffer
+
+import (
+	"math"
+	"runtime"
+	"testing"
+)
+
+func TestWithMinFreeBytes(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the free space is only checked on linux")
+	}
+	dir := t.TempDir()
+	const tooMuch = math.MaxInt64 / 2
+
+	b := NewSpill(4, WithTempDir(dir), WithMinFreeBytes(tooMuch))
+	if _, err := b.WriteString("0123456789"); err != ErrInsufficientDiskSpace {
+		t.Errorf("fail: got %v, want ErrInsufficientDiskSpace", err)
+	}
+	if b.Stats().Mode != "ram" || b.file != nil {
+		t.Errorf("fail: got mode %s, want the buffer left in RAM", b.Stats().Mode)
+	}
+	b.Remove()
+
+	b = NewSpill(4, WithTempDir(dir), WithMinFreeBytes(tooMuch), WithDiskFullPolicy(DiskFullStayInRAM))
+	for i := 0; i < 3; i++ {
+		if _, err := b.WriteString("0123456789"); err != nil {
+			t.Fatalf("stay in RAM: %v", err)
+		}
+	}
+	if !b.DidDegrade() || b.Stats().Mode != "ram" || b.Size() != 30 {
+		t.Errorf("stay in RAM: got degraded %v, mode %s, size %d, want 30 bytes in RAM", b.DidDegrade(), b.Stats().Mode, b.Size())
+	}
+	b.Remove()
+
+	b = NewSpill(4, WithTempDir(dir), WithMinFreeBytes(tooMuch), WithDiskFullPolicy(DiskFullTryDirs, t.TempDir()))
+	if _, err := b.WriteString("0123456789"); err != ErrInsufficientDiskSpace {
+		t.Errorf("try dirs: got %v, want ErrInsufficientDiskSpace", err)
+	}
+	b.Remove()
+
+	b = NewSpill(4, WithTempDir(dir), WithMinFreeBytes(1))
+	defer b.Remove()
+	if _, err := b.WriteString("0123456789"); err != nil || b.Stats().Mode != "disk" {
+		t.Errorf("enough space: got (%v, mode %s), want the buffer spilled", err, b.Stats().Mode)
+	}
+}
@@ -0,0 +1,211 @@
+package ramdiskbuffer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+)
+
+// encryptChunkSize is the maximum number of bytes sealed in a record
+// of an encrypted file (see WithEncryption).
+const encryptChunkSize = 64 * 1024
+
+// WithEncryption makes a disk-backed buffer encrypt the contents of its temp
+// file with AES-GCM, so that they are never written to the disk in clear,
+// including when a RAM-backed buffer spills (see NewSpill). The key must be
+// 16, 24 or 32 bytes long, to select AES-128, AES-192 or AES-256; otherwise
+// NewBuffer returns the error of aes.NewCipher (and New panics). If key is
+// nil, a random 32-byte key is generated for the buffer: its temp file can
+// only be read back by the buffer itself (and its clones).
+//
+// The contents are sealed in records of up to 64KiB, each with a random
+// nonce, so that reading authenticates them as it goes: a record that was
+// tampered with makes the read fail with ErrCorrupted. Each record is also
+// bound to its index in the stream of a write phase, and the last record of
+// the stream is marked as such, so that the records reordered, duplicated
+// or dropped, and the streams truncated on a record boundary, fail as well;
+// the streams of the successive write phases are authenticated each on
+// their own. It's a stage of the write and read pipelines (see WithWritePipeline), so it must be given after the options
+// that compress (see WithCompressor), since encrypted bytes don't compress.
+// It has no effect on RAM-backed buffers, and the mirror of a mirrored
+// buffer (see NewMirrored) is not encrypted.
+func WithEncryption(key []byte) Option {
+	return func(b *Buffer) {
+		k := key
+		if k == nil {
+			k = make([]byte, 32)
+			if _, err := io.ReadFull(rand.Reader, k); err != nil {
+				b.optErr = err
+				return
+			}
+		}
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			b.optErr = err
+			return
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			b.optErr = err
+			return
+		}
+		WithWritePipeline(func(w io.Writer) io.WriteCloser {
+			return &encryptWriter{aead: aead, w: w}
+		})(b)
+		WithReadPipeline(func(r io.Reader) io.Reader {
+			return &decryptReader{aead: aead, r: r}
+		})(b)
+	}
+}
+
+// encryptWriter seals the bytes written to it in records, written to w:
+// each record is the length of the rest of it, as a big-endian uint32
+// whose high bit is set for the last record of the stream (see
+// encryptFinal), then the nonce, and then the sealed chunk (with its tag).
+// The additional data of a record is its index in the stream, and whether
+// it's the last one (see recordAAD).
+type encryptWriter struct {
+	aead cipher.AEAD
+	w    io.Writer
+	// chunk holds the bytes not sealed yet, and record
+	// is reused for the records.
+	chunk  []byte
+	record []byte
+	// index is the index of the next record.
+	index uint64
+}
+
+// encryptFinal is the bit of the length of a record
+// that marks the last record of a stream.
+const encryptFinal = 1 << 31
+
+// recordAAD returns the additional data of the record index of a stream.
+func recordAAD(aad *[9]byte, index uint64, final bool) []byte {
+	binary.BigEndian.PutUint64(aad[:8], index)
+	aad[8] = 0
+	if final {
+		aad[8] = 1
+	}
+	return aad[:]
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if e.chunk == nil {
+			e.chunk = make([]byte, 0, encryptChunkSize)
+		}
+		m := copy(e.chunk[len(e.chunk):cap(e.chunk)], p)
+		e.chunk = e.chunk[:len(e.chunk)+m]
+		p = p[m:]
+		n += m
+		if len(e.chunk) == cap(e.chunk) {
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close seals the bytes held by e in the last record of the stream
+// (which may be empty), without closing w.
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+// seal writes the record of the bytes held by e;
+// final is true for the last record of the stream.
+func (e *encryptWriter) seal(final bool) error {
+	nonceSize := e.aead.NonceSize()
+	size := nonceSize + len(e.chunk) + e.aead.Overhead()
+	if cap(e.record) < 4+size {
+		e.record = make([]byte, 4+size)
+	}
+	record := e.record[:4+nonceSize]
+	prefix := uint32(size)
+	if final {
+		prefix |= encryptFinal
+	}
+	binary.BigEndian.PutUint32(record, prefix)
+	nonce := record[4:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	var aad [9]byte
+	record = e.aead.Seal(record, nonce, e.chunk, recordAAD(&aad, e.index, final))
+	e.index++
+	e.chunk = e.chunk[:0]
+	_, err := e.w.Write(record)
+	return err
+}
+
+// decryptReader opens the records read from r (see encryptWriter);
+// the concatenated streams of records are read as one.
+type decryptReader struct {
+	aead cipher.AEAD
+	r    io.Reader
+	// plain is the rest of the record opened last, and record
+	// is reused for the records.
+	plain  []byte
+	record []byte
+	err    error
+	// index is the index of the next record in its stream: a stream
+	// is pending while its last record hasn't been opened.
+	index uint64
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.open()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open reads the next record, and opens it into plain.
+func (d *decryptReader) open() error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(d.r, prefix[:]); err != nil {
+		if err == io.EOF && d.index > 0 {
+			// The stream was truncated.
+			return ErrCorrupted
+		}
+		// io.EOF if there are no more records.
+		return err
+	}
+	final := binary.BigEndian.Uint32(prefix[:])&encryptFinal != 0
+	size := int(binary.BigEndian.Uint32(prefix[:]) &^ encryptFinal)
+	nonceSize := d.aead.NonceSize()
+	if size < nonceSize+d.aead.Overhead() || size > nonceSize+encryptChunkSize+d.aead.Overhead() {
+		return ErrCorrupted
+	}
+	if cap(d.record) < size {
+		d.record = make([]byte, size)
+	}
+	record := d.record[:size]
+	if _, err := io.ReadFull(d.r, record); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	var aad [9]byte
+	plain, err := d.aead.Open(record[nonceSize:nonceSize], record[:nonceSize], record[nonceSize:], recordAAD(&aad, d.index, final))
+	if err != nil {
+		return ErrCorrupted
+	}
+	d.index++
+	if final {
+		// The next record starts the stream of the next write phase.
+		d.index = 0
+	}
+	d.plain = plain
+	return nil
+}
@@ -0,0 +1,123 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	secret := strings.Repeat("secret payload ", 10000)
+	for _, tc := range []struct {
+		name string
+		new  func() *Buffer
+	}{
+		{"disk", func() *Buffer { return New(true, WithEncryption(key)) }},
+		{"random key", func() *Buffer { return New(true, WithEncryption(nil)) }},
+		{"spill", func() *Buffer { return NewSpill(100, WithEncryption(key)) }},
+		{"gzip", func() *Buffer { return New(true, WithGzip(), WithEncryption(key)) }},
+	} {
+		b := tc.new()
+		b.WriteString(secret)
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+		onDisk, err := os.ReadFile(b.file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(onDisk, []byte("secret")) {
+			t.Errorf("%s: the temp file has the contents in clear", tc.name)
+		}
+		got, err := io.ReadAll(b)
+		if err != nil || string(got) != secret {
+			t.Errorf("%s: got %d bytes, %v, want %d bytes", tc.name, len(got), err, len(secret))
+		}
+		// The writes after PrepareForReading append a new stream.
+		b.WriteString("more")
+		if got, err := b.String(); err != nil || got != secret+"more" {
+			t.Errorf("%s: got %d bytes, %v, want %d bytes", tc.name, len(got), err, len(secret)+4)
+		}
+		b.Remove()
+	}
+}
+
+func TestEncryptionInvalidKey(t *testing.T) {
+	if _, err := NewBuffer(true, WithEncryption([]byte("short"))); err == nil {
+		t.Error("got no error for a 5-byte key")
+	}
+}
+
+func TestEncryptionCorrupted(t *testing.T) {
+	b := New(true, WithEncryption(nil))
+	defer b.Remove()
+	b.WriteString(strings.Repeat("x", 1000))
+	if err := b.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	// Flip the last byte of the file, in the tag of the last record.
+	fi, err := b.file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := make([]byte, 1)
+	b.file.ReadAt(c, fi.Size()-1)
+	c[0] ^= 1
+	if _, err := b.file.WriteAt(c, fi.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(b); err != ErrCorrupted {
+		t.Errorf("got %v, want ErrCorrupted", err)
+	}
+}
+
+func TestEncryptionRecordsBound(t *testing.T) {
+	// splitRecords returns the header and the records of an encrypted file.
+	splitRecords := func(file []byte) (header []byte, records [][]byte) {
+		header, file = file[:len(transformedMagic)+1], file[len(transformedMagic)+1:]
+		for len(file) > 0 {
+			size := 4 + int(binary.BigEndian.Uint32(file)&^encryptFinal)
+			records = append(records, file[:size])
+			file = file[size:]
+		}
+		return header, records
+	}
+	for _, tc := range []struct {
+		name   string
+		tamper func([][]byte) [][]byte
+	}{
+		{"swap", func(r [][]byte) [][]byte { return [][]byte{r[1], r[0], r[2]} }},
+		{"drop the last", func(r [][]byte) [][]byte { return r[:2] }},
+		{"drop the first", func(r [][]byte) [][]byte { return r[1:] }},
+		{"duplicate", func(r [][]byte) [][]byte { return [][]byte{r[0], r[0], r[1], r[2]} }},
+	} {
+		b := New(true, WithEncryption(nil))
+		b.WriteString(strings.Repeat("x", 2*encryptChunkSize+1000))
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.ReadFile(b.file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, records := splitRecords(file)
+		if len(records) != 3 {
+			t.Fatalf("got %d records, want 3", len(records))
+		}
+		tampered := bytes.Join(append([][]byte{header}, tc.tamper(records)...), nil)
+		if err := os.WriteFile(b.file.Name(), tampered, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(b); err != ErrCorrupted {
+			t.Errorf("%s: got %v, want ErrCorrupted", tc.name, err)
+		}
+		b.Remove()
+	}
+}
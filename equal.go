@@ -0,0 +1,89 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io"
+)
+
+// equalBlockSize is the size of the blocks compared by Equal.
+const equalBlockSize = 32 * 1024
+
+// Equal reports whether b and other have the same contents. The lengths are
+// compared first, without reading anything; then the contents are streamed
+// from the beginning, a block at a time, until the first difference, via new
+// readers (see Reader), so that the read offsets of the buffers are not
+// affected. Sink buffers can't be compared.
+func (b *Buffer) Equal(other *Buffer) (bool, error) {
+	if b.removed || other.removed {
+		return false, ErrRemoved
+	}
+	if b == other {
+		return true, nil
+	}
+	if b.Size() != other.Size() {
+		return false, nil
+	}
+	if b.file == nil && !b.toDisk && other.file == nil && !other.toDisk && b.sink == nil && other.sink == nil {
+		return bytes.Equal(b.data, other.data), nil
+	}
+
+	r1, err := b.Reader()
+	if err != nil {
+		return false, err
+	}
+	if c, ok := r1.(io.Closer); ok {
+		defer c.Close()
+	}
+	r2, err := other.Reader()
+	if err != nil {
+		return false, err
+	}
+	if c, ok := r2.(io.Closer); ok {
+		defer c.Close()
+	}
+	return equalReaders(r1, r2)
+}
+
+// EqualReader reports whether the contents of b are the bytes of r (until
+// its io.EOF), e.g. to check a buffer against a canonical source without
+// loading either one fully. The contents are streamed from the beginning,
+// via a new reader (see Reader), alongside r, a block at a time, until the
+// first difference: the read offset of b is not affected, but r is consumed
+// up to there. Sink buffers can't be compared.
+func (b *Buffer) EqualReader(r io.Reader) (bool, error) {
+	if b.removed {
+		return false, ErrRemoved
+	}
+	br, err := b.Reader()
+	if err != nil {
+		return false, err
+	}
+	if c, ok := br.(io.Closer); ok {
+		defer c.Close()
+	}
+	return equalReaders(br, r)
+}
+
+// equalReaders reports whether r1 and r2 return the same bytes,
+// reading them a block at a time until the first difference.
+func equalReaders(r1, r2 io.Reader) (bool, error) {
+	block1 := make([]byte, equalBlockSize)
+	block2 := make([]byte, equalBlockSize)
+	for {
+		n1, err1 := io.ReadFull(r1, block1)
+		n2, err2 := io.ReadFull(r2, block2)
+		if err1 != nil && err1 != io.EOF && err1 != io.ErrUnexpectedEOF {
+			return false, err1
+		}
+		if err2 != nil && err2 != io.EOF && err2 != io.ErrUnexpectedEOF {
+			return false, err2
+		}
+		if n1 != n2 || !bytes.Equal(block1[:n1], block2[:n2]) {
+			return false, nil
+		}
+		if n1 < len(block1) {
+			// Both ended, with the same bytes.
+			return true, nil
+		}
+	}
+}
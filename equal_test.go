@@ -0,0 +1,40 @@
+package ramdiskbuffer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEqualReader(t *testing.T) {
+	contents := strings.Repeat("0123456789", 10000)
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		b.WriteString(contents)
+		b.PrepareForReading()
+		b.Read(make([]byte, 5))
+		for _, tc := range []struct {
+			other string
+			want  bool
+		}{
+			{contents, true},
+			{contents[:len(contents)-1], false},
+			{contents + "x", false},
+			{contents[:50000] + "x" + contents[50001:], false},
+			{"", false},
+		} {
+			if got, err := b.EqualReader(strings.NewReader(tc.other)); err != nil || got != tc.want {
+				t.Errorf("toDisk %v, %d bytes: got (%v, %v), want %v", toDisk, len(tc.other), got, err, tc.want)
+			}
+		}
+		if b.ReadProgress() != 5 {
+			t.Errorf("toDisk %v: read offset moved to %d", toDisk, b.ReadProgress())
+		}
+		b.Remove()
+	}
+
+	empty := New(true)
+	defer empty.Remove()
+	if got, err := empty.EqualReader(strings.NewReader("")); err != nil || !got {
+		t.Errorf("empty: got (%v, %v), want true", got, err)
+	}
+}
@@ -0,0 +1,47 @@
+package ramdiskbuffer
+
+import (
+	"sync/atomic"
+)
+
+// errorHandlerHolder wraps the handler, for atomic.Value.
+type errorHandlerHolder struct {
+	h func(err error)
+}
+
+var errorHandler atomic.Value // errorHandlerHolder
+
+// SetErrorHandler makes the constructors that panic when a buffer can't be
+// created (New, NewSink, NewMirrored, Snapshot, and those built on them,
+// like NewSpill and NewArray) call h with the error instead, e.g. to log
+// a full disk or EMFILE, and return a failed buffer: all its operations
+// return the error (or ErrRemoved), as if it was removed, and its Size is 0.
+// This keeps the code embedded in servers from crashing on I/O failures,
+// without switching to the constructors returning errors (NewBuffer,
+// NewSinkBuffer, NewMirroredBuffer, SnapshotBuffer). nil (the default)
+// restores the panics.
+//
+// Writes to RAM-backed buffers still panic with bytes.ErrTooLarge
+// if the RAM can't be allocated, like bytes.Buffer.
+func SetErrorHandler(h func(err error)) {
+	errorHandler.Store(errorHandlerHolder{h})
+}
+
+// mustBuffer returns b if err is nil; otherwise, it panics with err,
+// or reports err to the error handler (see SetErrorHandler) and returns
+// a failed buffer.
+func mustBuffer(b *Buffer, err error) *Buffer {
+	if err == nil {
+		return b
+	}
+	holder, _ := errorHandler.Load().(errorHandlerHolder)
+	if holder.h == nil {
+		panic(err)
+	}
+	holder.h(err)
+	return &Buffer{
+		fs:      osFS{},
+		removed: true,
+		failed:  err,
+	}
+}
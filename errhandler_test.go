@@ -0,0 +1,40 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetErrorHandler(t *testing.T) {
+	missing := WithTempDir(filepath.Join(t.TempDir(), "missing"))
+	var handled []error
+	SetErrorHandler(func(err error) { handled = append(handled, err) })
+	defer SetErrorHandler(nil)
+
+	b := New(true, missing)
+	m := NewMirrored(missing)
+	if len(handled) != 2 || !errors.Is(handled[0], os.ErrNotExist) {
+		t.Fatalf("got %v, want the errors of creating the temp files", handled)
+	}
+	for _, b := range []*Buffer{b, m} {
+		if _, err := b.WriteString("x"); err != handled[0] && err != handled[1] {
+			t.Errorf("got %v, want the error of creating the buffer", err)
+		}
+		if b.Size() != 0 || b.State() != StateRemoved {
+			t.Errorf("got size %d, state %v, want a failed buffer", b.Size(), b.State())
+		}
+		if err := b.Remove(); err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+	}
+
+	SetErrorHandler(nil)
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("got no panic without an error handler")
+		}
+	}()
+	New(true, missing)
+}
@@ -0,0 +1,51 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+)
+
+var (
+	// ErrUnsupported is returned when an operation is not supported
+	// by the kind of buffer it's called on.
+	ErrUnsupported = errors.New("ramdiskbuffer: operation not supported by this buffer")
+	// ErrRemoved is returned when a buffer is used after Remove.
+	ErrRemoved = errors.New("ramdiskbuffer: buffer has been removed")
+	// ErrNotPrepared is returned when an operation that needs the buffer
+	// to be in read mode is called before PrepareForReading.
+	ErrNotPrepared = errors.New("ramdiskbuffer: buffer not prepared for reading")
+	// ErrTooLarge is returned when a write would make the buffer
+	// go past its configured limit.
+	ErrTooLarge = errors.New("ramdiskbuffer: too large")
+	// ErrNotSeekable is returned by PrepareForReading when the backing
+	// of the buffer can't be rewound.
+	ErrNotSeekable = errors.New("ramdiskbuffer: backing is not seekable")
+	// ErrInvalidSize is returned when a size given to a method
+	// is negative, or out of the range it allows.
+	ErrInvalidSize = errors.New("ramdiskbuffer: invalid size")
+	// ErrWriteClosed is returned when a buffer is written to
+	// after CloseWrite.
+	ErrWriteClosed = errors.New("ramdiskbuffer: write after CloseWrite")
+	// ErrAlreadyClosed is returned when a buffer is used after Close,
+	// but for Remove (see State).
+	ErrAlreadyClosed = errors.New("ramdiskbuffer: buffer has been closed")
+	// ErrWriteAfterRead is returned when a buffer created with
+	// WithStrictLifecycle is written after PrepareForReading.
+	ErrWriteAfterRead = errors.New("ramdiskbuffer: write after PrepareForReading")
+	// ErrTooManyOpenFiles is returned when a temp file can't be created
+	// because of the limit of SetMaxOpenFiles (see WithoutOpenFileWait).
+	ErrTooManyOpenFiles = errors.New("ramdiskbuffer: too many open temp files")
+	// ErrInsufficientDiskSpace is returned when spilling a buffer to disk
+	// would leave less free space than its minimum (see WithMinFreeBytes).
+	ErrInsufficientDiskSpace = errors.New("ramdiskbuffer: insufficient disk space")
+	// ErrNotRestorable is returned by Marshal for the buffers that are
+	// not disk-backed, whose contents can't survive the process.
+	ErrNotRestorable = errors.New("ramdiskbuffer: buffer is not disk-backed, it can't be restored")
+	// ErrTooManyBuffers is returned when a buffer can't be created
+	// because of the limit of SetMaxLiveBuffers.
+	ErrTooManyBuffers = errors.New("ramdiskbuffer: too many live buffers")
+	// ErrCorrupted is returned when reading an encrypted temp file
+	// (see WithEncryption) fails to authenticate its contents, when
+	// a transformed temp file (see WithWritePipeline) lost its header,
+	// and when the contents of a buffer don't match a sum (see Verify).
+	ErrCorrupted = errors.New("ramdiskbuffer: temp file is corrupted")
+)
@@ -0,0 +1,69 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"syscall"
+)
+
+// WithSpillFallbackToMemory makes a disk-backed buffer degrade to RAM when
+// a write to its temp file fails because the disk is full (ENOSPC), instead
+// of failing: the contents written so far are read back from the temp file
+// into RAM, the temp file is removed, and the write completes in RAM; from
+// then on, the buffer is RAM-backed (see DidDegrade). If the contents can't
+// be moved to RAM, the write fails with the error of the disk.
+//
+// Transformed buffers (see WithWritePipeline), whose temp file doesn't hold
+// the contents as written, don't degrade.
+func WithSpillFallbackToMemory() Option {
+	return func(b *Buffer) {
+		b.memFallback = true
+	}
+}
+
+// DidDegrade reports whether the buffer moved from disk to RAM because the
+// disk was full (see WithSpillFallbackToMemory), or stayed in RAM for lack
+// of disk space (see DiskFullStayInRAM).
+func (b *Buffer) DidDegrade() bool {
+	return b.degraded
+}
+
+// degradeToMemory moves the contents of the buffer to RAM if err is
+// a disk-full error and the buffer can fall back to RAM; it reports
+// whether it did.
+func (b *Buffer) degradeToMemory(err error) bool {
+	if !b.memFallback || !errors.Is(err, syscall.ENOSPC) || b.transformed() {
+		return false
+	}
+	size := b.length.Load()
+	if int64(int(size)) != size {
+		return false
+	}
+	// The write buffer (see WithBlockSize) holds the end of the contents,
+	// which didn't reach the file.
+	onFile := size - int64(len(b.wbuf))
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(b.file, 0, onFile), data[:onFile]); err != nil {
+		return false
+	}
+	copy(data[onFile:], b.wbuf)
+
+	b.file.Close()
+	b.releaseFileSlot()
+	b.fs.Remove(b.file.Name())
+	b.file = nil
+	b.wbuf = nil
+	b.br = nil
+	b.dirty = false
+	b.toDisk = false
+	// Don't spill again (see NewFromSlice).
+	b.spills = false
+	b.data = data
+	b.degraded = true
+	atomic.AddInt64(&diskBytes, -size)
+	atomic.AddInt64(&ramBytes, size)
+	b.budget.add(size)
+	b.updateRegistry()
+	return true
+}
@@ -0,0 +1,70 @@
+package ramdiskbuffer
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// fullFile is a File on a disk that's full after room bytes.
+type fullFile struct {
+	File
+	room *int
+}
+
+func (f fullFile) Write(p []byte) (int, error) {
+	if len(p) <= *f.room {
+		*f.room -= len(p)
+		return f.File.Write(p)
+	}
+	n, _ := f.File.Write(p[:*f.room])
+	*f.room = 0
+	return n, &os.PathError{Op: "write", Path: f.Name(), Err: syscall.ENOSPC}
+}
+
+func (f fullFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func TestSpillFallbackToMemory(t *testing.T) {
+	want := strings.Repeat("0123456789", 100)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"file", nil},
+		{"blocks", []Option{WithBlockSize(64)}},
+	} {
+		room := 345
+		fsys := newWrapFS(func(f File) File { return fullFile{f, &room} })
+		b := New(true, append([]Option{WithFS(fsys), WithSpillFallbackToMemory()}, tc.opts...)...)
+		name := b.file.Name()
+		for i := 0; i < len(want); i += 100 {
+			if n, err := b.WriteString(want[i : i+100]); n != 100 || err != nil {
+				t.Fatalf("%s: got (%d, %v), want (100, nil)", tc.name, n, err)
+			}
+		}
+		if !b.DidDegrade() || b.file != nil {
+			t.Errorf("%s: the buffer didn't degrade to RAM", tc.name)
+		}
+		if _, err := fsys.Open(name); err == nil {
+			t.Errorf("%s: the temp file was not removed", tc.name)
+		}
+		b.PrepareForReading()
+		got, err := ioutil.ReadAll(b)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got (%q, %v), want %q", tc.name, got, err, want)
+		}
+		b.Remove()
+	}
+
+	// Without the option, the error is returned.
+	room := 10
+	b := New(true, WithFS(newWrapFS(func(f File) File { return fullFile{f, &room} })))
+	defer b.Remove()
+	if n, err := b.WriteString(want); n != 10 || err == nil {
+		t.Errorf("without fallback: got (%d, %v), want (10, ENOSPC)", n, err)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build linux
+// +build linux
+
+package ramdiskbuffer
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// preallocate allocates the disk space for n bytes of f from offset off,
+// without changing its size, if f is an OS file on a filesystem that
+// supports it; otherwise it does nothing. If off+n is past the maximum
+// file size of the filesystem, ErrInvalidSize is returned.
+func preallocate(f File, off, n int64) error {
+	fd, ok := f.(fder)
+	if !ok {
+		return nil
+	}
+	for {
+		err := unix.Fallocate(int(fd.Fd()), unix.FALLOC_FL_KEEP_SIZE, off, n)
+		switch err {
+		case unix.EINTR:
+			continue
+		case unix.EOPNOTSUPP, unix.ENOSYS:
+			return nil
+		case unix.EFBIG:
+			return ErrInvalidSize
+		}
+		return err
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package ramdiskbuffer
+
+// preallocate does nothing: preallocating without changing the size
+// of a file is supported only on linux.
+func preallocate(f File, off, n int64) error {
+	return nil
+}
@@ -0,0 +1,116 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// The file cache keeps the temp files of removed buffers,
+// for reuse by the next disk-backed buffers (see SetFileCacheSize).
+var fileCache struct {
+	mu    sync.Mutex
+	size  int
+	files []cachedFile
+}
+
+type cachedFile struct {
+	dir, pattern string
+	file         File
+}
+
+// SetFileCacheSize sets the maximum number of temp files kept for reuse:
+// when a disk-backed buffer is removed, its temp file is truncated and
+// kept, instead of being unlinked, if fewer than n are kept; the next
+// disk-backed buffer created in the same directory (and with the same
+// suffix, see WithSuffix) reuses it, instead of
+// creating a new one. This saves the syscalls of creating and unlinking
+// temp files, when buffers are created and removed at a high rate.
+// The default is 0: no file is kept. Lowering the size releases the
+// files in excess.
+//
+// Only the temp files of the OS filesystem are kept (see WithFS).
+// A reused file keeps its name: the readers of a removed buffer (see
+// Reader and TailReader) must be closed before it's removed.
+func SetFileCacheSize(n int) error {
+	if n < 0 {
+		n = 0
+	}
+	fileCache.mu.Lock()
+	fileCache.size = n
+	var excess []cachedFile
+	if len(fileCache.files) > n {
+		excess = fileCache.files[n:]
+		fileCache.files = fileCache.files[:n:n]
+	}
+	fileCache.mu.Unlock()
+	return removeCachedFiles(excess)
+}
+
+// DrainFileCache closes and unlinks all the temp files kept for reuse
+// (see SetFileCacheSize), e.g. at shutdown.
+func DrainFileCache() error {
+	fileCache.mu.Lock()
+	files := fileCache.files
+	fileCache.files = nil
+	fileCache.mu.Unlock()
+	return removeCachedFiles(files)
+}
+
+func removeCachedFiles(files []cachedFile) error {
+	var err error
+	for _, f := range files {
+		f.file.Close()
+		if rerr := os.Remove(f.file.Name()); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// cachedFile returns a temp file from the cache, truncated and at offset 0,
+// if the buffer can use it; otherwise it returns nil.
+func (b *Buffer) cachedFile() File {
+	if _, ok := b.fs.(osFS); !ok {
+		return nil
+	}
+	fileCache.mu.Lock()
+	defer fileCache.mu.Unlock()
+	for i := len(fileCache.files) - 1; i >= 0; i-- {
+		if f := fileCache.files[i]; f.dir == b.tempDir && f.pattern == b.tempPattern() {
+			fileCache.files = append(fileCache.files[:i], fileCache.files[i+1:]...)
+			return f.file
+		}
+	}
+	return nil
+}
+
+// cacheFile truncates the temp file of a removed buffer, and puts it in
+// the cache, if there's room; it reports whether it did. Once cached, the
+// file isn't the buffer's anymore.
+func (b *Buffer) cacheFile() bool {
+	if _, ok := b.fs.(osFS); !ok {
+		return false
+	}
+	fileCache.mu.Lock()
+	full := len(fileCache.files) >= fileCache.size
+	fileCache.mu.Unlock()
+	if full {
+		return false
+	}
+	if err := b.file.Truncate(0); err != nil {
+		return false
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+
+	fileCache.mu.Lock()
+	defer fileCache.mu.Unlock()
+	if len(fileCache.files) >= fileCache.size {
+		return false
+	}
+	fileCache.files = append(fileCache.files, cachedFile{b.tempDir, b.tempPattern(), b.file})
+	b.file = nil
+	return true
+}
@@ -0,0 +1,54 @@
+package ramdiskbuffer
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// frameHeaderLen is the length of the prefix of a frame (see WriteFrame).
+const frameHeaderLen = 4
+
+// WriteFrame appends p to the buffer as a frame: a 4-byte big-endian length
+// prefix, followed by p (e.g. a serialized protobuf message). The frames can
+// be read back, in order, by ReadFrame. If p is longer than 4GiB-1 bytes,
+// the maximum length of a frame, ErrInvalidSize is returned.
+func (b *Buffer) WriteFrame(p []byte) error {
+	if int64(len(p)) > math.MaxUint32 {
+		return ErrInvalidSize
+	}
+	var header [frameHeaderLen]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(p)))
+	if _, err := b.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := b.Write(p)
+	return err
+}
+
+// ReadFrame reads the next frame written by WriteFrame from the read offset,
+// and returns its contents. At the end of the contents, it returns io.EOF;
+// if the contents end within a frame (or its prefix), it returns
+// io.ErrUnexpectedEOF.
+func (b *Buffer) ReadFrame() ([]byte, error) {
+	var header [frameHeaderLen]byte
+	if _, err := b.ReadFull(header[:]); err != nil {
+		return nil, err
+	}
+	n := int64(binary.BigEndian.Uint32(header[:]))
+	if n > b.Remaining() {
+		// Truncated: don't allocate for what's not there.
+		if _, err := io.Copy(io.Discard, io.LimitReader(b, b.Remaining())); err != nil {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := make([]byte, n)
+	if _, err := b.ReadFull(p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return p, nil
+}
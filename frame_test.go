@@ -0,0 +1,54 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestFrames(t *testing.T) {
+	frames := [][]byte{[]byte("first"), {}, bytes.Repeat([]byte("x"), 100000), []byte("last")}
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		for _, frame := range frames {
+			if err := b.WriteFrame(frame); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range frames {
+			got, err := b.ReadFrame()
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("toDisk %v: frame %d: got (%d bytes, %v), want %d bytes", toDisk, i, len(got), err, len(want))
+			}
+		}
+		if _, err := b.ReadFrame(); err != io.EOF {
+			t.Errorf("toDisk %v: at the end: got %v, want io.EOF", toDisk, err)
+		}
+		b.Remove()
+	}
+}
+
+func TestTruncatedFrames(t *testing.T) {
+	var frame bytes.Buffer
+	b := New(false)
+	b.WriteFrame([]byte("contents"))
+	b.PrepareForReading()
+	b.WriteTo(&frame)
+	b.Remove()
+
+	for _, n := range []int{1, 3, 4, 5, frame.Len() - 1} {
+		b := New(true)
+		b.Write(frame.Bytes()[:n])
+		b.PrepareForReading()
+		if _, err := b.ReadFrame(); err != io.ErrUnexpectedEOF {
+			t.Errorf("%d bytes: got %v, want io.ErrUnexpectedEOF", n, err)
+		}
+		if _, err := b.ReadFrame(); err != io.EOF {
+			t.Errorf("%d bytes: after the truncated frame: got %v, want io.EOF", n, err)
+		}
+		b.Remove()
+	}
+}
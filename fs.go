@@ -0,0 +1,97 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// File is the file used as the backing of a disk-backed buffer.
+// *os.File implements it.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.WriterAt
+	io.StringWriter
+	io.Seeker
+	io.Closer
+
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// FS is the filesystem used by disk-backed buffers to create,
+// open and remove their temp files.
+// The default is the OS filesystem; it can be changed via WithFS.
+type FS interface {
+	// CreateTemp creates a new temp file in the directory dir
+	// (the default temp directory if empty), opened for reading and writing,
+	// with a name obtained as described in os.CreateTemp.
+	CreateTemp(dir, pattern string) (File, error)
+	// Open opens the named file for reading.
+	Open(name string) (File, error)
+	// Remove removes the named file.
+	Remove(name string) error
+}
+
+// OSFS returns the FS backed by the OS filesystem.
+func OSFS() FS {
+	return osFS{}
+}
+
+type osFS struct{}
+
+func (osFS) CreateTemp(dir, pattern string) (File, error) {
+	return ioutil.TempFile(dir, pattern)
+}
+
+func (osFS) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) SyncDir(dir string) error {
+	return syncDir(dir)
+}
+
+// dirSyncer is implemented by the filesystems that support
+// fsyncing a directory (see WithDurableDir).
+type dirSyncer interface {
+	SyncDir(dir string) error
+}
+
+// syncDir fsyncs the directory dir (of the OS filesystem), so that
+// the creation or renaming of files in it is durable.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// Directories can't be fsynced on windows,
+		// and their entries are durable anyway.
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+// syncParentDir fsyncs the directory containing the named file,
+// if fsys supports it.
+func syncParentDir(fsys FS, name string) error {
+	if s, ok := fsys.(dirSyncer); ok {
+		return s.SyncDir(filepath.Dir(name))
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package ramdiskbuffer
+
+// wrapFS is an in-memory FS (see NewMemFS) whose temp files
+// are wrapped by wrap, e.g. to inject delays or faults.
+type wrapFS struct {
+	FS
+	wrap func(File) File
+}
+
+func newWrapFS(wrap func(File) File) wrapFS {
+	return wrapFS{FS: NewMemFS(), wrap: wrap}
+}
+
+func (fsys wrapFS) CreateTemp(dir, pattern string) (File, error) {
+	f, err := fsys.FS.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.wrap(f), nil
+}
@@ -1,3 +1,5 @@
 module github.com/gagliardetto/ramdiskbuffer
 
-go 1.16
+go 1.20
+
+require golang.org/x/sys v0.15.0
@@ -0,0 +1,98 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"hash"
+	"io"
+)
+
+// WithReadHash makes the buffer hash with h the bytes returned by Read,
+// as they're consumed; the sum is returned by ReadSum. This lets a
+// streaming consumer verify what it actually read, without a separate pass.
+//
+// The hash is reset by PrepareForReading, so it covers the bytes read since
+// then, in order: it's meaningful only for sequential reads. The reads that
+// don't go through Read (e.g. via the readers returned by Reader) are not
+// hashed.
+func WithReadHash(h hash.Hash) Option {
+	return func(b *Buffer) {
+		b.readHash = h
+	}
+}
+
+// WithHash makes the buffer hash the bytes written to it, as they're
+// written, with a hash returned by newHash (e.g. sha256.New): the sum of the
+// contents is returned by Sum, without a second pass over them, and Verify
+// checks that the contents still match a sum. ResetTo resets the hash.
+//
+// Since the hash covers the bytes in the order they're appended, WriteAt
+// (and the methods that use it, like ReservePlaceholder) and DropPrefix
+// return ErrUnsupported. The clones and snapshots of the buffer hash their
+// own contents.
+func WithHash(newHash func() hash.Hash) Option {
+	return func(b *Buffer) {
+		b.newHash = newHash
+		b.writeHash = newHash()
+	}
+}
+
+// hashWritten adds the first n bytes of p, or of s if p is nil,
+// to the write hash, if any (see WithHash).
+func (b *Buffer) hashWritten(p []byte, s string, n int) {
+	if b.writeHash == nil || n <= 0 {
+		return
+	}
+	if p != nil {
+		b.writeHash.Write(p[:n])
+	} else {
+		io.WriteString(b.writeHash, s[:n])
+	}
+}
+
+// Sum returns the sum of the contents of the buffer (see WithHash),
+// or nil if the buffer has no hash.
+func (b *Buffer) Sum() []byte {
+	if b.writeHash == nil {
+		return nil
+	}
+	return b.writeHash.Sum(nil)
+}
+
+// Verify reads the contents of the buffer back (via a new reader, see
+// Reader), hashes them with a new hash of WithHash, and returns ErrCorrupted
+// if the sum is not expected (e.g. the sum returned by Sum, or one received
+// with the data): for a disk-backed buffer, it detects the corruption of its
+// temp file before the contents are consumed. Buffers without a hash, and
+// sinks, don't support it.
+func (b *Buffer) Verify(expected []byte) error {
+	if b.removed {
+		return ErrRemoved
+	}
+	if b.newHash == nil {
+		return ErrUnsupported
+	}
+	r, err := b.Reader()
+	if err != nil {
+		return err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	h := b.newHash()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// ReadSum returns the sum of the bytes read since the last PrepareForReading
+// (see WithReadHash), or nil if the buffer has no read hash.
+func (b *Buffer) ReadSum() []byte {
+	if b.readHash == nil {
+		return nil
+	}
+	return b.readHash.Sum(nil)
+}
@@ -0,0 +1,158 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWithHash(t *testing.T) {
+	want := strings.Repeat("payload ", 10000)
+	sum := sha256.Sum256([]byte(want))
+	for _, tc := range []struct {
+		name string
+		new  func() *Buffer
+	}{
+		{"ram", func() *Buffer { return New(false, WithHash(sha256.New)) }},
+		{"disk", func() *Buffer { return New(true, WithHash(sha256.New)) }},
+		{"spill", func() *Buffer { return NewSpill(1000, WithHash(sha256.New)) }},
+		{"gzip", func() *Buffer { return New(true, WithGzip(), WithHash(sha256.New)) }},
+	} {
+		b := tc.new()
+		b.WriteString(want[:10])
+		b.Write([]byte(want[10:100]))
+		io.Copy(b, strings.NewReader(want[100:]))
+		if got := b.Sum(); !bytes.Equal(got, sum[:]) {
+			t.Errorf("%s: got sum %x, want %x", tc.name, got, sum)
+		}
+		if err := b.Verify(sum[:]); err != nil {
+			t.Errorf("%s: Verify: %v", tc.name, err)
+		}
+		if err := b.Verify(make([]byte, len(sum))); err != ErrCorrupted {
+			t.Errorf("%s: Verify a wrong sum: got %v, want ErrCorrupted", tc.name, err)
+		}
+		if _, err := b.WriteAt([]byte("x"), 0); err != ErrUnsupported {
+			t.Errorf("%s: WriteAt: got %v, want ErrUnsupported", tc.name, err)
+		}
+		c, err := b.SnapshotBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Sum(); !bytes.Equal(got, sum[:]) {
+			t.Errorf("%s: snapshot: got sum %x, want %x", tc.name, got, sum)
+		}
+		c.Remove()
+		b.Remove()
+	}
+}
+
+func TestVerifyDetectsCorruption(t *testing.T) {
+	b := New(true, WithHash(sha256.New))
+	defer b.Remove()
+	b.WriteString("important")
+	sum := b.Sum()
+	b.file.WriteAt([]byte("I"), 0)
+	if err := b.Verify(sum); err != ErrCorrupted {
+		t.Errorf("got %v, want ErrCorrupted", err)
+	}
+}
+
+func TestWithReadHash(t *testing.T) {
+	want := strings.Repeat("payload ", 10000)
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk, WithReadHash(sha256.New()))
+		b.WriteString(want)
+		b.PrepareForReading()
+		// A partial read.
+		p := make([]byte, 100)
+		b.ReadFull(p)
+		if got, sum := b.ReadSum(), sha256.Sum256([]byte(want[:100])); !bytes.Equal(got, sum[:]) {
+			t.Errorf("toDisk %v: after 100 bytes: got %x, want %x", toDisk, got, sum)
+		}
+		// Read and WriteTo, up to the end.
+		b.Read(p[:7])
+		var rest bytes.Buffer
+		b.WriteTo(&rest)
+		if got, sum := b.ReadSum(), sha256.Sum256([]byte(want)); !bytes.Equal(got, sum[:]) {
+			t.Errorf("toDisk %v: after all: got %x, want %x", toDisk, got, sum)
+		}
+		// PrepareForReading resets the hash.
+		b.PrepareForReading()
+		if got, sum := b.ReadSum(), sha256.Sum256(nil); !bytes.Equal(got, sum[:]) {
+			t.Errorf("toDisk %v: after PrepareForReading: got %x, want %x", toDisk, got, sum)
+		}
+		// The reads through Reader are not hashed.
+		r, _ := b.Reader()
+		io.Copy(io.Discard, r)
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		if got, sum := b.ReadSum(), sha256.Sum256(nil); !bytes.Equal(got, sum[:]) {
+			t.Errorf("toDisk %v: after Reader: got %x, want %x", toDisk, got, sum)
+		}
+		b.Remove()
+	}
+
+	b := New(false)
+	defer b.Remove()
+	if b.ReadSum() != nil {
+		t.Error("got a read sum without WithReadHash")
+	}
+}
+
+// failingReadFile is a File whose reads fail after k bytes.
+type failingReadFile struct {
+	File
+	k *int
+}
+
+var errReadFailed = errors.New("read failed")
+
+func (f failingReadFile) Read(p []byte) (int, error) {
+	if *f.k <= 0 {
+		return 0, errReadFailed
+	}
+	if len(p) > *f.k {
+		p = p[:*f.k]
+	}
+	n, err := f.File.Read(p)
+	*f.k -= n
+	return n, err
+}
+
+func TestWithReadHashErrors(t *testing.T) {
+	want := strings.Repeat("payload ", 1000)
+	// The sum covers the bytes written to w by WriteTo, before it failed.
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk, WithReadHash(sha256.New()))
+		b.WriteString(want)
+		b.PrepareForReading()
+		w := &failingWriter{k: 1234}
+		if _, err := b.WriteTo(w); err != errWriterFailed {
+			t.Errorf("toDisk %v: got %v, want errWriterFailed", toDisk, err)
+		}
+		if got, sum := b.ReadSum(), sha256.Sum256(w.got.Bytes()); !bytes.Equal(got, sum[:]) || w.got.Len() != 1234 {
+			t.Errorf("toDisk %v: after WriteTo failed: got %x, want %x", toDisk, got, sum)
+		}
+		b.Remove()
+	}
+
+	// The sum covers the bytes returned by Read, before it failed.
+	k := 0
+	fsys := newWrapFS(func(f File) File { return failingReadFile{f, &k} })
+	b := New(true, WithFS(fsys), WithReadHash(sha256.New()))
+	defer b.Remove()
+	b.WriteString(want)
+	b.PrepareForReading()
+	k = 500
+	got, err := io.ReadAll(b)
+	if err != errReadFailed || len(got) != 500 {
+		t.Fatalf("got %d bytes, %v, want 500 bytes, errReadFailed", len(got), err)
+	}
+	if sum := sha256.Sum256(got); !bytes.Equal(b.ReadSum(), sum[:]) {
+		t.Errorf("after Read failed: got %x, want %x", b.ReadSum(), sum)
+	}
+}
@@ -0,0 +1,70 @@
+package ramdiskbuffer
+
+import (
+	"sync/atomic"
+)
+
+// sizeBuckets are the upper bounds (inclusive) of the buckets
+// of the size histogram; sizes above the last bound go in the
+// overflow bucket.
+var sizeBuckets = []struct {
+	bound int64
+	label string
+}{
+	{1 << 10, "<=1KiB"},
+	{4 << 10, "<=4KiB"},
+	{16 << 10, "<=16KiB"},
+	{64 << 10, "<=64KiB"},
+	{256 << 10, "<=256KiB"},
+	{1 << 20, "<=1MiB"},
+	{4 << 20, "<=4MiB"},
+	{16 << 20, "<=16MiB"},
+	{64 << 20, "<=64MiB"},
+	{256 << 20, "<=256MiB"},
+	{1 << 30, "<=1GiB"},
+}
+
+const overflowBucketLabel = ">1GiB"
+
+var (
+	histogramEnabled int32
+	// histogram has one counter per bucket, plus the overflow bucket.
+	histogram [12]int64
+)
+
+// EnableSizeHistogram enables recording the final size of every buffer
+// (at Remove or Close, whichever comes first) in a package-level histogram,
+// retrievable via SizeHistogram.
+// The histogram is disabled by default, and costs nothing while disabled.
+func EnableSizeHistogram() {
+	atomic.StoreInt32(&histogramEnabled, 1)
+}
+
+// SizeHistogram returns the number of buffers recorded in each bucket
+// of the size histogram, keyed by the bucket label (e.g. "<=1KiB", ">1GiB").
+func SizeHistogram() map[string]int64 {
+	out := make(map[string]int64, len(histogram))
+	for i, bucket := range sizeBuckets {
+		out[bucket.label] = atomic.LoadInt64(&histogram[i])
+	}
+	out[overflowBucketLabel] = atomic.LoadInt64(&histogram[len(sizeBuckets)])
+	return out
+}
+
+// recordSize records the size of the buffer in the size histogram,
+// if enabled and not already done for this buffer.
+func (d *Buffer) recordSize() {
+	if atomic.LoadInt32(&histogramEnabled) == 0 || d.recorded {
+		return
+	}
+	d.recorded = true
+
+	size := d.length.Load()
+	for i, bucket := range sizeBuckets {
+		if size <= bucket.bound {
+			atomic.AddInt64(&histogram[i], 1)
+			return
+		}
+	}
+	atomic.AddInt64(&histogram[len(sizeBuckets)], 1)
+}
@@ -0,0 +1,57 @@
+package ramdiskbuffer
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSizeHistogram(t *testing.T) {
+	before := SizeHistogram()
+	b := New(false)
+	b.WriteString("abc")
+	b.Remove()
+	if got := SizeHistogram(); got["<=1KiB"] != before["<=1KiB"] {
+		t.Errorf("recorded while disabled: got %d, want %d", got["<=1KiB"], before["<=1KiB"])
+	}
+
+	EnableSizeHistogram()
+	defer atomic.StoreInt32(&histogramEnabled, 0)
+	before = SizeHistogram()
+	for _, tc := range []struct {
+		toDisk bool
+		size   int
+	}{
+		{false, 0},
+		{true, 1 << 10},
+		{false, 1<<10 + 1},
+		{true, 5000},
+		{false, 5000},
+	} {
+		b := New(tc.toDisk)
+		b.WriteString(strings.Repeat("x", tc.size))
+		// Recorded once, at Close.
+		b.Close()
+		b.Remove()
+	}
+	// Past the last bucket.
+	large := &Buffer{}
+	large.length.Store(1<<30 + 1)
+	large.recordSize()
+
+	got := SizeHistogram()
+	if len(got) != len(sizeBuckets)+1 {
+		t.Errorf("got %d buckets, want %d", len(got), len(sizeBuckets)+1)
+	}
+	for label, want := range map[string]int64{
+		"<=1KiB":  2,
+		"<=4KiB":  1,
+		"<=16KiB": 2,
+		"<=64KiB": 0,
+		">1GiB":   1,
+	} {
+		if n := got[label] - before[label]; n != want {
+			t.Errorf("bucket %s: got %d more, want %d", label, n, want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package ramdiskbuffer
+
+import (
+	"io"
+)
+
+// The small interfaces below let the code using buffers accept only what it
+// needs (and be tested with simple fakes): e.g. a function filling a buffer
+// takes an io.Writer, one that reports sizes a Sizer.
+var (
+	_ ReadWriteBuffer = (*Buffer)(nil)
+	_ ReadWriteBuffer = (*SafeBuffer)(nil)
+	_ Spiller         = (*Buffer)(nil)
+	_ Spiller         = BufferArray(nil)
+	_ Remover         = (*Buffer)(nil)
+	_ Remover         = (*SafeBuffer)(nil)
+	_ Remover         = BufferArray(nil)
+	_ Sizer           = (*Buffer)(nil)
+	_ Sizer           = (*SafeBuffer)(nil)
+	_ Sizer           = BufferArray(nil)
+)
+
+// ReadWriteBuffer is implemented by the buffers that go through write and
+// read phases: written, then prepared for reading, then read.
+type ReadWriteBuffer interface {
+	io.Writer
+	io.StringWriter
+	io.Reader
+	PrepareForReading() error
+}
+
+// Spiller is implemented by the buffers that can move their contents
+// from RAM to disk (for BufferArray, those of all its buffers).
+type Spiller interface {
+	SpillToDisk() error
+}
+
+// Remover is implemented by the buffers that release their backing (the
+// temp file, or the RAM) once done with. Remove is the one call needed at
+// the end of the life of a buffer: Close only flushes and closes the temp
+// file, keeping it, e.g. for the readers of the buffer (see Reader).
+type Remover interface {
+	Remove() error
+}
+
+// Sizer is implemented by the buffers that know the size of their contents
+// (for BufferArray, the total size of its buffers).
+type Sizer interface {
+	Size() int64
+}
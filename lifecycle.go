@@ -0,0 +1,73 @@
+package ramdiskbuffer
+
+// State is the lifecycle state of a buffer (see Buffer.State).
+type State int
+
+const (
+	// StateWriting is the state of a new buffer, and of a buffer written
+	// after PrepareForReading: writes append to the contents.
+	StateWriting State = iota
+	// StateReading is the state of a buffer after PrepareForReading:
+	// reads return the contents from the read offset.
+	StateReading
+	// StateClosed is the state of a buffer after Close: it can only
+	// be removed; the other operations return ErrAlreadyClosed.
+	StateClosed
+	// StateRemoved is the state of a buffer after Remove: the
+	// operations return ErrRemoved.
+	StateRemoved
+)
+
+func (s State) String() string {
+	switch s {
+	case StateWriting:
+		return "writing"
+	case StateReading:
+		return "reading"
+	case StateClosed:
+		return "closed"
+	case StateRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// State returns the lifecycle state of the buffer: writing, then reading
+// (after PrepareForReading), any number of times, until it's closed or
+// removed, which are final. A buffer removed after Close is removed.
+func (b *Buffer) State() State {
+	switch {
+	case b.removed:
+		return StateRemoved
+	case b.closed:
+		return StateClosed
+	case b.reading:
+		return StateReading
+	}
+	return StateWriting
+}
+
+// WithStrictLifecycle makes the buffer go through a single write phase:
+// once PrepareForReading was called, the writes (including WriteAt) return
+// ErrWriteAfterRead, instead of ending the read mode, so that a write meant
+// for another buffer, or made too late, is caught rather than silently
+// appended to what's being read. ResetTo starts a new write phase.
+func WithStrictLifecycle() Option {
+	return func(b *Buffer) {
+		b.strictLifecycle = true
+	}
+}
+
+// checkOpen returns the error of using a buffer that was removed
+// or closed, or that failed to be created (see SetErrorHandler), if so.
+func (b *Buffer) checkOpen() error {
+	switch {
+	case b.failed != nil:
+		return b.failed
+	case b.removed:
+		return ErrRemoved
+	case b.closed:
+		return ErrAlreadyClosed
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		if s := b.State(); s != StateWriting {
+			t.Errorf("toDisk %v: new buffer: got %v, want writing", toDisk, s)
+		}
+		b.WriteString("data")
+		if _, err := b.Read(make([]byte, 4)); err != ErrNotPrepared {
+			t.Errorf("toDisk %v: read before PrepareForReading: got %v, want ErrNotPrepared", toDisk, err)
+		}
+		b.PrepareForReading()
+		if s := b.State(); s != StateReading {
+			t.Errorf("toDisk %v: got %v, want reading", toDisk, s)
+		}
+		b.Close()
+		if s := b.State(); s != StateClosed {
+			t.Errorf("toDisk %v: got %v, want closed", toDisk, s)
+		}
+		if _, err := b.WriteString("x"); err != ErrAlreadyClosed {
+			t.Errorf("toDisk %v: write after Close: got %v, want ErrAlreadyClosed", toDisk, err)
+		}
+		if _, err := b.Read(make([]byte, 4)); err != ErrAlreadyClosed {
+			t.Errorf("toDisk %v: read after Close: got %v, want ErrAlreadyClosed", toDisk, err)
+		}
+		if _, err := b.WriteTo(new(bytes.Buffer)); err != ErrAlreadyClosed {
+			t.Errorf("toDisk %v: WriteTo after Close: got %v, want ErrAlreadyClosed", toDisk, err)
+		}
+		if err := b.PrepareForReading(); err != ErrAlreadyClosed {
+			t.Errorf("toDisk %v: PrepareForReading after Close: got %v, want ErrAlreadyClosed", toDisk, err)
+		}
+		if err := b.Remove(); err != nil {
+			t.Errorf("toDisk %v: Remove after Close: got %v, want nil", toDisk, err)
+		}
+		if s := b.State(); s != StateRemoved {
+			t.Errorf("toDisk %v: got %v, want removed", toDisk, s)
+		}
+		if _, err := b.WriteString("x"); err != ErrRemoved {
+			t.Errorf("toDisk %v: write after Remove: got %v, want ErrRemoved", toDisk, err)
+		}
+	}
+}
+
+func TestWithStrictLifecycle(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk, WithStrictLifecycle())
+		b.WriteString("data")
+		b.PrepareForReading()
+		if _, err := b.WriteString("more"); err != ErrWriteAfterRead {
+			t.Errorf("toDisk %v: got %v, want ErrWriteAfterRead", toDisk, err)
+		}
+		if _, err := b.WriteAt([]byte("D"), 0); err != ErrWriteAfterRead {
+			t.Errorf("toDisk %v: WriteAt: got %v, want ErrWriteAfterRead", toDisk, err)
+		}
+		if got, _ := b.String(); got != "data" {
+			t.Errorf("toDisk %v: got %q, want %q", toDisk, got, "data")
+		}
+		b.ResetTo(toDisk)
+		if _, err := b.WriteString("new"); err != nil {
+			t.Errorf("toDisk %v: after ResetTo: got %v, want nil", toDisk, err)
+		}
+		b.Remove()
+	}
+}
@@ -0,0 +1,134 @@
+package ramdiskbuffer
+
+import (
+	"context"
+)
+
+// WriteLimiter paces the writes of a buffer (see WithWriteLimiter).
+// *rate.Limiter of golang.org/x/time/rate implements it.
+type WriteLimiter interface {
+	// WaitN blocks until n bytes can be written,
+	// or until ctx is done.
+	WaitN(ctx context.Context, n int) error
+}
+
+// WithWriteLimiter caps the write throughput of a disk-backed buffer:
+// each write to the temp file waits for l to allow it (counting the bytes
+// written to the buffer, before the write pipeline), so that a burst of
+// writes doesn't saturate slow storage shared with other processes. This
+// includes the copy of the RAM backing by SpillToDisk, and the copies of
+// Append and Clone (even when they're done by the kernel). Sharing l among
+// buffers caps their combined throughput. RAM-backed buffers are not
+// affected.
+//
+// If l has a Burst() int method (like *rate.Limiter), the writes larger
+// than the burst are split, since they could never be allowed at once.
+// The waits can't be cancelled; see WithWriteLimiterContext.
+func WithWriteLimiter(l WriteLimiter) Option {
+	return func(b *Buffer) {
+		b.limiter = l
+	}
+}
+
+// WithWriteLimiterContext is like WithWriteLimiter, but the waits for l
+// are done with ctx: once it's done, the writes that wait fail with the
+// error of l (ctx.Err(), for *rate.Limiter), without writing anything
+// more.
+func WithWriteLimiterContext(ctx context.Context, l WriteLimiter) Option {
+	return func(b *Buffer) {
+		b.limiter = l
+		b.limiterCtx = ctx
+	}
+}
+
+// waitLimiter waits for the limiter, if any, to allow writing n bytes,
+// after checking the context of the buffer (see WithContext).
+func (b *Buffer) waitLimiter(n int) error {
+	if err := b.contextErr(); err != nil {
+		return err
+	}
+	if b.limiter == nil {
+		return nil
+	}
+	ctx := b.limiterCtx
+	if ctx == nil {
+		ctx = b.ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return b.limiter.WaitN(ctx, n)
+}
+
+// limiterChunk returns the size of the chunks in which to write total
+// bytes, so that each one can be allowed by the limiter at once, and
+// that the context of the buffer is checked between them.
+func (b *Buffer) limiterChunk(total int) int {
+	if l, ok := b.limiter.(interface{ Burst() int }); ok && l.Burst() > 0 && l.Burst() < total {
+		return l.Burst()
+	}
+	if b.ctx != nil && contextChunk < total {
+		return contextChunk
+	}
+	return total
+}
+
+// writeLimited writes p, or s if p is nil, with write (writeToFile,
+// or writeBacking), as fast as the limiter allows, and as long as the
+// context of the buffer is not done.
+func (b *Buffer) writeLimited(p []byte, s string, write func([]byte, string) (int, error)) (n int, err error) {
+	total := len(p) + len(s)
+	chunk := b.limiterChunk(total)
+	for n < total {
+		k := total - n
+		if k > chunk {
+			k = chunk
+		}
+		if err := b.waitLimiter(k); err != nil {
+			return n, err
+		}
+		var m int
+		if p != nil {
+			m, err = write(p[n:n+k], "")
+		} else {
+			m, err = write(nil, s[n:n+k])
+		}
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// maxLimitedCopy is the size of the chunks of the kernel copies
+// paced by the limiter (see copyFileRangeLimited).
+const maxLimitedCopy = 1 << 20
+
+// copyFileRangeLimited appends the first n bytes of src to the file via
+// copyFileRange, as fast as the limiter allows, if any. The error is the
+// one of the limiter: when the kernel copy stops short, the caller copies
+// the rest in userspace.
+func (b *Buffer) copyFileRangeLimited(src File, n int64) (int64, error) {
+	if b.limiter == nil {
+		copied, _ := copyFileRange(b.file, src, 0, n)
+		return copied, nil
+	}
+	chunk := int64(b.limiterChunk(maxLimitedCopy))
+	var copied int64
+	for copied < n {
+		k := n - copied
+		if k > chunk {
+			k = chunk
+		}
+		if err := b.waitLimiter(int(k)); err != nil {
+			return copied, err
+		}
+		m, err := copyFileRange(b.file, src, copied, k)
+		copied += m
+		if err != nil || m < k {
+			return copied, nil
+		}
+	}
+	return copied, nil
+}
@@ -0,0 +1,67 @@
+package ramdiskbuffer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// countingLimiter allows everything, and counts the bytes it allowed;
+// it fails once its context is done.
+type countingLimiter struct {
+	allowed int
+}
+
+func (l *countingLimiter) WaitN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.allowed += n
+	return nil
+}
+
+func (l *countingLimiter) Burst() int { return 100 }
+
+func TestWriteLimiterPacesAllWrites(t *testing.T) {
+	l := &countingLimiter{}
+	b := New(false, WithWriteLimiter(l))
+	defer b.Remove()
+	b.WriteString(strings.Repeat("a", 1000))
+	if l.allowed != 0 {
+		t.Fatalf("RAM writes were paced: %d bytes", l.allowed)
+	}
+	if err := b.SpillToDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if l.allowed != 1000 {
+		t.Fatalf("spill: %d bytes allowed, want 1000", l.allowed)
+	}
+
+	src := New(true)
+	defer src.Remove()
+	src.WriteString(strings.Repeat("b", 500))
+	if _, err := b.Append(src); err != nil {
+		t.Fatal(err)
+	}
+	if l.allowed != 1500 {
+		t.Fatalf("append: %d bytes allowed, want 1500", l.allowed)
+	}
+}
+
+func TestWriteLimiterContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := New(true, WithWriteLimiterContext(ctx, &countingLimiter{}))
+	defer b.Remove()
+	if _, err := b.WriteString("before"); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	n, err := b.WriteString("after")
+	if n != 0 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("got (%d, %v), want (0, context.Canceled)", n, err)
+	}
+	if b.Size() != 6 {
+		t.Fatalf("size %d, want 6", b.Size())
+	}
+}
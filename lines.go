@@ -0,0 +1,54 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io"
+)
+
+// ReadRecord reads the next record from the read offset: the bytes until
+// the first occurrence of delim, which is not returned. The last record
+// doesn't need to end in delim. At the end of the contents, it returns
+// io.EOF.
+//
+// Disk-backed buffers read the record a byte at a time, unless they read
+// ahead (see WithReadBufferSize).
+func (b *Buffer) ReadRecord(delim byte) ([]byte, error) {
+	record, err := b.ReadBytes(delim)
+	if err == io.EOF && len(record) > 0 {
+		return record, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record[:len(record)-1], nil
+}
+
+// ReadLine reads the next line from the read offset, like ReadRecord with
+// '\n', also dropping the '\r' of a "\r\n" line ending.
+func (b *Buffer) ReadLine() ([]byte, error) {
+	line, err := b.ReadRecord('\n')
+	return bytes.TrimSuffix(line, []byte{'\r'}), err
+}
+
+// Lines prepares the buffer for reading (see PrepareForReading), and calls
+// fn with each line of the contents, from the beginning, as returned by
+// ReadLine, until the end or the first error of fn, which it returns. The
+// lines are not limited in length, unlike those of LineScanner; fn may
+// keep them. The read offset ends after the last line passed to fn.
+func (b *Buffer) Lines(fn func(line []byte) error) error {
+	if err := b.PrepareForReading(); err != nil {
+		return err
+	}
+	for {
+		line, err := b.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+}
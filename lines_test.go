@@ -0,0 +1,128 @@
+package ramdiskbuffer
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithReadBufferSize(4)}} {
+		for _, toDisk := range []bool{false, true} {
+			b := New(toDisk, opts...)
+			b.WriteString("first\r\nsecond\n\nlast")
+
+			var lines []string
+			if err := b.Lines(func(line []byte) error {
+				lines = append(lines, string(line))
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"first", "second", "", "last"}; !reflect.DeepEqual(lines, want) {
+				t.Errorf("toDisk %v: got %q, want %q", toDisk, lines, want)
+			}
+
+			stop := errors.New("stop")
+			calls := 0
+			if err := b.Lines(func([]byte) error { calls++; return stop }); err != stop || calls != 1 {
+				t.Errorf("toDisk %v: got (%v, %d calls), want (stop, 1 call)", toDisk, err, calls)
+			}
+			b.Remove()
+		}
+	}
+}
+
+func TestReadRecord(t *testing.T) {
+	b := New(true)
+	defer b.Remove()
+	b.WriteString("a,bc,,d,")
+	b.PrepareForReading()
+	var records []string
+	for {
+		record, err := b.ReadRecord(',')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, string(record))
+	}
+	if want := []string{"a", "bc", "", "d"}; !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q, want %q", records, want)
+	}
+}
+
+func TestLineScanner(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		b.WriteString("first\r\nsecond\n\nlast")
+		if _, err := b.LineScanner(); err != ErrNotPrepared {
+			t.Errorf("toDisk %v: in write mode: got %v, want ErrNotPrepared", toDisk, err)
+		}
+		b.PrepareForReading()
+		// Reading doesn't move the scanner, which starts at the beginning.
+		b.ReadFull(make([]byte, 3))
+		s, err := b.LineScanner()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		if err := s.Err(); err != nil {
+			t.Errorf("toDisk %v: %v", toDisk, err)
+		}
+		if want := []string{"first", "second", "", "last"}; !reflect.DeepEqual(lines, want) {
+			t.Errorf("toDisk %v: got %q, want %q", toDisk, lines, want)
+		}
+		// Nor does the scanner move the read offset.
+		if rest, _ := io.ReadAll(b); string(rest) != "st\r\nsecond\n\nlast" {
+			t.Errorf("toDisk %v: got %q after the scan", toDisk, rest)
+		}
+		b.Remove()
+	}
+}
+
+func TestLineScannerLongLines(t *testing.T) {
+	long := strings.Repeat("x", bufio.MaxScanTokenSize+10)
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		b.WriteString("short\n" + long + "\nafter\n")
+		b.PrepareForReading()
+
+		s, err := b.LineScanner()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.Scan() || s.Text() != "short" {
+			t.Errorf("toDisk %v: got %q, want %q", toDisk, s.Text(), "short")
+		}
+		if s.Scan() {
+			t.Errorf("toDisk %v: scanned a line longer than bufio.MaxScanTokenSize", toDisk)
+		}
+		if err := s.Err(); err != bufio.ErrTooLong {
+			t.Errorf("toDisk %v: got %v, want bufio.ErrTooLong", toDisk, err)
+		}
+
+		// With a larger buffer.
+		s, err = b.LineScanner()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Buffer(nil, 2*len(long))
+		var lines []string
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		if err := s.Err(); err != nil || !reflect.DeepEqual(lines, []string{"short", long, "after"}) {
+			t.Errorf("toDisk %v: got %d lines, %v, want 3", toDisk, len(lines), err)
+		}
+		b.Remove()
+	}
+}
@@ -0,0 +1,213 @@
+package ramdiskbuffer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// manifestVersion is the version of the manifests of Marshal.
+const manifestVersion = 1
+
+// manifest is the state of a buffer recorded by Marshal.
+type manifest struct {
+	Version int    `json:"version"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Reading bool   `json:"reading"`
+	Offset  int64  `json:"offset"`
+	// Transformed is true if the file is transformed (see
+	// WithWritePipeline), and FileSize is then its size.
+	Transformed bool  `json:"transformed,omitempty"`
+	FileSize    int64 `json:"file_size,omitempty"`
+}
+
+// Marshal returns a manifest of the state of a disk-backed buffer: the path
+// of its temp file, its size, its read mode and its read offset, so that
+// another process (e.g. after a restart) can reattach to the buffer with
+// Restore. The temp file is fsynced first, so that the manifest describes
+// durable contents; the buffer must not be removed (nor its temp file
+// reused, see SetFileCacheSize) if it's to be restored.
+//
+// The buffers that are not disk-backed (e.g. RAM-backed ones) return
+// ErrNotRestorable, and those whose temp file is not on the OS filesystem
+// (see WithFS) return ErrUnsupported. For transformed buffers (see
+// WithWritePipeline), Marshal closes the write pipeline first, like
+// PrepareForReading, so that the file holds whole streams: the writes
+// after it append a new stream.
+func (b *Buffer) Marshal() ([]byte, error) {
+	if err := b.checkOpen(); err != nil {
+		return nil, err
+	}
+	if !b.toDisk || b.sink != nil {
+		return nil, ErrNotRestorable
+	}
+	if _, ok := b.fs.(osFS); !ok {
+		return nil, ErrUnsupported
+	}
+	if err := b.ensureFile(); err != nil {
+		return nil, err
+	}
+	if err := b.closePipeline(); err != nil {
+		return nil, err
+	}
+	if err := b.syncFile(); err != nil {
+		return nil, err
+	}
+	m := manifest{
+		Version: manifestVersion,
+		Path:    b.file.Name(),
+		Size:    b.Size(),
+		Reading: b.reading,
+		Offset:  b.roff,
+	}
+	if b.hasHeader {
+		size, err := b.PhysicalLen()
+		if err != nil {
+			return nil, err
+		}
+		m.Transformed = true
+		m.FileSize = size
+	}
+	return json.Marshal(m)
+}
+
+// Restore returns a disk-backed buffer reattached to the temp file of the
+// manifest returned by Marshal, in the same state: the contents written
+// after Marshal are dropped (the file is truncated to the size of the
+// manifest), so that a crash-resumable pipeline restarts from the last
+// manifest it recorded. The options apply as for New, but the ones that
+// change the filesystem of the temp file (see WithFS) can't be used; those
+// that transform it (see WithWritePipeline) must be given if, and only if,
+// the buffer marshaled had them, for its header to be checked (see
+// ErrCorrupted), and the writes to append to it. The buffer owns the file:
+// Remove removes it.
+//
+// Since the buffer takes over the file of the manifest, truncating it, and
+// removing it on Remove, the manifest must come from a trusted source: as
+// a safeguard, Restore only takes over the regular files (not symlinks)
+// that are temp files of the buffer, i.e. in its temp directory (see
+// WithTempDir), or in one of the directories of WithDiskFullPolicy, and
+// named with its prefix and suffix (see WithFilePrefix and WithSuffix).
+// Otherwise, it returns an error, without touching the file.
+//
+// If the file is shorter than the manifest says, Restore returns
+// ErrCorrupted.
+func Restore(data []byte, opts ...Option) (*Buffer, error) {
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("ramdiskbuffer: invalid manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("ramdiskbuffer: unsupported manifest version %d", m.Version)
+	}
+	if m.Size < 0 || m.Offset < 0 || m.Offset > m.Size {
+		return nil, ErrInvalidSize
+	}
+
+	if m.FileSize < 0 {
+		return nil, ErrInvalidSize
+	}
+
+	// Don't append to the array of the caller.
+	b, err := NewBuffer(true, append(opts[:len(opts):len(opts)], WithLazyFile())...)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.restore(m); err != nil {
+		// Don't remove the file of the manifest.
+		b.persisted = true
+		b.Remove()
+		return nil, err
+	}
+	return b, nil
+}
+
+// restore attaches the buffer to the temp file of m.
+func (b *Buffer) restore(m manifest) error {
+	if _, ok := b.fs.(osFS); !ok || b.transformed() != m.Transformed {
+		return ErrUnsupported
+	}
+	if err := b.checkTempFile(m.Path); err != nil {
+		return err
+	}
+	fileSize := m.Size
+	if m.Transformed {
+		fileSize = m.FileSize
+	}
+	if err := b.acquireFileSlot(); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(m.Path, os.O_RDWR, 0)
+	if err != nil {
+		b.releaseFileSlot()
+		return err
+	}
+	info, err := file.Stat()
+	if err == nil && info.Size() < fileSize {
+		err = ErrCorrupted
+	}
+	if err == nil && m.Transformed {
+		// Check the header of the file.
+		b.hasHeader = true
+		_, err = b.fileReadPipeline(file)
+	}
+	if err == nil && info.Size() > fileSize {
+		err = file.Truncate(fileSize)
+	}
+	if err != nil {
+		file.Close()
+		b.releaseFileSlot()
+		return err
+	}
+	b.file = file
+	b.addLength(m.Size)
+	b.updateRegistry()
+	if m.Reading {
+		if err := b.prepareForReading(false); err != nil {
+			return err
+		}
+		return b.setReadOffset(m.Offset)
+	}
+	_, err = file.Seek(0, io.SeekEnd)
+	return err
+}
+
+// checkTempFile returns an error if path is not a regular file that
+// could be a temp file of the buffer (see Restore).
+func (b *Buffer) checkTempFile(path string) error {
+	invalid := fmt.Errorf("ramdiskbuffer: invalid manifest: %q is not a temp file of the buffer", path)
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return invalid
+	}
+	inTempDir := false
+	for _, tempDir := range append([]string{b.tempDir}, b.altTempDirs...) {
+		if tempDir == "" {
+			tempDir = os.TempDir()
+		}
+		if abs, err := filepath.Abs(tempDir); err == nil && abs == dir {
+			inTempDir = true
+			break
+		}
+	}
+	name := filepath.Base(path)
+	prefix, suffix := b.tempPattern(), ""
+	if i := strings.LastIndex(prefix, "*"); i >= 0 {
+		prefix, suffix = prefix[:i], prefix[i+1:]
+	}
+	if !inTempDir || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) || len(name) <= len(prefix)+len(suffix) {
+		return invalid
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return invalid
+	}
+	return nil
+}
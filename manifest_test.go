@@ -0,0 +1,206 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarshalAndRestore(t *testing.T) {
+	b := New(true)
+	b.WriteString("checkpointed")
+	data, err := b.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Written after the manifest: dropped by Restore.
+	b.WriteString(" lost")
+	name := b.file.Name()
+	b.Close()
+
+	r, err := Restore(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != 12 || r.InReadMode() {
+		t.Errorf("got size %d, read mode %v, want 12, write mode", r.Size(), r.InReadMode())
+	}
+	r.WriteString(" and resumed")
+	r.PrepareForReading()
+	p := make([]byte, 13)
+	r.ReadFull(p)
+
+	data, err = r.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	r, err = Restore(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "and resumed" {
+		t.Errorf("got %q from the read offset, want %q", got, "and resumed")
+	}
+	if err := r.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the file removed with the restored buffer", err)
+	}
+
+	if _, err := Restore(data); !os.IsNotExist(err) {
+		t.Errorf("missing file: got %v, want a not-exist error", err)
+	}
+	m := New(false)
+	defer m.Remove()
+	if _, err := m.Marshal(); err != ErrNotRestorable {
+		t.Errorf("RAM-backed: got %v, want ErrNotRestorable", err)
+	}
+}
+
+func TestRestoreTruncatedFile(t *testing.T) {
+	b := New(true)
+	b.WriteString("0123456789")
+	data, _ := b.Marshal()
+	name := b.file.Name()
+	b.Close()
+	defer os.Remove(name)
+	os.Truncate(name, 4)
+	if _, err := Restore(data); err != ErrCorrupted {
+		t.Errorf("got %v, want ErrCorrupted", err)
+	}
+	if _, err := os.Stat(name); err != nil {
+		t.Errorf("got %v, want the file kept after a failed Restore", err)
+	}
+}
+
+func TestRestoreChecksPath(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "precious")
+	if err := os.WriteFile(outside, []byte("do not touch"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(os.TempDir(), defaultFilePrefix+"-link")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(link)
+	for _, path := range []string{
+		outside,
+		// In the temp dir, but not named like a temp file.
+		filepath.Join(os.TempDir(), "precious"),
+		link,
+	} {
+		data, _ := json.Marshal(manifest{Version: manifestVersion, Path: path, Size: 2})
+		if _, err := Restore(data); err == nil {
+			t.Errorf("%s: got no error", path)
+		}
+	}
+	if got, err := os.ReadFile(outside); err != nil || string(got) != "do not touch" {
+		t.Errorf("got %q, %v, want the file untouched", got, err)
+	}
+
+	// With the temp dir of the buffer.
+	b := New(true, WithTempDir(dir), WithFilePrefix("job"), WithSuffix("bin"))
+	b.WriteString("abc")
+	data, err := b.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	if _, err := Restore(data); err == nil {
+		t.Error("other temp dir: got no error")
+	}
+	if _, err := Restore(data, WithTempDir(dir)); err == nil {
+		t.Error("other prefix: got no error")
+	}
+	r, err := Restore(data, WithTempDir(dir), WithFilePrefix("job"), WithSuffix("bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Remove()
+	if got, err := r.String(); err != nil || got != "abc" {
+		t.Errorf("got %q, %v, want %q", got, err, "abc")
+	}
+}
+
+func TestRestoreDoesNotAliasOptions(t *testing.T) {
+	b := New(true)
+	data, _ := b.Marshal()
+	b.Close()
+	// Room in the array of opts for the option of Restore.
+	opts := make([]Option, 1, 2)
+	opts[0] = WithReadBufferSize(16)
+	r, err := Restore(data, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Remove()
+	if opts[:2][1] != nil {
+		t.Error("Restore appended its option to the array of the caller")
+	}
+}
+
+func TestRestoreTransformed(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	for _, opts := range [][]Option{{WithGzip()}, {WithEncryption(key)}} {
+		b := New(true, opts...)
+		b.WriteString("checkpointed")
+		data, err := b.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.WriteString(" lost")
+		b.Close()
+
+		if _, err := Restore(data); err != ErrUnsupported {
+			t.Errorf("without the transforms: got %v, want ErrUnsupported", err)
+		}
+		r, err := Restore(data, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.WriteString(" and resumed")
+		if got, err := r.String(); err != nil || got != "checkpointed and resumed" {
+			t.Errorf("got %q, %v", got, err)
+		}
+		r.PrepareForReading()
+		p := make([]byte, 13)
+		r.ReadFull(p)
+		data, err = r.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		r, err = Restore(data, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := io.ReadAll(r); string(got) != "and resumed" {
+			t.Errorf("got %q from the read offset, want %q", got, "and resumed")
+		}
+		r.Remove()
+	}
+}
+
+func TestRestoreChecksHeader(t *testing.T) {
+	b := New(true, WithGzip())
+	b.WriteString("payload")
+	data, _ := b.Marshal()
+	name := b.file.Name()
+	b.Close()
+	defer os.Remove(name)
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("X"), 0)
+	f.Close()
+	if _, err := Restore(data, WithGzip()); err != ErrCorrupted {
+		t.Errorf("got %v, want ErrCorrupted", err)
+	}
+}
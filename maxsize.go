@@ -0,0 +1,42 @@
+package ramdiskbuffer
+
+// WithMaxSize caps the size of the buffer (see Size) to n bytes, whatever
+// its backing: a write that would make it go past n writes what fits, and
+// returns ErrTooLarge, like the writer of LimitedWriter; once the buffer
+// is full, the writes don't write anything, and return ErrTooLarge. This
+// applies to Write, WriteString, ReadFrom, WriteAt and Append, and to
+// the helpers that use them (e.g. Printf and ReadRangeFrom). It's meant to
+// bound the RAM or the disk space used by a buffer of untrusted input.
+// If n is zero or negative, the size is not capped.
+func WithMaxSize(n int64) Option {
+	return func(b *Buffer) {
+		if n < 0 {
+			n = 0
+		}
+		b.maxSize = n
+	}
+}
+
+// fitsMaxSize reports whether n more bytes fit in the buffer
+// (see WithMaxSize).
+func (b *Buffer) fitsMaxSize(n int64) bool {
+	return b.maxSize <= 0 || n <= b.maxSize-b.Size()
+}
+
+// writeUpToMaxSize appends the bytes of p, or of s if p is nil, that fit
+// in the buffer (see WithMaxSize), and returns ErrTooLarge.
+func (b *Buffer) writeUpToMaxSize(p []byte, s string) (n int, err error) {
+	left := b.maxSize - b.Size()
+	if left <= 0 {
+		return 0, ErrTooLarge
+	}
+	if p != nil {
+		n, err = b.Write(p[:left])
+	} else {
+		n, err = b.WriteString(s[:left])
+	}
+	if err == nil {
+		err = ErrTooLarge
+	}
+	return n, err
+}
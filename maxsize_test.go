@@ -0,0 +1,45 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWithMaxSize(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk, WithMaxSize(10))
+		if n, err := b.WriteString("0123"); n != 4 || err != nil {
+			t.Errorf("toDisk %v: got (%d, %v), want (4, nil)", toDisk, n, err)
+		}
+		if n, err := b.Write([]byte("456789abc")); n != 6 || err != ErrTooLarge {
+			t.Errorf("toDisk %v: got (%d, %v), want (6, ErrTooLarge)", toDisk, n, err)
+		}
+		if n, err := b.WriteString("x"); n != 0 || err != ErrTooLarge {
+			t.Errorf("toDisk %v: full: got (%d, %v), want (0, ErrTooLarge)", toDisk, n, err)
+		}
+		if n, err := b.WriteAt([]byte("XYZ"), 8); n != 2 || err != ErrTooLarge {
+			t.Errorf("toDisk %v: WriteAt: got (%d, %v), want (2, ErrTooLarge)", toDisk, n, err)
+		}
+		if got, _ := b.String(); got != "01234567XY" {
+			t.Errorf("toDisk %v: got %q, want %q", toDisk, got, "01234567XY")
+		}
+		b.Remove()
+
+		b = New(toDisk, WithMaxSize(1000))
+		n, err := io.Copy(b, strings.NewReader(strings.Repeat("x", 5000)))
+		if n != 1000 || err != ErrTooLarge || b.Size() != 1000 {
+			t.Errorf("toDisk %v: ReadFrom: got (%d, %v), Size %d, want (1000, ErrTooLarge), 1000", toDisk, n, err, b.Size())
+		}
+		b.Remove()
+	}
+
+	src := New(true)
+	defer src.Remove()
+	src.WriteString(strings.Repeat("y", 100))
+	dst := New(true, WithMaxSize(60))
+	defer dst.Remove()
+	if n, err := dst.Append(src); n != 60 || err != ErrTooLarge {
+		t.Errorf("Append: got (%d, %v), want (60, ErrTooLarge)", n, err)
+	}
+}
@@ -0,0 +1,22 @@
+package ramdiskbuffer
+
+// memFDFS is the FS of the buffers of NewMemFD.
+var memFDFS = newAnonymousFS("memfd", createMemFD)
+
+// NewMemFD returns a buffer whose contents live in RAM, in an anonymous
+// memory file created by memfd_create on linux, rather than in the heap:
+// like a disk-backed buffer, its file is an OS file (see File), whose
+// descriptor can be passed to a subprocess (e.g. via os.ProcAttr.Files),
+// sent over a unix socket, or mmapped. The kernel releases the memory when
+// the buffer is removed, or when the process exits. Elsewhere, the file is
+// an anonymous temp file, on disk (see WithAnonymousFile).
+//
+// The buffer is disk-backed as far as the package is concerned: e.g. its
+// bytes count in CurrentDiskBytes, and it can be chunked or transformed.
+// It replaces the FS of the buffer (see WithFS). NewMemFD panics if the
+// file can't be created, like New.
+func NewMemFD(opts ...Option) *Buffer {
+	return New(true, append(opts, func(b *Buffer) {
+		b.fs = memFDFS
+	})...)
+}
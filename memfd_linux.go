@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package ramdiskbuffer
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// createMemFD creates a memory file named name, with memfd_create;
+// if the kernel doesn't support it, it falls back to createAnonymousFile.
+func createMemFD(dir, pattern, name string) (f *os.File, named bool, err error) {
+	fd, err := unix.MemfdCreate(defaultFilePrefix, unix.MFD_CLOEXEC)
+	if err != nil {
+		return createAnonymousFile(dir, pattern, name)
+	}
+	return os.NewFile(uintptr(fd), name), false, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package ramdiskbuffer
+
+import (
+	"os"
+)
+
+// createMemFD creates an anonymous file named name in dir
+// (see createAnonymousFile): memfd_create is supported only on linux.
+func createMemFD(dir, pattern, name string) (f *os.File, named bool, err error) {
+	return createAnonymousFile(dir, pattern, name)
+}
@@ -0,0 +1,32 @@
+package ramdiskbuffer
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewMemFD(t *testing.T) {
+	b := NewMemFD()
+	defer b.Remove()
+	b.WriteString("in memory")
+	f, ok := b.File()
+	if !ok {
+		t.Fatal("no OS file")
+	}
+	got := make([]byte, 9)
+	if _, err := f.ReadAt(got, 0); err != nil || string(got) != "in memory" {
+		t.Errorf("ReadAt: got (%q, %v)", got, err)
+	}
+	if s, err := b.String(); err != nil || s != "in memory" {
+		t.Errorf("String: got (%q, %v)", s, err)
+	}
+	if runtime.GOOS == "linux" {
+		target, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", f.Fd()))
+		if err == nil && !strings.HasPrefix(target, "/memfd:") {
+			t.Errorf("got a file at %q, want a memfd", target)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemFS returns a new FS that keeps its files in memory.
+// It's meant for tests: it lets the disk code paths of a buffer
+// (seek, truncate, stat, etc.) be exercised without touching the disk.
+func NewMemFS() FS {
+	return &memFS{
+		files: make(map[string]*memData),
+	}
+}
+
+// NewMemDisk returns a disk-backed buffer whose temp file lives in memory
+// (see NewMemFS).
+func NewMemDisk(opts ...Option) *Buffer {
+	return New(true, append([]Option{WithFS(NewMemFS())}, opts...)...)
+}
+
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memData
+	seq   int
+}
+
+// memData is the contents of a file of a memFS;
+// it's shared by all the open handles of the file.
+type memData struct {
+	mu      sync.Mutex
+	data    []byte
+	modTime time.Time
+}
+
+func (fsys *memFS) CreateTemp(dir, pattern string) (File, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	fsys.seq++
+	random := strconv.Itoa(fsys.seq)
+	var name string
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		name = pattern[:i] + random + pattern[i+1:]
+	} else {
+		name = pattern + random
+	}
+	name = filepath.Join(dir, name)
+
+	data := &memData{modTime: time.Now()}
+	fsys.files[name] = data
+	return &memFile{name: name, data: data}, nil
+}
+
+func (fsys *memFS) Open(name string) (File, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	data, ok := fsys.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &memFile{name: name, data: data, readOnly: true}, nil
+}
+
+func (fsys *memFS) Remove(name string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if _, ok := fsys.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	// Like on unix, open handles of the file keep working.
+	delete(fsys.files, name)
+	return nil
+}
+
+// SyncDir does nothing: memFS files are never durable.
+func (fsys *memFS) SyncDir(dir string) error {
+	return nil
+}
+
+// memFile is an open handle of a file of a memFS.
+type memFile struct {
+	name     string
+	data     *memData
+	readOnly bool
+
+	mu     sync.Mutex
+	off    int64
+	closed bool
+}
+
+var errReadOnly = errors.New("file is read-only")
+
+func (f *memFile) pathError(op string, err error) error {
+	return &os.PathError{Op: op, Path: f.name, Err: err}
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, f.pathError("read", os.ErrClosed)
+	}
+	n, err := f.readAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, f.pathError("read", os.ErrClosed)
+	}
+	if off < 0 {
+		return 0, f.pathError("readat", errors.New("negative offset"))
+	}
+	n, err := f.readAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *memFile) readAt(p []byte, off int64) (int, error) {
+	f.data.mu.Lock()
+	defer f.data.mu.Unlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if off >= int64(len(f.data.data)) {
+		return 0, io.EOF
+	}
+	return copy(p, f.data.data[off:]), nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	return f.write(p, "")
+}
+
+func (f *memFile) WriteString(s string) (int, error) {
+	return f.write(nil, s)
+}
+
+// write writes p, or s if p is nil, at the offset of the file.
+func (f *memFile) write(p []byte, s string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkWrite("write"); err != nil {
+		return 0, err
+	}
+	n := f.writeAt(p, s, f.off)
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkWrite("write"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, f.pathError("writeat", errors.New("negative offset"))
+	}
+	return f.writeAt(p, "", off), nil
+}
+
+func (f *memFile) checkWrite(op string) error {
+	if f.closed {
+		return f.pathError(op, os.ErrClosed)
+	}
+	if f.readOnly {
+		return f.pathError(op, errReadOnly)
+	}
+	return nil
+}
+
+// writeAt writes p, or s if p is nil, at offset off.
+func (f *memFile) writeAt(p []byte, s string, off int64) int {
+	f.data.mu.Lock()
+	defer f.data.mu.Unlock()
+	if end := off + int64(len(p)+len(s)); end > int64(len(f.data.data)) {
+		f.data.resize(end)
+	}
+	f.data.modTime = time.Now()
+	if p != nil {
+		return copy(f.data.data[off:], p)
+	}
+	return copy(f.data.data[off:], s)
+}
+
+// resize sets the size of the file, zero-filling any extension.
+func (d *memData) resize(size int64) {
+	if size <= int64(len(d.data)) {
+		d.data = d.data[:size]
+		return
+	}
+	if size <= int64(cap(d.data)) {
+		old := len(d.data)
+		d.data = d.data[:size]
+		for i := old; i < len(d.data); i++ {
+			d.data[i] = 0
+		}
+		return
+	}
+	data := make([]byte, size, 2*size)
+	copy(data, d.data)
+	d.data = data
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, f.pathError("seek", os.ErrClosed)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		f.data.mu.Lock()
+		offset += int64(len(f.data.data))
+		f.data.mu.Unlock()
+	default:
+		return 0, f.pathError("seek", errors.New("invalid whence"))
+	}
+	if offset < 0 {
+		return 0, f.pathError("seek", errors.New("negative offset"))
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkWrite("truncate"); err != nil {
+		return err
+	}
+	if size < 0 {
+		return f.pathError("truncate", errors.New("negative size"))
+	}
+	f.data.mu.Lock()
+	defer f.data.mu.Unlock()
+	f.data.resize(size)
+	f.data.modTime = time.Now()
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, f.pathError("stat", os.ErrClosed)
+	}
+	f.data.mu.Lock()
+	defer f.data.mu.Unlock()
+	return memFileInfo{
+		name:    filepath.Base(f.name),
+		size:    int64(len(f.data.data)),
+		modTime: f.data.modTime,
+	}, nil
+}
+
+func (f *memFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return f.pathError("sync", os.ErrClosed)
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return f.pathError("close", os.ErrClosed)
+	}
+	f.closed = true
+	return nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() os.FileMode  { return 0600 }
+func (fi memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memFileInfo) IsDir() bool        { return false }
+func (fi memFileInfo) Sys() interface{}   { return nil }
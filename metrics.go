@@ -0,0 +1,93 @@
+package ramdiskbuffer
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// MetricsCollector receives the events of all the buffers of the package
+// (see SetMetricsCollector), e.g. to export them to a monitoring system.
+// The methods are called synchronously, from the goroutine using the
+// buffer, so they must be fast, and safe for concurrent use.
+type MetricsCollector interface {
+	// BufferAllocated is called when a buffer is created (by New, Clone,
+	// Snapshot, etc.), with its mode: "ram", "disk" or "sink".
+	BufferAllocated(mode string)
+	// BufferSpilled is called when a RAM-backed buffer moves its n bytes
+	// to disk (see SpillToDisk).
+	BufferSpilled(n int64)
+	// BufferRead is called after each read of a buffer that returned
+	// n > 0 bytes (see Stats).
+	BufferRead(n int64)
+	// BufferRemoved is called on the first Remove or Close of a buffer,
+	// with its mode at that time.
+	BufferRemoved(mode string)
+}
+
+// metricsHolder wraps the collector, for atomic.Value.
+type metricsHolder struct {
+	c MetricsCollector
+}
+
+var metrics atomic.Value // metricsHolder
+
+// SetMetricsCollector sets the collector of the events of the buffers of
+// the package; nil (the default) disables it. The package-level gauges
+// (CurrentRAMBytes, CurrentDiskBytes and LiveBuffers) complete the events,
+// for the totals: see ExpvarCollector for a collector exporting both.
+func SetMetricsCollector(c MetricsCollector) {
+	metrics.Store(metricsHolder{c})
+}
+
+// metricsCollector returns the collector set by SetMetricsCollector,
+// or nil.
+func metricsCollector() MetricsCollector {
+	h, _ := metrics.Load().(metricsHolder)
+	return h.c
+}
+
+// ExpvarCollector is a MetricsCollector counting the events in expvar
+// variables (see NewExpvarCollector).
+type ExpvarCollector struct {
+	Allocated    expvar.Int
+	Removed      expvar.Int
+	Spills       expvar.Int
+	SpilledBytes expvar.Int
+	ReadBytes    expvar.Int
+}
+
+// NewExpvarCollector returns an ExpvarCollector, published by expvar as a
+// map named name, which also holds the package-level gauges: e.g. with
+// name "ramdiskbuffer", /debug/vars serves
+//
+//	"ramdiskbuffer": {"allocated": 12, "disk_bytes": 1048576, "live": 3,
+//	    "ram_bytes": 4096, "read_bytes": 65536, "removed": 9,
+//	    "spilled_bytes": 1048576, "spills": 1}
+//
+// The rates (e.g. of spills) are derived from the counters by the
+// monitoring system. Like expvar.Publish, it panics if name is already
+// published. The collector still has to be set by SetMetricsCollector.
+func NewExpvarCollector(name string) *ExpvarCollector {
+	c := new(ExpvarCollector)
+	m := expvar.NewMap(name)
+	m.Set("allocated", &c.Allocated)
+	m.Set("removed", &c.Removed)
+	m.Set("spills", &c.Spills)
+	m.Set("spilled_bytes", &c.SpilledBytes)
+	m.Set("read_bytes", &c.ReadBytes)
+	m.Set("ram_bytes", expvar.Func(func() interface{} { return CurrentRAMBytes() }))
+	m.Set("disk_bytes", expvar.Func(func() interface{} { return CurrentDiskBytes() }))
+	m.Set("live", expvar.Func(func() interface{} { return LiveBuffers() }))
+	return c
+}
+
+func (c *ExpvarCollector) BufferAllocated(mode string) { c.Allocated.Add(1) }
+
+func (c *ExpvarCollector) BufferSpilled(n int64) {
+	c.Spills.Add(1)
+	c.SpilledBytes.Add(n)
+}
+
+func (c *ExpvarCollector) BufferRead(n int64) { c.ReadBytes.Add(n) }
+
+func (c *ExpvarCollector) BufferRemoved(mode string) { c.Removed.Add(1) }
@@ -0,0 +1,45 @@
+package ramdiskbuffer
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExpvarCollector(t *testing.T) {
+	c := NewExpvarCollector("ramdiskbuffer_test")
+	SetMetricsCollector(c)
+	defer SetMetricsCollector(nil)
+
+	b := NewSpill(4)
+	b.WriteString("01")
+	b.WriteString("23456789")
+	b.PrepareForReading()
+	io.Copy(io.Discard, b)
+	b.Remove()
+	b.Remove()
+	r := New(false)
+	r.Close()
+
+	want := map[string]int64{
+		"allocated":     2,
+		"removed":       2,
+		"spills":        1,
+		"spilled_bytes": 2,
+		"read_bytes":    10,
+	}
+	var got map[string]int64
+	if err := json.NewDecoder(strings.NewReader(expvar.Get("ramdiskbuffer_test").String())).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %d, want %d", k, got[k], v)
+		}
+	}
+	if _, ok := got["ram_bytes"]; !ok {
+		t.Errorf("missing ram_bytes in %v", got)
+	}
+}
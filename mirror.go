@@ -0,0 +1,122 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"os"
+)
+
+// NewMirrored returns a RAM-backed buffer whose writes also go to a temp
+// file, the mirror: the reads are served from RAM, and the mirror is a disk
+// copy of the contents for recovery (see MirrorName). PrepareForReading and
+// Close fsync the mirror, and Remove removes it. Size is the logical length,
+// as for any buffer. NewMirrored panics if the mirror can't be created,
+// like New; see NewMirroredBuffer.
+//
+// If writing to the mirror fails, the write returns the error, but the
+// bytes are in RAM: the buffer stays usable, without the mirror from then
+// on (see MirrorDegraded). Mirrored buffers don't support DropPrefix and
+// SpillToDisk; ResetTo empties the mirror, or removes it if the buffer
+// moves to disk. The clones and snapshots of a mirrored buffer are not
+// mirrored.
+func NewMirrored(opts ...Option) *Buffer {
+	return mustBuffer(NewMirroredBuffer(opts...))
+}
+
+// NewMirroredBuffer is like NewMirrored, but it returns an error instead
+// of panicking if the buffer or its mirror can't be created.
+func NewMirroredBuffer(opts ...Option) (*Buffer, error) {
+	b, err := NewBuffer(false, opts...)
+	if err != nil {
+		return nil, err
+	}
+	file, err := b.createFile()
+	if err != nil {
+		b.Remove()
+		return nil, err
+	}
+	b.mirror = file
+	return b, nil
+}
+
+// MirrorName returns the name of the mirror of a mirrored buffer
+// (see NewMirrored), or an empty string for the other buffers.
+func (b *Buffer) MirrorName() string {
+	if b.mirror == nil {
+		return ""
+	}
+	return b.mirror.Name()
+}
+
+// MirrorDegraded reports whether writing to the mirror of a mirrored buffer
+// failed (see NewMirrored): then the mirror is behind the contents in RAM,
+// and it's not written to anymore.
+func (b *Buffer) MirrorDegraded() bool {
+	return b.mirrorErr != nil
+}
+
+// writeMirror appends p, or s if p is nil, to the mirror, if any.
+func (b *Buffer) writeMirror(p []byte, s string) error {
+	if b.mirror == nil || b.mirrorErr != nil {
+		return nil
+	}
+	b.dirty = true
+	var err error
+	if p != nil {
+		_, err = writeFull(b.mirror, p)
+	} else {
+		_, err = writeFullString(b.mirror, s)
+	}
+	b.mirrorErr = err
+	return err
+}
+
+// syncMirror fsyncs the mirror, if any, unless it wasn't modified
+// since it was last fsynced.
+func (b *Buffer) syncMirror() error {
+	if b.mirror == nil || b.mirrorErr != nil || !b.dirty {
+		return nil
+	}
+	if err := b.mirror.Sync(); err != nil {
+		return err
+	}
+	b.dirty = false
+	return nil
+}
+
+// resetMirror empties the mirror, if any, so that it mirrors the buffer
+// again, or removes it if remove is true.
+func (b *Buffer) resetMirror(remove bool) error {
+	if b.mirror == nil {
+		return nil
+	}
+	if remove {
+		return b.removeMirror()
+	}
+	b.dirty = true
+	if err := b.mirror.Truncate(0); err != nil {
+		return err
+	}
+	_, err := b.mirror.Seek(0, io.SeekStart)
+	b.mirrorErr = err
+	return err
+}
+
+// removeMirror closes and removes the mirror, if any.
+func (b *Buffer) removeMirror() error {
+	if b.mirror == nil {
+		return nil
+	}
+	b.mirror.Close()
+	b.releaseFileSlot()
+	var err error
+	if b.teePath != "" {
+		// The file of a tee buffer is on the OS filesystem (see NewTee).
+		err = os.Remove(b.mirror.Name())
+		b.teePath = ""
+	} else {
+		err = b.fs.Remove(b.mirror.Name())
+	}
+	b.mirror = nil
+	b.mirrorErr = nil
+	return err
+}
@@ -0,0 +1,29 @@
+package ramdiskbuffer
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMirroredArray(t *testing.T) {
+	ba := BufferArray{NewMirrored(), NewMirrored(), New(false)}
+	defer ba.Remove()
+	for i, buf := range ba {
+		buf.WriteString("shard")
+		buf.Write([]byte{byte('0' + i)})
+	}
+	if err := ba.PrepareForReadingBatchSync(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(ba[1].MirrorName())
+	if err != nil || string(got) != "shard1" {
+		t.Fatalf("mirror: got %q, %v", got, err)
+	}
+
+	if err := ba.EnforceMemoryBudget(0); err != nil {
+		t.Fatal(err)
+	}
+	if ba[0].toDisk || ba[1].toDisk || !ba[2].toDisk {
+		t.Errorf("spilled: %v %v %v, want only the plain buffer", ba[0].toDisk, ba[1].toDisk, ba[2].toDisk)
+	}
+}
@@ -0,0 +1,83 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"math"
+	"os"
+)
+
+// WithMmapReads makes PrepareForReading memory-map the temp file of a
+// disk-backed buffer, read-only: then Read, ReadAt and WriteTo copy from
+// the mapping, without a syscall per call, which pays off for the large
+// buffers read many times (e.g. concurrently via ReadAt, which is safe for
+// concurrent use while nothing writes the buffer). The mapping is released
+// when the read mode ends (by a write), and by WriteAt, Truncate, DropPrefix,
+// ResetTo, Remove and Close.
+//
+// Only the OS files of non-empty buffers, without transforms (see
+// WithWritePipeline), are mapped; otherwise, and on the platforms without
+// mmap (but linux), the buffer reads the file as usual. The read-ahead
+// buffer (see WithReadBufferSize) is not used on the mapping.
+func WithMmapReads() Option {
+	return func(b *Buffer) {
+		b.mmapReads = true
+	}
+}
+
+// mapFile maps the temp file, if the buffer reads it through a mapping
+// (see WithMmapReads); if mapping fails, the file is read as usual.
+func (b *Buffer) mapFile() {
+	if !b.mmapReads || b.mapped != nil || b.transformed() {
+		return
+	}
+	f, ok := b.file.(*os.File)
+	size := b.Size()
+	if !ok || size <= 0 || size > math.MaxInt {
+		return
+	}
+	if err := b.flushWrites(); err != nil {
+		return
+	}
+	if data, err := mmapFile(f, size); err == nil {
+		b.mapped = data
+	}
+}
+
+// unmapFile releases the mapping of the temp file, if any; if the buffer
+// is still in read mode, it moves the offset of the file to the read
+// offset, to read the file from there.
+func (b *Buffer) unmapFile() error {
+	if b.mapped == nil {
+		return nil
+	}
+	err := munmap(b.mapped)
+	b.mapped = nil
+	if b.reading && !b.removed && !b.closed {
+		if serr := b.setReadOffset(b.roff); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// readMapped reads from the mapping at the read offset.
+func (b *Buffer) readMapped(p []byte) (int, error) {
+	if b.roff >= int64(len(b.mapped)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.mapped[b.roff:])
+	b.roff += int64(n)
+	return n, nil
+}
+
+// readMappedAt reads from the mapping at offset off, like io.ReaderAt.
+func (b *Buffer) readMappedAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(b.mapped)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.mapped[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package ramdiskbuffer
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mmapFile maps the first size bytes of f, read-only.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+}
+
+// munmap releases a mapping of mmapFile.
+func munmap(data []byte) error {
+	return unix.Munmap(data)
+}
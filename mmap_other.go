@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package ramdiskbuffer
+
+import (
+	"os"
+)
+
+// mmapFile is not supported: the file is read as usual.
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func munmap(data []byte) error {
+	return nil
+}
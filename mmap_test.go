@@ -0,0 +1,57 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWithMmapReads(t *testing.T) {
+	b := New(true, WithMmapReads(), WithReadBufferSize(16))
+	defer b.Remove()
+	contents := strings.Repeat("mapped contents ", 1000)
+	b.WriteString(contents)
+	if err := b.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS == "linux" && (b.mapped == nil || b.br != nil) {
+		t.Fatalf("got mapping %v, read-ahead %v, want the file mapped, without read-ahead", b.mapped != nil, b.br != nil)
+	}
+
+	p := make([]byte, 7)
+	if _, err := b.ReadAt(p, 16); err != nil || string(p) != "mapped " {
+		t.Errorf("ReadAt: got (%q, %v), want %q", p, err, "mapped ")
+	}
+	b.ReadFull(p[:6])
+	var out bytes.Buffer
+	if _, err := b.WriteTo(&out); err != nil || out.String() != contents[6:] {
+		t.Errorf("WriteTo: got %d bytes, %v, want the rest", out.Len(), err)
+	}
+	if n, err := b.Read(p); n != 0 || err != io.EOF {
+		t.Errorf("got (%d, %v) at the end, want (0, EOF)", n, err)
+	}
+
+	// Writing ends the read mode, and drops the mapping.
+	b.WriteString("more")
+	if b.mapped != nil {
+		t.Error("got the mapping kept after a write")
+	}
+	b.PrepareForReading()
+	b.Seek(int64(len(contents)), io.SeekStart)
+	if got, _ := io.ReadAll(b); string(got) != "more" {
+		t.Errorf("got %q, want %q", got, "more")
+	}
+
+	// WriteAt in read mode drops the mapping, and reads carry on from the file.
+	b.Seek(0, io.SeekStart)
+	b.ReadFull(p)
+	b.WriteAt([]byte("M"), 7)
+	if b.mapped != nil {
+		t.Error("got the mapping kept after WriteAt")
+	}
+	if _, err := b.ReadFull(p); err != nil || string(p) != "Montent" {
+		t.Errorf("got (%q, %v), want %q", p, err, "Montent")
+	}
+}
@@ -0,0 +1,68 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+)
+
+// MultipartReader prepares all the buffers for reading (see
+// Buffer.PrepareForReading), and returns a reader of a multipart body
+// (as written by mime/multipart) with one part per buffer, in index order:
+// the part i has the headers headers[i], and the contents of ba[i].
+//
+// The body is streamed: the buffers are read as the reader is, without
+// holding the whole body in memory. headers must have one entry per buffer,
+// or be nil for parts without headers; the boundary must be valid for
+// mime/multipart.Writer.SetBoundary. The Content-Type of the body is e.g.
+// "multipart/form-data; boundary=" + boundary.
+func (ba BufferArray) MultipartReader(boundary string, headers []textproto.MIMEHeader) (io.Reader, error) {
+	if err := multipart.NewWriter(ioutil.Discard).SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	if headers != nil && len(headers) != len(ba) {
+		return nil, fmt.Errorf("ramdiskbuffer: %d multipart headers for %d buffers", len(headers), len(ba))
+	}
+	if err := ba.PrepareForReading(); err != nil {
+		return nil, err
+	}
+
+	readers := make([]io.Reader, 0, 2*len(ba)+1)
+	for i, buf := range ba {
+		var part bytes.Buffer
+		if i > 0 {
+			part.WriteString("\r\n")
+		}
+		fmt.Fprintf(&part, "--%s\r\n", boundary)
+		if headers != nil {
+			writeMIMEHeader(&part, headers[i])
+		}
+		part.WriteString("\r\n")
+		readers = append(readers, &part, buf)
+	}
+	closing := "--" + boundary + "--\r\n"
+	if len(ba) > 0 {
+		closing = "\r\n" + closing
+	}
+	readers = append(readers, bytes.NewReader([]byte(closing)))
+	return io.MultiReader(readers...), nil
+}
+
+// writeMIMEHeader writes the header h, with the keys sorted
+// like mime/multipart does.
+func writeMIMEHeader(w *bytes.Buffer, h textproto.MIMEHeader) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(w, "%s: %s\r\n", k, v)
+		}
+	}
+}
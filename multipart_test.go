@@ -0,0 +1,116 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestMultipartReader(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		ba := NewArray(3, toDisk)
+		contents := []string{"first part", "", strings.Repeat("third\r\n", 1000)}
+		for i, s := range contents {
+			ba[i].WriteString(s)
+		}
+		headers := []textproto.MIMEHeader{
+			{"Content-Disposition": {`form-data; name="a"`}, "Content-Type": {"text/plain"}},
+			{"Content-Disposition": {`form-data; name="b"`}},
+			{"Content-Disposition": {`form-data; name="c"; filename="c.txt"`}, "X-Multi": {"1", "2"}},
+		}
+		const boundary = "test-boundary-1234"
+		r, err := ba.MultipartReader(boundary, headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Like mime/multipart.Writer.
+		var want bytes.Buffer
+		mw := multipart.NewWriter(&want)
+		mw.SetBoundary(boundary)
+		for i, s := range contents {
+			w, _ := mw.CreatePart(headers[i])
+			io.WriteString(w, s)
+		}
+		mw.Close()
+		if !bytes.Equal(body, want.Bytes()) {
+			t.Errorf("toDisk %v: the body differs from the one of mime/multipart", toDisk)
+		}
+
+		mr := multipart.NewReader(bytes.NewReader(body), boundary)
+		for i, s := range contents {
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Fatalf("toDisk %v: part %d: %v", toDisk, i, err)
+			}
+			for k, v := range headers[i] {
+				if got := part.Header[k]; strings.Join(got, ",") != strings.Join(v, ",") {
+					t.Errorf("toDisk %v: part %d: header %s got %q, want %q", toDisk, i, k, got, v)
+				}
+			}
+			got, err := io.ReadAll(part)
+			if err != nil || string(got) != s {
+				t.Errorf("toDisk %v: part %d: got %d bytes, %v, want %d bytes", toDisk, i, len(got), err, len(s))
+			}
+		}
+		if _, err := mr.NextPart(); err != io.EOF {
+			t.Errorf("toDisk %v: after the last part: got %v, want EOF", toDisk, err)
+		}
+		ba.Remove()
+	}
+}
+
+func TestMultipartReaderWithoutHeaders(t *testing.T) {
+	ba := NewArray(2, false)
+	defer ba.Remove()
+	ba[0].WriteString("a")
+	ba[1].WriteString("b")
+	r, err := ba.MultipartReader("b0undary", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(r, "b0undary")
+	for _, want := range []string{"a", "b"} {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(part.Header) != 0 {
+			t.Errorf("got headers %v, want none", part.Header)
+		}
+		if got, _ := io.ReadAll(part); string(got) != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("after the last part: got %v, want EOF", err)
+	}
+}
+
+func TestMultipartReaderEmpty(t *testing.T) {
+	r, err := BufferArray{}.MultipartReader("b0undary", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := multipart.NewReader(r, "b0undary").NextPart(); err != io.EOF {
+		t.Errorf("got %v, want EOF", err)
+	}
+}
+
+func TestMultipartReaderInvalid(t *testing.T) {
+	ba := NewArray(2, false)
+	defer ba.Remove()
+	if _, err := ba.MultipartReader("bad boundary!\n", nil); err == nil {
+		t.Error("invalid boundary: got no error")
+	}
+	if _, err := ba.MultipartReader("ok", []textproto.MIMEHeader{{}}); err == nil {
+		t.Error("one header for two buffers: got no error")
+	}
+}
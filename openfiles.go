@@ -0,0 +1,79 @@
+package ramdiskbuffer
+
+import (
+	"sync"
+)
+
+// openFiles counts the temp files held open by the buffers,
+// against the limit set by SetMaxOpenFiles.
+var openFiles struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	max  int
+	open int
+}
+
+func init() {
+	openFiles.cond = sync.NewCond(&openFiles.mu)
+}
+
+// SetMaxOpenFiles limits the number of temp files held open by the buffers
+// of the package to n, to get backpressure instead of running out of file
+// descriptors (EMFILE) when many disk-backed buffers are alive, e.g. the
+// shards of a large BufferArray. When the limit is reached, creating the
+// temp file of a buffer (by New, or by the first write with WithLazyFile)
+// waits until another buffer releases its file, by Close, Remove, or
+// ResetTo to RAM; with WithoutOpenFileWait, it fails with
+// ErrTooManyOpenFiles instead. The default is 0: no limit.
+//
+// The limit is on the temp files (and mirrors, see NewMirrored) of the
+// buffers: the file descriptors of the readers (see Reader), and of the
+// files kept for reuse (see SetFileCacheSize), are not counted; a chunked
+// buffer (see NewChunked) counts as one file.
+func SetMaxOpenFiles(n int) {
+	if n < 0 {
+		n = 0
+	}
+	openFiles.mu.Lock()
+	openFiles.max = n
+	openFiles.mu.Unlock()
+	openFiles.cond.Broadcast()
+}
+
+// WithoutOpenFileWait makes creating the temp file of the buffer fail with
+// ErrTooManyOpenFiles when the limit of SetMaxOpenFiles is reached, instead
+// of waiting for another buffer to release its file. Then New panics, like
+// for any other failure to create the file, unless WithLazyFile is used.
+func WithoutOpenFileWait() Option {
+	return func(b *Buffer) {
+		b.noFileWait = true
+	}
+}
+
+// acquireFileSlot takes a slot for a new open temp file of the buffer.
+func (b *Buffer) acquireFileSlot() error {
+	openFiles.mu.Lock()
+	defer openFiles.mu.Unlock()
+	for openFiles.max > 0 && openFiles.open >= openFiles.max {
+		if b.noFileWait {
+			return ErrTooManyOpenFiles
+		}
+		openFiles.cond.Wait()
+	}
+	openFiles.open++
+	b.fileSlots++
+	return nil
+}
+
+// releaseFileSlot gives back the slot of a temp file of the buffer that
+// was closed (or handed over to the file cache), if it holds any.
+func (b *Buffer) releaseFileSlot() {
+	if b.fileSlots == 0 {
+		return
+	}
+	b.fileSlots--
+	openFiles.mu.Lock()
+	openFiles.open--
+	openFiles.mu.Unlock()
+	openFiles.cond.Signal()
+}
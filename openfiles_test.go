@@ -0,0 +1,63 @@
+package ramdiskbuffer
+
+import (
+	"testing"
+	"time"
+)
+
+// setMaxOpenFilesForTest limits the open files to extra more than the ones
+// already open (by other tests), and restores the limit at the end.
+func setMaxOpenFilesForTest(t *testing.T, extra int) {
+	openFiles.mu.Lock()
+	open := openFiles.open
+	openFiles.mu.Unlock()
+	SetMaxOpenFiles(open + extra)
+	t.Cleanup(func() { SetMaxOpenFiles(0) })
+}
+
+func openFileCount() int {
+	openFiles.mu.Lock()
+	defer openFiles.mu.Unlock()
+	return openFiles.open
+}
+
+func TestSetMaxOpenFiles(t *testing.T) {
+	base := openFileCount()
+	setMaxOpenFilesForTest(t, 2)
+
+	a := New(true)
+	b := New(true, WithLazyFile())
+	if _, err := b.WriteString("x"); err != nil {
+		t.Fatal(err)
+	}
+	c := New(true, WithLazyFile(), WithoutOpenFileWait())
+	if _, err := c.WriteString("x"); err != ErrTooManyOpenFiles {
+		t.Fatalf("got %v, want ErrTooManyOpenFiles", err)
+	}
+
+	created := make(chan *Buffer)
+	go func() { created <- New(true) }()
+	select {
+	case <-created:
+		t.Fatal("New didn't wait for a free slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var d *Buffer
+	select {
+	case d = <-created:
+	case <-time.After(5 * time.Second):
+		t.Fatal("New didn't get the released slot")
+	}
+
+	for _, buf := range []*Buffer{a, b, c, d} {
+		if err := buf.Remove(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := openFileCount(); got != base {
+		t.Fatalf("%d open files after Remove, want %d", got, base)
+	}
+}
@@ -0,0 +1,132 @@
+package ramdiskbuffer
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Option configures a Buffer created by New.
+type Option func(*Buffer)
+
+// WithLazyFile defers the creation of the temp file of a disk-backed
+// buffer until the first write. Until then the buffer has length 0,
+// and Remove and Close are no-ops.
+//
+// This avoids creating lots of empty temp files for sparse
+// BufferArrays where many buffers are never written to.
+func WithLazyFile() Option {
+	return func(b *Buffer) {
+		b.lazy = true
+	}
+}
+
+// WithFS sets the filesystem used by disk-backed buffers
+// for their temp files; the default is the OS filesystem.
+func WithFS(fsys FS) Option {
+	return func(b *Buffer) {
+		b.fs = fsys
+	}
+}
+
+// WithGrowthIncrement makes the RAM backing of the buffer grow by n bytes
+// at a time when it runs out of capacity, instead of doubling its capacity
+// (which is the default, like for bytes.Buffer).
+//
+// Growing needs both the old and the new backing in memory at once:
+// for very large RAM-backed buffers, a fixed increment (e.g. 64MiB)
+// caps that transient peak.
+func WithGrowthIncrement(n int) Option {
+	return func(b *Buffer) {
+		b.growIncrement = n
+	}
+}
+
+// WithDurableDir makes the buffer fsync the parent directory of the files
+// it creates (its temp file, and the files written by WriteFile), so that
+// their directory entries survive a power loss. It's not needed for
+// throwaway temp buffers, but it is when a buffer becomes a durable artifact.
+func WithDurableDir() Option {
+	return func(b *Buffer) {
+		b.durableDir = true
+	}
+}
+
+// WithTempDir makes the buffer create its temp file in the directory dir
+// (e.g. a tmpfs mount, or a dedicated scratch disk), instead of the default
+// temp directory (see os.TempDir).
+func WithTempDir(dir string) Option {
+	return func(b *Buffer) {
+		b.tempDir = dir
+	}
+}
+
+// WithFilePrefix makes the names of the temp files of the buffer start with
+// prefix instead of "ramdiskbuffer", followed by a random string (and by
+// the extension of WithSuffix, if any).
+func WithFilePrefix(prefix string) Option {
+	return func(b *Buffer) {
+		b.prefix = prefix
+	}
+}
+
+// WithFileMode sets the permissions of the temp files of the buffer to mode
+// (e.g. 0640, to let a group read them), instead of 0600. The umask of the
+// process doesn't apply. It has no effect on the files of an FS other than
+// the OS one (see WithFS), nor on chunked buffers (see NewChunked).
+func WithFileMode(mode os.FileMode) Option {
+	return func(b *Buffer) {
+		b.fileMode = mode.Perm()
+	}
+}
+
+// WithSuffix makes the names of the temp files of the buffer end with
+// the extension ext (e.g. "json", for ramdiskbuffer-123456.json), so that
+// they're self-describing for the operators and the tools that inspect
+// them. A leading dot in ext is optional.
+func WithSuffix(ext string) Option {
+	return func(b *Buffer) {
+		b.suffix = strings.TrimPrefix(ext, ".")
+	}
+}
+
+// WithLenientRead allows reading a buffer that isn't in read mode:
+// instead of failing with ErrNotPrepared, Read reads from the current
+// read offset (for disk-backed buffers, the offset of the temp file,
+// which is at the end of the contents after writing).
+func WithLenientRead() Option {
+	return func(b *Buffer) {
+		b.lenientRead = true
+	}
+}
+
+// WithReadBufferSize makes a disk-backed buffer read ahead n bytes at a time
+// from its temp file in read mode, so that sequential reads (via Read,
+// ReadByte, ReadBytes) are served from memory instead of issuing a syscall
+// each. The read-ahead buffer is set up by PrepareForReading, and dropped
+// when the read mode ends; random access to the file bypasses it.
+func WithReadBufferSize(n int) Option {
+	return func(b *Buffer) {
+		b.readBufferSize = n
+	}
+}
+
+// WithDevicePool spreads the temp files of the buffers created with this
+// option across dirs (e.g. one directory per disk): each buffer gets the
+// next directory, round-robin. Use the same option value for all the
+// buffers to spread, e.g. via NewArray, so that parallel spills don't
+// contend for the same disk.
+//
+// The directory is chosen when the buffer is created, even if the temp file
+// is created later (see WithLazyFile). With an empty dirs, it does nothing.
+func WithDevicePool(dirs []string) Option {
+	dirs = append([]string(nil), dirs...)
+	var next uint64
+	return func(b *Buffer) {
+		if len(dirs) == 0 {
+			return
+		}
+		i := atomic.AddUint64(&next, 1) - 1
+		b.tempDir = dirs[i%uint64(len(dirs))]
+	}
+}
@@ -0,0 +1,169 @@
+package ramdiskbuffer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTempFileOptions(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBuffer(true, WithTempDir(dir), WithFilePrefix("upload"), WithSuffix("json"), WithFileMode(0640))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Remove()
+	name := b.file.Name()
+	if filepath.Dir(name) != dir {
+		t.Errorf("temp file %s not in %s", name, dir)
+	}
+	if base := filepath.Base(name); !strings.HasPrefix(base, "upload-") || !strings.HasSuffix(base, ".json") {
+		t.Errorf("temp file name %s, want upload-*.json", base)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("temp file mode %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+}
+
+func TestNewBufferError(t *testing.T) {
+	live := LiveBuffers()
+	missing := filepath.Join(t.TempDir(), "missing")
+	if b, err := NewBuffer(true, WithTempDir(missing)); err == nil || b != nil {
+		t.Errorf("got (%v, %v), want an error", b, err)
+	}
+	if LiveBuffers() != live {
+		t.Errorf("the failed buffer is counted as live")
+	}
+	// With WithLazyFile, the error is returned by the first write.
+	b, err := NewBuffer(true, WithTempDir(missing), WithLazyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Remove()
+	if _, err := b.WriteString("abc"); err == nil {
+		t.Error("write: got no error")
+	}
+}
+
+func TestWithGrowthIncrement(t *testing.T) {
+	for _, tc := range []struct {
+		increment int
+		// caps are the capacities of the backing after each write
+		// of 10 bytes.
+		caps []int
+	}{
+		{0, []int{10, 20, 40, 40}},
+		{-1, []int{10, 20, 40, 40}},
+		{15, []int{10, 25, 35, 45}},
+		// A write larger than the increment grows by what it needs.
+		{5, []int{10, 20, 30, 40}},
+	} {
+		b := New(false, WithGrowthIncrement(tc.increment))
+		want := ""
+		for i, c := range tc.caps {
+			s := strings.Repeat(string(rune('a'+i)), 10)
+			b.WriteString(s)
+			want += s
+			if cap(b.data) != c {
+				t.Errorf("increment %d: write %d: got capacity %d, want %d", tc.increment, i, cap(b.data), c)
+			}
+		}
+		if got, err := b.String(); err != nil || got != want {
+			t.Errorf("increment %d: got %q, %v, want %q", tc.increment, got, err, want)
+		}
+		b.Remove()
+	}
+
+	// No effect on disk-backed buffers, nor on what they hold.
+	b := New(true, WithGrowthIncrement(3))
+	defer b.Remove()
+	want := strings.Repeat("0123456789", 100)
+	b.WriteString(want)
+	if b.data != nil {
+		t.Errorf("disk-backed buffer: got a RAM backing of capacity %d", cap(b.data))
+	}
+	if got, err := b.String(); err != nil || got != want {
+		t.Errorf("disk-backed buffer: got %d bytes, %v, want %d", len(got), err, len(want))
+	}
+
+	// Spilled buffers grow by the increment while in RAM.
+	s := NewSpill(100, WithGrowthIncrement(7))
+	defer s.Remove()
+	s.WriteString("0123456789")
+	s.WriteString("x")
+	if cap(s.data) != 17 {
+		t.Errorf("spill buffer: got capacity %d, want 17", cap(s.data))
+	}
+	s.WriteString(strings.Repeat("y", 100))
+	if got, err := s.String(); err != nil || got != "0123456789x"+strings.Repeat("y", 100) {
+		t.Errorf("spill buffer: got %q, %v", got, err)
+	}
+}
+
+func TestWithDevicePool(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	pool := WithDevicePool(dirs)
+	ba := NewArray(6, true, pool)
+	defer ba.Remove()
+	for i, b := range ba {
+		if got := filepath.Dir(b.file.Name()); got != dirs[i%3] {
+			t.Errorf("buffer %d: got dir %s, want %s", i, got, dirs[i%3])
+		}
+	}
+
+	// RAM-backed buffers get their directory too, for when they spill;
+	// the directory is chosen at creation, even if the file is lazy.
+	pool = WithDevicePool(dirs[:2])
+	spills := []*Buffer{NewSpill(10, pool), New(true, pool, WithLazyFile())}
+	for i, b := range spills {
+		defer b.Remove()
+		b.WriteString(strings.Repeat("x", 100))
+		if b.file == nil {
+			t.Fatalf("buffer %d: no temp file", i)
+		}
+		if got := filepath.Dir(b.file.Name()); got != dirs[i] {
+			t.Errorf("buffer %d: got dir %s, want %s", i, got, dirs[i])
+		}
+		if got, err := b.String(); err != nil || got != strings.Repeat("x", 100) {
+			t.Errorf("buffer %d: got %q, %v", i, got, err)
+		}
+	}
+	r := New(false, pool)
+	defer r.Remove()
+	r.WriteString("abc")
+	if r.file != nil {
+		t.Error("RAM-backed buffer: got a temp file")
+	}
+
+	// No directories: the default temp directory.
+	b := New(true, WithDevicePool(nil))
+	defer b.Remove()
+	if got := filepath.Dir(b.file.Name()); got != filepath.Clean(os.TempDir()) {
+		t.Errorf("empty pool: got dir %s, want %s", got, os.TempDir())
+	}
+}
+
+func TestWithDevicePoolMissingDir(t *testing.T) {
+	dirs := []string{t.TempDir(), filepath.Join(t.TempDir(), "missing")}
+	pool := WithDevicePool(dirs)
+	b, err := NewBuffer(true, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Remove()
+	// The next buffer gets the missing directory.
+	if _, err := NewBuffer(true, pool); !os.IsNotExist(err) {
+		t.Errorf("got %v, want a not-exist error", err)
+	}
+	// A RAM-backed buffer fails when it spills.
+	s := NewSpill(10, WithDevicePool(dirs[1:]))
+	defer s.Remove()
+	if _, err := s.WriteString(strings.Repeat("x", 100)); !os.IsNotExist(err) {
+		t.Errorf("spill: got %v, want a not-exist error", err)
+	}
+}
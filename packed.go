@@ -0,0 +1,308 @@
+package ramdiskbuffer
+
+import (
+	"io"
+)
+
+// PackedArray is an array of shards stored back to back in a single
+// backing buffer (one temp file, or one RAM arena), with an index of
+// the ranges of each shard. Compared to a BufferArray, it avoids the
+// per-buffer overhead, and the one file descriptor per disk-backed buffer,
+// when there are many small shards.
+//
+// Writes to the shards can be interleaved: each write is appended to the
+// backing, and recorded in the index of its shard. A shard that grows past
+// the maxShardSize given to NewPackedArray is moved to a dedicated buffer;
+// the bytes it occupied in the backing are not reclaimed, and from then on
+// the shard follows the write and read phases of a Buffer
+// (see Buffer.PrepareForReading).
+//
+// Like a Buffer, a PackedArray and its shards must not be used concurrently.
+type PackedArray struct {
+	backing      *Buffer
+	size         int64
+	shards       []*PackedShard
+	maxShardSize int64
+	toDisk       bool
+	opts         []Option
+}
+
+// PackedShard is a shard of a PackedArray. It's read and written like
+// a Buffer; reads don't discard the contents, and PrepareForReading
+// goes back to the beginning.
+type PackedShard struct {
+	pa *PackedArray
+	// ranges are the ranges of the backing holding the contents of the shard,
+	// in order; buf is not nil once the shard has its dedicated buffer.
+	ranges []packedRange
+	size   int64
+	buf    *Buffer
+	roff   int64
+}
+
+type packedRange struct {
+	off, n int64
+}
+
+// NewPackedArray returns a PackedArray of length shards, backed by a temp
+// file (toDisk true) or by RAM (toDisk false). Shards larger than
+// maxShardSize get a dedicated buffer; the options are used both for the
+// backing and for the dedicated buffers. Like New, it panics if the temp
+// file can't be created.
+func NewPackedArray(length int, toDisk bool, maxShardSize int64, opts ...Option) *PackedArray {
+	pa := &PackedArray{
+		backing:      New(toDisk, opts...),
+		shards:       make([]*PackedShard, length),
+		maxShardSize: maxShardSize,
+		toDisk:       toDisk,
+		opts:         opts,
+	}
+	for i := range pa.shards {
+		pa.shards[i] = &PackedShard{pa: pa}
+	}
+	return pa
+}
+
+// Len returns the number of shards.
+func (pa *PackedArray) Len() int {
+	return len(pa.shards)
+}
+
+// Shard returns the shard at index i.
+func (pa *PackedArray) Shard(i int) *PackedShard {
+	return pa.shards[i]
+}
+
+// TotalLen returns the sum of the lengths of all the shards.
+func (pa *PackedArray) TotalLen() int64 {
+	var total int64
+	for _, s := range pa.shards {
+		total += s.Len()
+	}
+	return total
+}
+
+// PrepareForReading flushes the backing to disk, and sets all the shards
+// back to the beginning of their contents.
+func (pa *PackedArray) PrepareForReading() error {
+	if pa.backing.removed {
+		return ErrRemoved
+	}
+	if pa.backing.file != nil {
+		if err := pa.backing.syncFile(); err != nil {
+			return err
+		}
+	}
+	for _, s := range pa.shards {
+		if err := s.PrepareForReading(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the backing, and the dedicated buffers of the large shards
+// (see Buffer.Close).
+func (pa *PackedArray) Close() error {
+	err := pa.backing.Close()
+	for _, s := range pa.shards {
+		if s.buf == nil {
+			continue
+		}
+		if cerr := s.buf.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Remove removes the backing, and the dedicated buffers of the large shards
+// (see Buffer.Remove). After Remove, the shards can't be used anymore.
+func (pa *PackedArray) Remove() error {
+	err := pa.backing.Remove()
+	for _, s := range pa.shards {
+		if s.buf == nil {
+			continue
+		}
+		if rerr := s.buf.Remove(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// Len returns the number of bytes in the shard.
+func (s *PackedShard) Len() int64 {
+	if s.buf != nil {
+		return s.buf.Size()
+	}
+	return s.size
+}
+
+// Write appends the contents of p to the shard.
+func (s *PackedShard) Write(p []byte) (int, error) {
+	if s.buf == nil && s.size+int64(len(p)) > s.pa.maxShardSize {
+		if err := s.unpack(); err != nil {
+			return 0, err
+		}
+	}
+	if s.buf != nil {
+		return s.buf.Write(p)
+	}
+	off := s.pa.size
+	n, err := s.pa.backing.Write(p)
+	s.pa.size += int64(n)
+	s.appendRange(off, int64(n))
+	return n, err
+}
+
+// WriteString is like Write, for strings.
+func (s *PackedShard) WriteString(str string) (int, error) {
+	if s.buf == nil && s.size+int64(len(str)) > s.pa.maxShardSize {
+		if err := s.unpack(); err != nil {
+			return 0, err
+		}
+	}
+	if s.buf != nil {
+		return s.buf.WriteString(str)
+	}
+	off := s.pa.size
+	n, err := s.pa.backing.WriteString(str)
+	s.pa.size += int64(n)
+	s.appendRange(off, int64(n))
+	return n, err
+}
+
+// appendRange records that the n bytes at off of the backing
+// are the next bytes of the shard.
+func (s *PackedShard) appendRange(off, n int64) {
+	if n == 0 {
+		return
+	}
+	s.size += n
+	if last := len(s.ranges) - 1; last >= 0 && s.ranges[last].off+s.ranges[last].n == off {
+		s.ranges[last].n += n
+		return
+	}
+	s.ranges = append(s.ranges, packedRange{off, n})
+}
+
+// unpack moves the contents of the shard to a dedicated buffer.
+func (s *PackedShard) unpack() error {
+	buf := New(s.pa.toDisk, s.pa.opts...)
+	for _, r := range s.ranges {
+		section := io.NewSectionReader(readerAtFunc(s.pa.backing.readAt), r.off, r.n)
+		if _, err := io.Copy(buf, section); err != nil {
+			buf.Remove()
+			return err
+		}
+	}
+	if s.roff > 0 {
+		if err := buf.PrepareForReadingNoSync(); err != nil {
+			buf.Remove()
+			return err
+		}
+		if _, err := io.CopyN(io.Discard, buf, s.roff); err != nil {
+			buf.Remove()
+			return err
+		}
+	}
+	s.buf = buf
+	s.ranges = nil
+	s.size = 0
+	return nil
+}
+
+// Read reads the next len(p) bytes from the shard, or until the shard
+// is drained; at the end of the shard, err is io.EOF.
+func (s *PackedShard) Read(p []byte) (int, error) {
+	if s.buf != nil {
+		return s.buf.Read(p)
+	}
+	if s.pa.backing.removed {
+		return 0, ErrRemoved
+	}
+	if s.roff >= s.size {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	var n int
+	start := int64(0)
+	for _, r := range s.ranges {
+		if n == len(p) {
+			break
+		}
+		if s.roff >= start+r.n {
+			start += r.n
+			continue
+		}
+		skip := s.roff - start
+		want := r.n - skip
+		if want > int64(len(p)-n) {
+			want = int64(len(p) - n)
+		}
+		m, err := s.pa.backing.readAt(p[n:n+int(want)], r.off+skip)
+		n += m
+		s.roff += int64(m)
+		if err != nil && !(err == io.EOF && int64(m) == want) {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		start += r.n
+	}
+	return n, nil
+}
+
+// WriteTo writes the rest of the contents of the shard to w.
+func (s *PackedShard) WriteTo(w io.Writer) (int64, error) {
+	if s.buf != nil {
+		return io.Copy(w, s.buf)
+	}
+	if s.pa.backing.removed {
+		return 0, ErrRemoved
+	}
+	var n int64
+	start := int64(0)
+	for _, r := range s.ranges {
+		if s.roff >= start+r.n {
+			start += r.n
+			continue
+		}
+		skip := s.roff - start
+		section := io.NewSectionReader(readerAtFunc(s.pa.backing.readAt), r.off+skip, r.n-skip)
+		m, err := io.Copy(w, section)
+		n += m
+		s.roff += m
+		if err != nil {
+			return n, err
+		}
+		if m < r.n-skip {
+			return n, io.ErrUnexpectedEOF
+		}
+		start += r.n
+	}
+	return n, nil
+}
+
+// PrepareForReading sets the shard back to the beginning of its contents.
+func (s *PackedShard) PrepareForReading() error {
+	if s.buf != nil {
+		return s.buf.PrepareForReading()
+	}
+	if s.pa.backing.removed {
+		return ErrRemoved
+	}
+	s.roff = 0
+	return nil
+}
+
+// readerAtFunc adapts a function to io.ReaderAt.
+type readerAtFunc func(p []byte, off int64) (int, error)
+
+func (f readerAtFunc) ReadAt(p []byte, off int64) (int, error) {
+	return f(p, off)
+}
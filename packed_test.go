@@ -0,0 +1,153 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPackedArrayInterleavedWrites(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		pa := NewPackedArray(3, toDisk, 1000)
+		want := make([]string, pa.Len())
+		for i := 0; i < 30; i++ {
+			s := pa.Shard(i % 3)
+			chunk := strings.Repeat(string(rune('a'+i%3)), i+1)
+			if i%2 == 0 {
+				s.Write([]byte(chunk))
+			} else {
+				s.WriteString(chunk)
+			}
+			want[i%3] += chunk
+		}
+		if err := pa.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+		var total int64
+		for i := 0; i < pa.Len(); i++ {
+			s := pa.Shard(i)
+			if s.Len() != int64(len(want[i])) {
+				t.Errorf("toDisk %v: shard %d: Len %d, want %d", toDisk, i, s.Len(), len(want[i]))
+			}
+			total += s.Len()
+			// Read, in small pieces across the ranges of the shard.
+			var got []byte
+			p := make([]byte, 7)
+			for {
+				n, err := s.Read(p)
+				got = append(got, p[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if string(got) != want[i] {
+				t.Errorf("toDisk %v: shard %d: Read got %q, want %q", toDisk, i, got, want[i])
+			}
+			// WriteTo, from the beginning and then from the middle.
+			s.PrepareForReading()
+			var sb strings.Builder
+			if _, err := s.WriteTo(&sb); err != nil || sb.String() != want[i] {
+				t.Errorf("toDisk %v: shard %d: WriteTo got %q, %v, want %q", toDisk, i, sb.String(), err, want[i])
+			}
+			s.PrepareForReading()
+			io.ReadFull(s, p[:5])
+			sb.Reset()
+			if _, err := s.WriteTo(&sb); err != nil || sb.String() != want[i][5:] {
+				t.Errorf("toDisk %v: shard %d: WriteTo after Read got %q, %v, want %q", toDisk, i, sb.String(), err, want[i][5:])
+			}
+		}
+		if pa.TotalLen() != total {
+			t.Errorf("toDisk %v: TotalLen %d, want %d", toDisk, pa.TotalLen(), total)
+		}
+		pa.Remove()
+	}
+}
+
+func TestPackedArrayUnpack(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		pa := NewPackedArray(2, toDisk, 10)
+		small, large := pa.Shard(0), pa.Shard(1)
+		large.WriteString("0123")
+		small.WriteString("ab")
+		large.WriteString("4567")
+		if large.buf != nil {
+			t.Errorf("toDisk %v: shard unpacked before maxShardSize", toDisk)
+		}
+		// Past maxShardSize: the shard moves to its own buffer.
+		large.WriteString("89XYZ")
+		if large.buf == nil {
+			t.Fatalf("toDisk %v: shard not unpacked past maxShardSize", toDisk)
+		}
+		large.Write([]byte("!"))
+		small.WriteString("cd")
+		if err := pa.PrepareForReading(); err != nil {
+			t.Fatal(err)
+		}
+		if large.Len() != 14 || pa.TotalLen() != 18 {
+			t.Errorf("toDisk %v: got Len %d, TotalLen %d, want 14, 18", toDisk, large.Len(), pa.TotalLen())
+		}
+		if got, err := io.ReadAll(large); err != nil || string(got) != "0123456789XYZ!" {
+			t.Errorf("toDisk %v: Read got %q, %v", toDisk, got, err)
+		}
+		large.PrepareForReading()
+		var sb strings.Builder
+		if _, err := large.WriteTo(&sb); err != nil || sb.String() != "0123456789XYZ!" {
+			t.Errorf("toDisk %v: WriteTo got %q, %v", toDisk, sb.String(), err)
+		}
+		if got, err := io.ReadAll(small); err != nil || string(got) != "abcd" {
+			t.Errorf("toDisk %v: small shard got %q, %v", toDisk, got, err)
+		}
+		pa.Remove()
+	}
+}
+
+func TestPackedArrayUnpackWhileReading(t *testing.T) {
+	pa := NewPackedArray(1, true, 10)
+	defer pa.Remove()
+	s := pa.Shard(0)
+	s.WriteString("0123456789")
+	pa.PrepareForReading()
+	p := make([]byte, 4)
+	if _, err := io.ReadFull(s, p); err != nil {
+		t.Fatal(err)
+	}
+	// Unpacked at the read offset.
+	s.WriteString("abc")
+	s.PrepareForReading()
+	if got, err := io.ReadAll(s); err != nil || string(got) != "0123456789abc" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestPackedArrayRemove(t *testing.T) {
+	pa := NewPackedArray(2, true, 4)
+	pa.Shard(0).WriteString("ab")
+	pa.Shard(1).WriteString("too large")
+	names := []string{pa.backing.file.Name(), pa.Shard(1).buf.file.Name()}
+	if err := pa.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s: got %v, want it removed", name, err)
+		}
+	}
+	p := make([]byte, 1)
+	if _, err := pa.Shard(0).Read(p); err != ErrRemoved {
+		t.Errorf("Read after Remove: got %v, want ErrRemoved", err)
+	}
+	if _, err := pa.Shard(0).WriteTo(new(bytes.Buffer)); err != ErrRemoved {
+		t.Errorf("WriteTo after Remove: got %v, want ErrRemoved", err)
+	}
+	if err := pa.PrepareForReading(); err != ErrRemoved {
+		t.Errorf("PrepareForReading after Remove: got %v, want ErrRemoved", err)
+	}
+	if err := pa.Remove(); err != nil {
+		t.Errorf("second Remove: %v", err)
+	}
+}
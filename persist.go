@@ -0,0 +1,102 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Persist keeps the contents of the buffer as the file path, replacing any
+// file there, and removes the buffer, whose contents are consumed: from then
+// on, it returns ErrRemoved, like after Remove.
+//
+// For a disk-backed buffer whose temp file holds the contents as is (an OS
+// file, without transforms, see WithWritePipeline), the temp file is
+// fsynced and renamed to path, without copying anything. Otherwise, e.g.
+// for RAM-backed buffers, or if path is on another filesystem, the contents
+// are written to a temp file in the directory of path, which is then
+// renamed to path, so that path never holds partial contents. The file has
+// the permissions of WithFileMode, or 0600. With WithDurableDir, the
+// directory of path is fsynced too. Sink buffers return ErrUnsupported.
+//
+// If Persist fails, the buffer is left as is.
+func (b *Buffer) Persist(path string) error {
+	if err := b.checkOpen(); err != nil {
+		return err
+	}
+	if b.sink != nil {
+		return ErrUnsupported
+	}
+	renamed, err := b.renameFile(path)
+	if err != nil {
+		return err
+	}
+	if !renamed {
+		if err := b.copyToFile(path); err != nil {
+			return err
+		}
+	}
+	if b.durableDir {
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			return err
+		}
+	}
+	b.persisted = renamed
+	return b.Remove()
+}
+
+// renameFile renames the temp file of the buffer to path, if it holds the
+// contents as is, and reports whether it did.
+func (b *Buffer) renameFile(path string) (bool, error) {
+	if _, ok := b.fs.(osFS); !ok || b.file == nil || b.transformed() {
+		return false, nil
+	}
+	if err := b.flushWrites(); err != nil {
+		return false, err
+	}
+	info, err := b.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() != b.Size() {
+		return false, nil
+	}
+	if err := b.syncFile(); err != nil {
+		return false, err
+	}
+	// Renaming fails across filesystems: copy the contents, then.
+	return os.Rename(b.file.Name(), path) == nil, nil
+}
+
+// copyToFile writes the contents of the buffer to a temp file in the
+// directory of path, and renames it to path.
+func (b *Buffer) copyToFile(path string) error {
+	r, err := b.Reader()
+	if err != nil {
+		return err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = b.setFileMode(file)
+	if err == nil {
+		_, err = io.Copy(file, r)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
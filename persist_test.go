@@ -0,0 +1,58 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersist(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name    string
+		new     func() *Buffer
+		renamed bool
+	}{
+		{"ram", func() *Buffer { return New(false) }, false},
+		{"disk", func() *Buffer { return New(true) }, true},
+		{"gzip", func() *Buffer { return New(true, WithGzip()) }, false},
+		{"blocks", func() *Buffer { return New(true, WithBlockSize(1024)) }, true},
+	} {
+		b := tc.new()
+		b.WriteString("kept as a file")
+		var tempName string
+		var tempInfo os.FileInfo
+		if b.file != nil {
+			tempName = b.file.Name()
+			tempInfo, _ = os.Stat(tempName)
+		}
+		path := filepath.Join(dir, tc.name)
+		if err := b.Persist(path); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != "kept as a file" {
+			t.Errorf("%s: got %q, want %q", tc.name, got, "kept as a file")
+		}
+		if info, _ := os.Stat(path); tc.renamed && !os.SameFile(info, tempInfo) {
+			t.Errorf("%s: got a copy, want the temp file renamed", tc.name)
+		}
+		if _, err := b.WriteString("x"); err != ErrRemoved {
+			t.Errorf("%s: got %v after Persist, want ErrRemoved", tc.name, err)
+		}
+		if tempName != "" {
+			if _, err := os.Stat(tempName); !os.IsNotExist(err) {
+				t.Errorf("%s: got %v, want the temp file gone", tc.name, err)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 4 {
+		t.Errorf("got %d files, want 4, without temp files left", len(entries))
+	}
+
+	s := NewSink(io.Discard)
+	defer s.Remove()
+	if err := s.Persist(filepath.Join(dir, "sink")); err != ErrUnsupported {
+		t.Errorf("sink: got %v, want ErrUnsupported", err)
+	}
+}
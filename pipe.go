@@ -0,0 +1,189 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"sync"
+)
+
+// NewPipe returns the halves of an unbounded pipe, like io.Pipe, but
+// buffered: the writes don't wait for the reads. Up to maxRAM bytes written
+// and not read yet are held in RAM; when the reader lags further behind,
+// the writes go to a disk-backed buffer (created like New(true, opts...)),
+// which the reader drains in turn, so that the writer never blocks. The
+// reads block until there's data, or until the writer closes its half.
+//
+// Both halves are safe for concurrent use. The temp file of the pipe is
+// removed once the reader has read everything up to the close of the writer,
+// or closed its half.
+func NewPipe(maxRAM int64, opts ...Option) (*PipeReader, *PipeWriter) {
+	p := &pipe{
+		maxRAM: maxRAM,
+		opts:   opts,
+	}
+	p.cond.L = &p.mu
+	return &PipeReader{p}, &PipeWriter{p}
+}
+
+// pipe is the state shared by the halves of a pipe. The bytes not read yet
+// are the RAM ones, mem[memOff:], followed by those of the disk buffer from
+// diskOff: while the disk buffer holds any, the writes go to it.
+type pipe struct {
+	maxRAM int64
+	opts   []Option
+
+	mu      sync.Mutex
+	cond    sync.Cond
+	mem     []byte
+	memOff  int
+	disk    *Buffer
+	diskOff int64
+	// wclosed is true once the writer closed its half, with the error werr,
+	// if any; rclosed is true once the reader closed its half.
+	wclosed bool
+	werr    error
+	rclosed bool
+}
+
+// PipeReader is the read half of a pipe (see NewPipe).
+type PipeReader struct {
+	p *pipe
+}
+
+// PipeWriter is the write half of a pipe (see NewPipe).
+type PipeWriter struct {
+	p *pipe
+}
+
+// Write appends p to the pipe, without waiting for the reader. After the
+// reader closed its half, it returns io.ErrClosedPipe; after the writer
+// closed its half, ErrWriteClosed.
+func (w *PipeWriter) Write(p []byte) (int, error) {
+	pp := w.p
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	switch {
+	case pp.rclosed:
+		return 0, io.ErrClosedPipe
+	case pp.wclosed:
+		return 0, ErrWriteClosed
+	case len(p) == 0:
+		return 0, nil
+	}
+	defer pp.cond.Broadcast()
+	if !pp.diskPending() && int64(len(pp.mem)-pp.memOff+len(p)) <= pp.maxRAM {
+		pp.mem = append(pp.mem, p...)
+		return len(p), nil
+	}
+	if pp.disk == nil {
+		disk, err := NewBuffer(true, pp.opts...)
+		if err != nil {
+			return 0, err
+		}
+		pp.disk = disk
+	}
+	return pp.disk.Write(p)
+}
+
+// Close closes the write half of the pipe: the reader returns io.EOF
+// once it has read everything written before.
+func (w *PipeWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError closes the write half of the pipe, like Close, but the
+// reader returns err (if not nil) instead of io.EOF.
+func (w *PipeWriter) CloseWithError(err error) error {
+	p := w.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.wclosed {
+		p.wclosed = true
+		p.werr = err
+		p.cond.Broadcast()
+	}
+	return nil
+}
+
+// Read reads from the pipe what was written and not read yet, waiting for
+// the writer if there's nothing. Once the writer closed its half and
+// everything has been read, it returns io.EOF, or the error given to
+// CloseWithError. After the reader closed its half, it returns
+// io.ErrClosedPipe.
+func (r *PipeReader) Read(b []byte) (int, error) {
+	p := r.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		switch {
+		case p.rclosed:
+			return 0, io.ErrClosedPipe
+		case len(b) == 0:
+			return 0, nil
+		case p.memOff < len(p.mem):
+			n := copy(b, p.mem[p.memOff:])
+			p.memOff += n
+			if p.memOff == len(p.mem) {
+				p.mem = p.mem[:0]
+				p.memOff = 0
+			}
+			return n, nil
+		case p.diskPending():
+			return p.readDisk(b)
+		case p.wclosed:
+			p.removeDisk()
+			if p.werr != nil {
+				return 0, p.werr
+			}
+			return 0, io.EOF
+		}
+		p.cond.Wait()
+	}
+}
+
+// Close closes the read half of the pipe, dropping what wasn't read:
+// the writes then fail with io.ErrClosedPipe.
+func (r *PipeReader) Close() error {
+	p := r.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rclosed {
+		return nil
+	}
+	p.rclosed = true
+	p.mem = nil
+	p.cond.Broadcast()
+	return p.removeDisk()
+}
+
+// diskPending reports whether the disk buffer holds bytes not read yet.
+func (p *pipe) diskPending() bool {
+	return p.disk != nil && p.diskOff < p.disk.Size()
+}
+
+// readDisk reads from the disk buffer; once it's drained, it's emptied,
+// keeping its temp file, so that the next writes go to RAM again.
+func (p *pipe) readDisk(b []byte) (int, error) {
+	n, err := p.disk.ReadAt(b, p.diskOff)
+	p.diskOff += int64(n)
+	if n > 0 {
+		err = nil
+	}
+	if p.diskOff == p.disk.Size() {
+		if rerr := p.disk.Reset(); rerr != nil && err == nil {
+			err = rerr
+		}
+		p.diskOff = 0
+	}
+	return n, err
+}
+
+// removeDisk removes the disk buffer, if any.
+func (p *pipe) removeDisk() error {
+	if p.disk == nil {
+		return nil
+	}
+	err := p.disk.Remove()
+	p.disk = nil
+	p.diskOff = 0
+	return err
+}
@@ -0,0 +1,71 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	r, w := NewPipe(64)
+	var want bytes.Buffer
+	done := make(chan []byte)
+	go func() {
+		got, _ := io.ReadAll(r)
+		done <- got
+	}()
+	// The writer runs ahead of the reader, through RAM and disk.
+	for i := 0; i < 1000; i++ {
+		record := bytes.Repeat([]byte{byte('a' + i%26)}, i%50)
+		want.Write(record)
+		if _, err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	if got := <-done; !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("got %d bytes, want %d, in order", len(got), want.Len())
+	}
+	if r.p.disk != nil {
+		t.Error("got the disk buffer kept after the end, want it removed")
+	}
+}
+
+func TestPipeSpillsWhenLagging(t *testing.T) {
+	r, w := NewPipe(4)
+	w.Write([]byte("0123"))
+	w.Write([]byte("4567"))
+	w.Write([]byte("89"))
+	if r.p.disk == nil || r.p.disk.Size() != 6 {
+		t.Fatal("got the writes past maxRAM kept in RAM, want them on disk")
+	}
+	p := make([]byte, 3)
+	var got []byte
+	for len(got) < 10 {
+		n, err := r.Read(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p[:n]...)
+	}
+	if string(got) != "0123456789" {
+		t.Errorf("got %q, want %q", got, "0123456789")
+	}
+	// Drained: the next writes go to RAM again.
+	w.Write([]byte("ab"))
+	if r.p.memOff != 0 || string(r.p.mem) != "ab" {
+		t.Errorf("got RAM %q, want %q", r.p.mem, "ab")
+	}
+
+	stop := errors.New("stop")
+	w.CloseWithError(stop)
+	r.Read(p)
+	if _, err := r.Read(p); err != stop {
+		t.Errorf("got %v, want the error of the writer", err)
+	}
+	r.Close()
+	if _, err := w.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("got %v after the reader closed, want io.ErrClosedPipe", err)
+	}
+}
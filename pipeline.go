@@ -0,0 +1,187 @@
+package ramdiskbuffer
+
+import (
+	"io"
+)
+
+// WithWritePipeline makes a disk-backed buffer transform the bytes written
+// to it before they reach its temp file: the writes go through the stages,
+// in order (the first stage gets the bytes written to the buffer, and the
+// last one writes to the file). Each stage is created on the first write
+// after PrepareForReading (or after the buffer is created), and closed
+// exactly once, by the next PrepareForReading or by Close; its Close must
+// flush it, without closing the writer it wraps.
+//
+// The matching stages that undo the transforms must be given to
+// WithReadPipeline. Together, they are the extension point for e.g.
+// compression (see WithCompressor), encryption or hashing. Options that
+// add stages add them after the ones added before. They have no effect on
+// RAM-backed buffers.
+//
+// Writing after PrepareForReading appends a new transformed stream after
+// the previous one, so the read stages must handle concatenated streams.
+// Size is the number of bytes written to the buffer, before the transforms;
+// PhysicalLen is the size of the temp file. TailReader is not supported on
+// transformed buffers.
+//
+// Transformed files start with a small header that identifies their codec.
+// The buffer knows whether it wrote the header to its file, so the header
+// is never looked for in the bytes of the files that don't have one: the
+// contents of a file that was not transformed are read back as they were
+// written, whatever they start with.
+func WithWritePipeline(stages ...func(io.Writer) io.WriteCloser) Option {
+	return func(b *Buffer) {
+		b.writeStages = append(b.writeStages, stages...)
+		b.codec = codecCustom
+	}
+}
+
+// WithReadPipeline sets the stages that undo the transforms of the write
+// pipeline (see WithWritePipeline), when reading the temp file of a
+// disk-backed buffer: the stage i undoes the stage i of the write pipeline,
+// so the stages are applied in the reverse order (the last stage reads
+// from the file, and the first one returns the bytes read from the buffer).
+func WithReadPipeline(stages ...func(io.Reader) io.Reader) Option {
+	return func(b *Buffer) {
+		b.readStages = append(b.readStages, stages...)
+	}
+}
+
+// transformed reports whether the writes to the file go
+// through a write pipeline.
+func (b *Buffer) transformed() bool {
+	return len(b.writeStages) > 0
+}
+
+// transformedMagic starts the header of transformed files;
+// the header ends with the byte of the codec.
+const transformedMagic = "\x89RDBUFZ\n"
+
+// The codecs of transformed files.
+const (
+	// codecCustom is for the files transformed by any write pipeline.
+	codecCustom = 'c'
+	// codecGzip is for the files transformed only by gzip (see WithGzip),
+	// which can be read back without a read pipeline.
+	codecGzip = 'g'
+)
+
+// fileReadPipeline returns the read pipeline for f, a handle of the temp
+// file at its beginning: if the buffer wrote the header to the file (see
+// hasHeader), it reads it, leaving f at the end of it, and the pipeline is
+// the one of the codec of the header, whatever the codec of the buffer;
+// otherwise, the file is not transformed: the pipeline is nil, and the
+// offset of f is unchanged.
+//
+// It returns ErrCorrupted if the file doesn't start with a header,
+// and ErrUnsupported if the buffer can't undo the codec of the header
+// (i.e. custom transforms, without WithReadPipeline).
+func (b *Buffer) fileReadPipeline(f File) (func(io.Reader) io.Reader, error) {
+	if !b.hasHeader {
+		return nil, nil
+	}
+	var header [len(transformedMagic) + 1]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrCorrupted
+		}
+		return nil, err
+	}
+	if string(header[:len(transformedMagic)]) != transformedMagic {
+		return nil, ErrCorrupted
+	}
+	switch header[len(transformedMagic)] {
+	case codecGzip:
+		return GzipDecompressor, nil
+	case codecCustom:
+		if len(b.readStages) > 0 {
+			return b.readPipeline, nil
+		}
+	}
+	return nil, ErrUnsupported
+}
+
+// readPipeline applies the read stages to r.
+func (b *Buffer) readPipeline(r io.Reader) io.Reader {
+	for i := len(b.readStages) - 1; i >= 0; i-- {
+		r = b.readStages[i](r)
+	}
+	return r
+}
+
+// writeTransformed writes p, or s if p is nil, to the write pipeline
+// of the file, creating it if needed (see writeToFile).
+func (b *Buffer) writeTransformed(p []byte, s string) (n int, err error) {
+	if !b.hasHeader {
+		if _, err := b.writeFile(append([]byte(transformedMagic), b.codec)); err != nil {
+			return 0, err
+		}
+		b.hasHeader = true
+	}
+	if b.pw == nil {
+		b.pw = newPipelineWriter(fileWriter{b}, b.writeStages)
+	}
+	if p != nil {
+		n, err = b.pw.Write(p)
+	} else {
+		n, err = io.WriteString(b.pw, s)
+	}
+	return n, err
+}
+
+// closePipeline flushes and closes the write pipeline of the file, if any,
+// and then flushes the write buffer (see WithBlockSize).
+func (b *Buffer) closePipeline() error {
+	if b.pw != nil {
+		// Closing the stages writes their trailers.
+		b.dirty = true
+		err := b.pw.Close()
+		b.pw = nil
+		if err != nil {
+			return err
+		}
+	}
+	return b.flushWrites()
+}
+
+// pipelineWriter is a chain of write stages.
+type pipelineWriter struct {
+	io.Writer
+	// stages are the stages, from the first one to the last one.
+	stages []io.WriteCloser
+}
+
+func newPipelineWriter(w io.Writer, newStages []func(io.Writer) io.WriteCloser) *pipelineWriter {
+	stages := make([]io.WriteCloser, len(newStages))
+	for i := len(newStages) - 1; i >= 0; i-- {
+		stages[i] = newStages[i](w)
+		w = stages[i]
+	}
+	return &pipelineWriter{Writer: w, stages: stages}
+}
+
+// Close closes the stages from the first one, so that each one
+// flushes to the next before it's closed.
+func (w *pipelineWriter) Close() error {
+	for _, stage := range w.stages {
+		if err := stage.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileWriter writes to the file of a buffer, bypassing the write pipeline.
+type fileWriter struct {
+	b *Buffer
+}
+
+func (w fileWriter) Write(p []byte) (int, error) {
+	return w.b.writeFile(p)
+}
+
+// readCloser is a reader with a separate closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,83 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestPlainFileStartingWithTransformedMagic(t *testing.T) {
+	for _, codec := range []byte{codecGzip, codecCustom} {
+		b := New(true)
+		defer b.Remove()
+		want := transformedMagic + string(codec) + "payload"
+		if _, err := b.WriteString(want); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatalf("codec %q: PrepareForReading: %v", codec, err)
+		}
+		got, err := io.ReadAll(b)
+		if err != nil || string(got) != want {
+			t.Errorf("codec %q: got %q, %v, want %q", codec, got, err, want)
+		}
+	}
+}
+
+func TestReadPipelineFromHeader(t *testing.T) {
+	// A file written with gzip.
+	src := New(true, WithGzip())
+	defer src.Remove()
+	src.WriteString("payload")
+	if err := src.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	gzipped, err := os.ReadFile(src.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := append([]byte(nil), gzipped...)
+	corrupted[1] ^= 0xff
+	unknown := append([]byte(nil), gzipped...)
+	unknown[len(transformedMagic)] = 'z'
+	custom := append([]byte(nil), gzipped...)
+	custom[len(transformedMagic)] = codecCustom
+	for _, test := range []struct {
+		name     string
+		contents []byte
+		opts     []Option
+		err      error
+	}{
+		// The codec is the one of the header, not the one of the buffer.
+		{"gzip, no pipeline", gzipped, nil, nil},
+		{"gzip, custom pipeline", gzipped, []Option{WithReadPipeline(func(r io.Reader) io.Reader { return r })}, nil},
+		{"bad magic", corrupted, nil, ErrCorrupted},
+		{"truncated header", gzipped[:3], nil, ErrCorrupted},
+		{"unknown codec", unknown, nil, ErrUnsupported},
+		{"custom codec, no read pipeline", custom, nil, ErrUnsupported},
+	} {
+		b := New(true, test.opts...)
+		b.Write(test.contents)
+		// As if the buffer had written the header.
+		b.hasHeader = true
+		err := b.PrepareForReading()
+		if err != test.err {
+			t.Errorf("%s: PrepareForReading: got %v, want %v", test.name, err, test.err)
+		}
+		r, rerr := b.Reader()
+		if rerr != test.err {
+			t.Errorf("%s: Reader: got %v, want %v", test.name, rerr, test.err)
+		}
+		if c, ok := r.(io.Closer); ok {
+			c.Close()
+		}
+		if err == nil {
+			got, err := io.ReadAll(b)
+			if err != nil || string(got) != "payload" {
+				t.Errorf("%s: got %q, %v, want %q", test.name, got, err, "payload")
+			}
+		}
+		b.Remove()
+	}
+}
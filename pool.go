@@ -0,0 +1,103 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+	"sync"
+)
+
+// BufferPool recycles the buffers of short-lived payloads (see
+// NewBufferPool): a disk-backed buffer put back keeps its temp file,
+// truncated, for the next Get, which saves the syscalls of creating and
+// unlinking a temp file per buffer; a RAM-backed one keeps its backing.
+// It's safe for concurrent use.
+//
+// Unlike sync.Pool, the pool holds its buffers until they're reused or the
+// pool is closed: a pool that's dropped without Close leaks the temp files
+// of its idle buffers.
+type BufferPool struct {
+	toDisk bool
+	opts   []Option
+
+	mu     sync.Mutex
+	size   int
+	idle   []*Buffer
+	closed bool
+}
+
+// NewBufferPool returns a pool creating its buffers like New(toDisk,
+// opts...), and holding up to size idle buffers; size <= 0 means 1.
+func NewBufferPool(size int, toDisk bool, opts ...Option) *BufferPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &BufferPool{
+		toDisk: toDisk,
+		opts:   opts,
+		size:   size,
+	}
+}
+
+// Get returns an idle buffer of the pool, empty and in write mode, or a new
+// buffer if none is idle. Like New, it panics if the buffer can't be
+// created.
+func (p *BufferPool) Get() *Buffer {
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		b := p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return b
+	}
+	p.mu.Unlock()
+	return New(p.toDisk, p.opts...)
+}
+
+// Put empties b (see ResetTo) and keeps it for the next Get; b must not be
+// used by the caller afterwards. The buffers that can't be reused (those
+// closed, write-closed or sinks), and those in excess of the size of the
+// pool, are removed instead; so are all the buffers put after Close.
+// Putting a removed buffer does nothing.
+func (p *BufferPool) Put(b *Buffer) error {
+	if b.removed {
+		return nil
+	}
+	if b.closed || b.writeClosed || b.sink != nil {
+		return b.Remove()
+	}
+	p.mu.Lock()
+	if p.closed || len(p.idle) >= p.size {
+		p.mu.Unlock()
+		return b.Remove()
+	}
+	p.mu.Unlock()
+	if err := b.ResetTo(p.toDisk); err != nil {
+		return errors.Join(err, b.Remove())
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || len(p.idle) >= p.size {
+		// Closed, or filled, while b was reset.
+		return b.Remove()
+	}
+	p.idle = append(p.idle, b)
+	return nil
+}
+
+// Idle returns the number of idle buffers held by the pool.
+func (p *BufferPool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// Close removes the idle buffers of the pool; the buffers put afterwards
+// are removed too. Get still works, creating new buffers.
+func (p *BufferPool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+	return BufferArray(idle).Remove()
+}
@@ -0,0 +1,51 @@
+package ramdiskbuffer
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	p := NewBufferPool(1, true)
+	b := p.Get()
+	b.WriteString("first payload")
+	name := b.file.Name()
+	if err := p.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	b = p.Get()
+	if b.file.Name() != name || b.Size() != 0 {
+		t.Errorf("got file %s of size %d, want the recycled file %s, empty", b.file.Name(), b.Size(), name)
+	}
+	b.WriteString("second")
+	if got, _ := b.String(); got != "second" {
+		t.Errorf("got %q, want %q", got, "second")
+	}
+
+	// The pool holds one buffer: the other one is removed.
+	other := p.Get()
+	otherName := other.file.Name()
+	p.Put(b)
+	p.Put(other)
+	if !other.removed || p.Idle() != 1 {
+		t.Errorf("got removed %v, %d idle, want the excess buffer removed, 1 idle", other.removed, p.Idle())
+	}
+	if _, err := os.Stat(otherName); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the temp file of the excess buffer removed", err)
+	}
+
+	closed := New(false)
+	closed.CloseWrite()
+	p.Put(closed)
+	if !closed.removed {
+		t.Error("got a write-closed buffer recycled, want it removed")
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !b.removed || p.Idle() != 0 {
+		t.Errorf("got removed %v, %d idle, want the idle buffer removed by Close", b.removed, p.Idle())
+	}
+}
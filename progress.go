@@ -0,0 +1,66 @@
+package ramdiskbuffer
+
+// BufferStats are the counters of a buffer (see Stats).
+type BufferStats struct {
+	// Written is the number of bytes written to the buffer by the caller,
+	// including the bytes overwritten by WriteAt.
+	Written int64
+	// Read is the number of bytes returned by Read, WriteTo and the other
+	// reading methods of the buffer (but not by the readers returned
+	// by Reader).
+	Read int64
+	// Spills is the number of times the RAM backing was moved to disk
+	// (see SpillToDisk).
+	Spills int64
+	// Mode is the current backing: "ram", "disk" or "sink".
+	Mode string
+}
+
+// Stats returns the counters of the buffer. The counters of bytes are
+// atomic, like Size, so that a goroutine can report the progress of a
+// buffer while another one writes or reads it.
+func (b *Buffer) Stats() BufferStats {
+	return BufferStats{
+		Written: b.written.Load(),
+		Read:    b.readCount.Load(),
+		Spills:  b.spillCount.Load(),
+		Mode:    b.mode(),
+	}
+}
+
+// WithProgress makes the buffer call fn, synchronously, after each write
+// and read that moved bytes, with the total numbers of bytes written and
+// read so far (see Stats), e.g. to drive a progress bar. The clones and
+// snapshots of the buffer don't report their progress.
+func WithProgress(fn func(written, read int64)) Option {
+	return func(b *Buffer) {
+		b.progress = fn
+	}
+}
+
+// countWritten counts n bytes written, reporting it to the progress
+// callback, if any.
+func (b *Buffer) countWritten(n int64) {
+	if n <= 0 {
+		return
+	}
+	written := b.written.Add(n)
+	if b.progress != nil {
+		b.progress(written, b.readCount.Load())
+	}
+}
+
+// countRead counts n bytes read, reporting it to the progress
+// callback and to the metrics collector, if any.
+func (b *Buffer) countRead(n int64) {
+	if n <= 0 {
+		return
+	}
+	read := b.readCount.Add(n)
+	if c := metricsCollector(); c != nil {
+		c.BufferRead(n)
+	}
+	if b.progress != nil {
+		b.progress(b.written.Load(), read)
+	}
+}
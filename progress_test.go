@@ -0,0 +1,41 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var calls int
+	var lastWritten, lastRead int64
+	b := NewSpill(10, WithProgress(func(written, read int64) {
+		calls++
+		lastWritten, lastRead = written, read
+	}))
+	defer b.Remove()
+
+	b.WriteString("01234")
+	if got := b.Stats(); got != (BufferStats{Written: 5, Mode: "ram"}) {
+		t.Errorf("got %+v, want 5 bytes written in RAM", got)
+	}
+	b.Write([]byte("56789abcdef"))
+	io.Copy(b, strings.NewReader("ghij"))
+	b.WriteAt([]byte("XY"), 0)
+	if got := b.Stats(); got != (BufferStats{Written: 22, Spills: 1, Mode: "disk"}) {
+		t.Errorf("got %+v, want 22 bytes written, 1 spill, on disk", got)
+	}
+
+	b.PrepareForReading()
+	p := make([]byte, 4)
+	b.Read(p)
+	var out bytes.Buffer
+	b.WriteTo(&out)
+	if got := b.Stats(); got.Read != 20 || got.Written != 22 {
+		t.Errorf("got %+v, want 22 bytes written, 20 read", got)
+	}
+	if calls != 6 || lastWritten != 22 || lastRead != 20 {
+		t.Errorf("progress: got %d calls, last (%d, %d), want 6 calls, last (22, 20)", calls, lastWritten, lastRead)
+	}
+}
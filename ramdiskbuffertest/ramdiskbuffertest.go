@@ -0,0 +1,83 @@
+// Package ramdiskbuffertest provides helpers for testing code
+// that uses ramdiskbuffer.
+package ramdiskbuffertest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/gagliardetto/ramdiskbuffer"
+)
+
+// contextLen is the number of bytes shown around the first difference.
+const contextLen = 16
+
+// AssertContents reports a test error if the contents of b
+// are not equal to want.
+//
+// The contents are read via b.Reader, so it works the same for RAM-backed
+// and disk-backed buffers, and it doesn't move the read offset of b:
+// the test can continue using b afterward. There's no need to finalize b
+// first: it can be in write mode, even if it's transformed (e.g. by
+// ramdiskbuffer.WithGzip), since Reader closes its write pipeline; the
+// read mode of b is not affected either.
+func AssertContents(t testing.TB, b *ramdiskbuffer.Buffer, want []byte) {
+	t.Helper()
+
+	got, err := contents(b)
+	if err != nil {
+		t.Errorf("ramdiskbuffer: reading contents: %v", err)
+		return
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("ramdiskbuffer: contents length is %d, want %d", len(got), len(want))
+	}
+	off := firstDifference(got, want)
+	t.Errorf(
+		"ramdiskbuffer: contents differ at offset %d:\n got: %q\nwant: %q",
+		off,
+		window(got, off),
+		window(want, off),
+	)
+}
+
+func contents(b *ramdiskbuffer.Buffer) ([]byte, error) {
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	return ioutil.ReadAll(r)
+}
+
+func firstDifference(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// window returns the bytes of b around off.
+func window(b []byte, off int) []byte {
+	start := off - contextLen
+	if start < 0 {
+		start = 0
+	}
+	end := off + contextLen
+	if end > len(b) {
+		end = len(b)
+	}
+	if start > end {
+		return nil
+	}
+	return b[start:end]
+}
@@ -0,0 +1,55 @@
+package ramdiskbuffertest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/ramdiskbuffer"
+)
+
+func TestAssertContents(t *testing.T) {
+	want := strings.Repeat("contents ", 100)
+	for name, b := range map[string]*ramdiskbuffer.Buffer{
+		"ram":  ramdiskbuffer.New(false),
+		"disk": ramdiskbuffer.New(true),
+		"gzip": ramdiskbuffer.New(true, ramdiskbuffer.WithGzip()),
+	} {
+		defer b.Remove()
+		b.WriteString(want)
+		// In write mode.
+		AssertContents(t, b, []byte(want))
+
+		if err := b.PrepareForReading(); err != nil {
+			t.Fatal(name, err)
+		}
+		b.Read(make([]byte, 10))
+		AssertContents(t, b, []byte(want))
+		if got := b.ReadProgress(); got != 10 {
+			t.Errorf("%s: read offset moved to %d, want 10", name, got)
+		}
+	}
+}
+
+func TestAssertContentsReportsDifference(t *testing.T) {
+	b := ramdiskbuffer.New(false)
+	defer b.Remove()
+	b.WriteString("abcdef")
+	rec := &recorder{TB: t}
+	AssertContents(rec, b, []byte("abcXef"))
+	if len(rec.errors) != 1 || !strings.Contains(rec.errors[0], "offset 3") {
+		t.Errorf("got errors %q, want one at offset 3", rec.errors)
+	}
+}
+
+// recorder records the errors reported to it, instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,195 @@
+package ramdiskbuffer
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BufferInfo describes a live buffer (see ListLive).
+type BufferInfo struct {
+	// Mode is "ram", "disk" or "sink".
+	Mode string
+	// Path is the path of the temp file of a disk-backed buffer,
+	// empty if it has none (yet).
+	Path    string
+	Size    int64
+	Created time.Time
+	Age     time.Duration
+}
+
+// registryEntry is the entry of a live buffer in the registry;
+// Mode and Path are updated when the buffer changes backing.
+type registryEntry struct {
+	info BufferInfo
+	buf  *Buffer
+}
+
+var registry struct {
+	enabled int32
+	mu      sync.Mutex
+	live    map[*Buffer]*registryEntry
+}
+
+// EnableRegistry enables tracking the live buffers of the package (see
+// ListLive), e.g. to find which code path accumulates buffers in a leak
+// investigation. Only the buffers created after it are tracked, until their
+// Remove or Close. The registry is disabled by default, and costs nothing
+// while disabled.
+//
+// The registry holds the tracked buffers: a buffer that's never removed nor
+// closed stays listed, and is never garbage collected (it's leaked anyway,
+// if disk-backed, since its temp file is never removed).
+func EnableRegistry() {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if registry.live == nil {
+		registry.live = make(map[*Buffer]*registryEntry)
+	}
+	atomic.StoreInt32(&registry.enabled, 1)
+}
+
+// ListLive returns the info of the live buffers tracked by the registry
+// (see EnableRegistry), oldest first.
+func ListLive() []BufferInfo {
+	registry.mu.Lock()
+	infos := make([]BufferInfo, 0, len(registry.live))
+	now := time.Now()
+	for _, e := range registry.live {
+		info := e.info
+		info.Size = e.buf.length.Load()
+		info.Age = now.Sub(info.Created)
+		infos = append(infos, info)
+	}
+	registry.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Created.Before(infos[j].Created)
+	})
+	return infos
+}
+
+// liveBuffers is the number of live buffers (created, and neither removed
+// nor closed yet), and maxLiveBuffers the limit set by SetMaxLiveBuffers.
+var liveBuffers, maxLiveBuffers int64
+
+// SetMaxLiveBuffers limits the number of live buffers of the package
+// (created, and neither removed nor closed yet) to n, e.g. to catch runaway
+// buffer creation in tests, or as a last-resort circuit breaker in
+// production: once n buffers are live, creating another one (by New,
+// NewArray, NewSink, Clone, etc.) fails with ErrTooManyBuffers; New panics
+// with it, like for any other failure. The default is 0: no limit.
+//
+// A buffer counts from its creation until its first Remove or Close,
+// like in the registry (see EnableRegistry), which doesn't need to be
+// enabled for the limit to apply. Lowering the limit below the current
+// number of live buffers doesn't affect them.
+func SetMaxLiveBuffers(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt64(&maxLiveBuffers, int64(n))
+}
+
+// LiveBuffers returns the number of live buffers of the package
+// (see SetMaxLiveBuffers).
+func LiveBuffers() int {
+	return int(atomic.LoadInt64(&liveBuffers))
+}
+
+// acquireLiveSlot counts the buffer as live,
+// against the limit of SetMaxLiveBuffers.
+func (b *Buffer) acquireLiveSlot() error {
+	for {
+		n := atomic.LoadInt64(&liveBuffers)
+		if max := atomic.LoadInt64(&maxLiveBuffers); max > 0 && n >= max {
+			return ErrTooManyBuffers
+		}
+		if atomic.CompareAndSwapInt64(&liveBuffers, n, n+1) {
+			b.counted = true
+			return nil
+		}
+	}
+}
+
+// releaseLiveSlot stops counting the buffer as live, if it's counted.
+func (b *Buffer) releaseLiveSlot() {
+	if !b.counted {
+		return
+	}
+	b.counted = false
+	atomic.AddInt64(&liveBuffers, -1)
+}
+
+// register adds the buffer to the registry, if enabled,
+// and to its budget (see WithBudget), and reports it
+// to the metrics collector.
+func (b *Buffer) register() {
+	b.joinBudget()
+	if c := metricsCollector(); c != nil {
+		c.BufferAllocated(b.mode())
+	}
+	if atomic.LoadInt32(&registry.enabled) == 0 {
+		return
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	b.registered = true
+	registry.live[b] = &registryEntry{
+		info: BufferInfo{
+			Mode:    b.mode(),
+			Path:    b.filePath(),
+			Created: time.Now(),
+		},
+		buf: b,
+	}
+}
+
+// updateRegistry updates the mode and the path of the buffer
+// in the registry, if it's tracked.
+func (b *Buffer) updateRegistry() {
+	if !b.registered {
+		return
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if e, ok := registry.live[b]; ok {
+		e.info.Mode = b.mode()
+		e.info.Path = b.filePath()
+	}
+}
+
+// deregister removes the buffer from the registry, if it's tracked,
+// stops counting it as live, removes it from its budget, and reports it
+// to the metrics collector.
+func (b *Buffer) deregister() {
+	if c := metricsCollector(); c != nil && b.counted {
+		c.BufferRemoved(b.mode())
+	}
+	b.releaseLiveSlot()
+	b.leaveBudget()
+	if !b.registered {
+		return
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	delete(registry.live, b)
+	b.registered = false
+}
+
+func (b *Buffer) mode() string {
+	switch {
+	case b.sink != nil:
+		return "sink"
+	case b.toDisk:
+		return "disk"
+	}
+	return "ram"
+}
+
+func (b *Buffer) filePath() string {
+	if b.file == nil {
+		return ""
+	}
+	return b.file.Name()
+}
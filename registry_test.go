@@ -0,0 +1,47 @@
+package ramdiskbuffer
+
+import (
+	"testing"
+)
+
+func TestSetMaxLiveBuffers(t *testing.T) {
+	// Other tests may have left buffers behind: count from here.
+	SetMaxLiveBuffers(LiveBuffers() + 2)
+	defer SetMaxLiveBuffers(0)
+
+	a := New(false)
+	b := New(true)
+	if _, err := a.Clone(); err != ErrTooManyBuffers {
+		t.Errorf("Clone over the limit: got %v, want ErrTooManyBuffers", err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != ErrTooManyBuffers {
+				t.Errorf("New over the limit: got panic %v, want ErrTooManyBuffers", r)
+			}
+		}()
+		New(false)
+	}()
+
+	// Close and Remove give back the slot, once.
+	a.Close()
+	a.Remove()
+	b.Remove()
+
+	// Two slots left: the first two buffers of the array are created,
+	// and removed when the third one fails.
+	live := LiveBuffers()
+	func() {
+		defer func() {
+			if r := recover(); r != ErrTooManyBuffers {
+				t.Errorf("NewArray over the limit: got panic %v, want ErrTooManyBuffers", r)
+			}
+		}()
+		NewArray(3, true)
+	}()
+	if LiveBuffers() != live {
+		t.Errorf("%d live buffers after the failed NewArray, want %d", LiveBuffers(), live)
+	}
+	ba := NewArray(2, true)
+	ba.Remove()
+}
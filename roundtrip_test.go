@@ -0,0 +1,114 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// roundTripBuffers are the kinds of buffers exercised by FuzzBufferRoundTrip.
+var roundTripBuffers = []func() *Buffer{
+	func() *Buffer { return New(false) },
+	func() *Buffer { return New(true) },
+	func() *Buffer { return New(true, WithBlockSize(64)) },
+	func() *Buffer { return New(true, WithReadBufferSize(32)) },
+	func() *Buffer { return New(true, WithGzip()) },
+	func() *Buffer { return NewFromSlice(make([]byte, 0, 100), true) },
+}
+
+// FuzzBufferRoundTrip writes data to a buffer through a sequence of write
+// methods chosen by ops, finalizes the buffer, and then reads it back
+// through a sequence of read methods chosen by ops: the concatenation of
+// the reads must be data.
+func FuzzBufferRoundTrip(f *testing.F) {
+	f.Add(uint8(0), []byte{0, 1, 2, 3, 4}, []byte("hello, world\n"))
+	f.Add(uint8(1), []byte{0x41, 0x12, 0xff, 0x07}, bytes.Repeat([]byte("line\n"), 100))
+	f.Add(uint8(4), []byte{3, 3, 2, 1, 0}, bytes.Repeat([]byte{0, 1, 2, 3}, 1000))
+	f.Add(uint8(5), []byte{0x80, 0x81, 0x82}, bytes.Repeat([]byte("spill"), 50))
+	f.Fuzz(func(t *testing.T, kind uint8, ops, data []byte) {
+		if len(ops) == 0 {
+			ops = []byte{0}
+		}
+		b := roundTripBuffers[int(kind)%len(roundTripBuffers)]()
+		defer b.Remove()
+
+		// Write data, in chunks of up to 64 bytes.
+		rest := data
+		for i := 0; len(rest) > 0; i++ {
+			op := ops[i%len(ops)]
+			n := int(op>>2) + 1
+			if n > len(rest) {
+				n = len(rest)
+			}
+			chunk := rest[:n]
+			var m int
+			var err error
+			switch op % 5 {
+			case 0:
+				m, err = b.Write(chunk)
+			case 1:
+				m, err = b.WriteString(string(chunk))
+			case 2:
+				m, err = b.Printf("%s", chunk)
+			case 3:
+				var copied int64
+				copied, err = b.ReadRangeFrom(bytes.NewReader(data), int64(len(data)-len(rest)), int64(n))
+				m = int(copied)
+			case 4:
+				var copied int64
+				copied, err = b.ReadFrom(bytes.NewReader(chunk))
+				m = int(copied)
+			}
+			if err != nil || m != n {
+				t.Fatalf("write op %d: got (%d, %v), want (%d, nil)", op%5, m, err, n)
+			}
+			rest = rest[n:]
+		}
+		if size, err := b.Finalize(); err != nil || size != int64(len(data)) {
+			t.Fatalf("Finalize: got (%d, %v), want (%d, nil)", size, err, len(data))
+		}
+
+		// Read it back, ending with WriteTo.
+		var got bytes.Buffer
+		for i := 0; got.Len() < len(data) && i < len(ops); i++ {
+			op := ops[i]
+			var err error
+			switch op % 4 {
+			case 0:
+				p := make([]byte, int(op>>2)+1)
+				var n int
+				n, err = b.Read(p)
+				got.Write(p[:n])
+			case 1:
+				var c byte
+				if c, err = b.ReadByte(); err == nil {
+					got.WriteByte(c)
+				}
+			case 2:
+				var line []byte
+				line, err = b.ReadBytes(op >> 2)
+				got.Write(line)
+			case 3:
+				p := make([]byte, int(op>>2)+1)
+				var n int
+				n, err = b.ReadFull(p)
+				got.Write(p[:n])
+				if err == io.ErrUnexpectedEOF {
+					err = io.EOF
+				}
+			}
+			if err != nil && err != io.EOF {
+				t.Fatalf("read op %d: %v", op%4, err)
+			}
+		}
+		if _, err := b.WriteTo(&got); err != nil {
+			t.Fatalf("WriteTo: %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), data) {
+			t.Fatalf("read %d bytes, different from the %d written", got.Len(), len(data))
+		}
+		if b.Remaining() != 0 {
+			t.Errorf("Remaining %d after reading everything", b.Remaining())
+		}
+	})
+}
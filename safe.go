@@ -0,0 +1,88 @@
+package ramdiskbuffer
+
+import (
+	"sync"
+)
+
+// SafeBuffer is a Buffer whose methods can be called from multiple
+// goroutines at once, e.g. to fan in the results of many workers: each
+// call holds a lock for its whole duration, so the writes are never
+// interleaved, and a Read returns bytes of whole writes.
+//
+// The calls still follow the write and read phases of the Buffer: a Write
+// after PrepareForReading ends the read mode, so that a Read racing with it
+// may return ErrNotPrepared. For sequences of calls that must not be
+// interleaved with the calls of other goroutines, use Do.
+type SafeBuffer struct {
+	mu sync.Mutex
+	b  *Buffer
+}
+
+var _ CommonInterface = (*SafeBuffer)(nil)
+
+// NewSafe returns a new SafeBuffer, disk-backed if toDisk is true,
+// RAM-backed otherwise (see New).
+func NewSafe(toDisk bool, opts ...Option) *SafeBuffer {
+	return &SafeBuffer{b: New(toDisk, opts...)}
+}
+
+// Do calls f with the buffer, holding the lock for the whole call: f must
+// not call the methods of s, nor keep b after returning. It returns
+// the error returned by f.
+func (s *SafeBuffer) Do(f func(b *Buffer) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return f(s.b)
+}
+
+func (s *SafeBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *SafeBuffer) WriteString(str string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.WriteString(str)
+}
+
+func (s *SafeBuffer) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Read(p)
+}
+
+func (s *SafeBuffer) PrepareForReading() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.PrepareForReading()
+}
+
+func (s *SafeBuffer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Close()
+}
+
+func (s *SafeBuffer) Remove() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Remove()
+}
+
+// Deprecated: use Size, which doesn't overflow on 32-bit platforms.
+func (s *SafeBuffer) Len() int {
+	return int(s.Size())
+}
+
+// Deprecated: use Size.
+func (s *SafeBuffer) LenInt64() int64 {
+	return s.Size()
+}
+
+func (s *SafeBuffer) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Size()
+}
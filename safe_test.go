@@ -0,0 +1,50 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+func TestSafeBufferConcurrentWrites(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		s := NewSafe(toDisk)
+		// Run with -race.
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				record := bytes.Repeat([]byte{'a' + byte(w)}, 100)
+				for i := 0; i < 100; i++ {
+					s.Write(record)
+					s.Size()
+				}
+			}(w)
+		}
+		wg.Wait()
+		if s.Size() != 8*100*100 {
+			t.Errorf("toDisk %v: Size %d, want %d", toDisk, s.Size(), 8*100*100)
+		}
+
+		s.PrepareForReading()
+		got, err := ioutil.ReadAll(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The writes were not interleaved.
+		for i := 0; i < len(got); i += 100 {
+			if !bytes.Equal(got[i:i+100], bytes.Repeat(got[i:i+1], 100)) {
+				t.Fatalf("toDisk %v: interleaved writes at offset %d", toDisk, i)
+			}
+		}
+		s.Do(func(b *Buffer) error {
+			if !b.InReadMode() {
+				t.Errorf("toDisk %v: not in read mode", toDisk)
+			}
+			return nil
+		})
+		s.Remove()
+	}
+}
@@ -0,0 +1,58 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// selfTestPayload is what SelfTest writes and reads back.
+var selfTestPayload = []byte("ramdiskbuffer self-test\n")
+
+// SelfTest checks that disk-backed buffers can work in the directory dir
+// (the default temp directory if empty): it creates a temp file in it,
+// writes a small payload, fsyncs it, reads it back, and removes the file.
+// The returned error says which step failed (e.g. because of permissions,
+// a full disk, or a read-only mount). The temp file is removed in any case.
+//
+// It's meant to be called at startup, to fail fast instead of
+// discovering disk problems under load.
+func SelfTest(dir string) (err error) {
+	file, err := ioutil.TempFile(dir, "ramdiskbuffer-selftest")
+	if err != nil {
+		return selfTestError(dir, "creating a temp file", err)
+	}
+	defer func() {
+		file.Close()
+		if rerr := os.Remove(file.Name()); rerr != nil && err == nil {
+			err = selfTestError(dir, "removing the temp file", rerr)
+		}
+	}()
+
+	if _, err := file.Write(selfTestPayload); err != nil {
+		return selfTestError(dir, "writing", err)
+	}
+	if err := file.Sync(); err != nil {
+		return selfTestError(dir, "fsyncing", err)
+	}
+	got := make([]byte, len(selfTestPayload))
+	if _, err := file.ReadAt(got, 0); err != nil && err != io.EOF {
+		return selfTestError(dir, "reading back", err)
+	}
+	if !bytes.Equal(got, selfTestPayload) {
+		return selfTestError(dir, "reading back", fmt.Errorf("got %q, want %q", got, selfTestPayload))
+	}
+	if err := file.Close(); err != nil {
+		return selfTestError(dir, "closing", err)
+	}
+	return nil
+}
+
+func selfTestError(dir, step string, err error) error {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return fmt.Errorf("ramdiskbuffer: self-test in %s failed %s: %w", dir, step, err)
+}
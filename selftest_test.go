@@ -0,0 +1,49 @@
+package ramdiskbuffer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	dir := t.TempDir()
+	if err := SelfTest(dir); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("got %d files left in the directory, want none", len(entries))
+	}
+	if err := SelfTest(""); err != nil {
+		t.Errorf("default temp directory: %v", err)
+	}
+}
+
+func TestSelfTestFailing(t *testing.T) {
+	dir := t.TempDir()
+	notDir := filepath.Join(dir, "file")
+	if err := os.WriteFile(notDir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		dir string
+		err error
+	}{
+		{filepath.Join(dir, "missing"), os.ErrNotExist},
+		{notDir, nil},
+	} {
+		err := SelfTest(tc.dir)
+		if err == nil {
+			t.Errorf("%s: got no error", tc.dir)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.dir) || !strings.Contains(err.Error(), "creating a temp file") {
+			t.Errorf("%s: got %q, want the directory and the step", tc.dir, err)
+		}
+		if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("%s: got %v, want it to wrap %v", tc.dir, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package ramdiskbuffer
+
+import (
+	"hash/fnv"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// shardIndex returns the index of the buffer of an array of n buffers
+// for key: the FNV-1a hash of key, modulo n.
+func shardIndex(key []byte, n int) int {
+	h := fnv.New64a()
+	h.Write(key)
+	return int(h.Sum64() % uint64(n))
+}
+
+// WriterFor returns the buffer of the array for key, chosen by a hash of
+// key, so that all the records of a key go to the same buffer (e.g. to
+// partition output by user ID). The buffers are not safe for concurrent
+// use: to write from several goroutines, see ShardWriters. It panics if the
+// array is empty.
+func (ba BufferArray) WriterFor(key []byte) io.Writer {
+	return ba[shardIndex(key, len(ba))]
+}
+
+// RoundRobinWriter returns a writer that spreads its writes across the
+// buffers of the array, in turn: each Write goes to the next buffer, whole,
+// so that a record written by a single Write is never split between two
+// buffers. Like the buffers, the writer is not safe for concurrent use
+// (see ShardWriters). It panics if the array is empty.
+func (ba BufferArray) RoundRobinWriter() io.Writer {
+	if len(ba) == 0 {
+		panic("ramdiskbuffer: RoundRobinWriter of an empty array")
+	}
+	return &roundRobinWriter{ba: ba}
+}
+
+type roundRobinWriter struct {
+	ba   BufferArray
+	next int
+}
+
+func (w *roundRobinWriter) Write(p []byte) (int, error) {
+	b := w.ba[w.next]
+	w.next = (w.next + 1) % len(w.ba)
+	return b.Write(p)
+}
+
+// ShardWriters routes writes to the buffers of an array like WriterFor and
+// RoundRobinWriter, but its writers are safe for concurrent use: each Write
+// holds a lock on its buffer, so that the records written concurrently to
+// a buffer are appended whole, one after the other, never interleaved.
+// The buffers must only be written through the ShardWriters while it's
+// in use.
+type ShardWriters struct {
+	ba    BufferArray
+	locks []sync.Mutex
+	next  atomic.Uint64
+}
+
+// ShardWriters returns the ShardWriters of the array;
+// it panics if the array is empty.
+func (ba BufferArray) ShardWriters() *ShardWriters {
+	if len(ba) == 0 {
+		panic("ramdiskbuffer: ShardWriters of an empty array")
+	}
+	return &ShardWriters{
+		ba:    ba,
+		locks: make([]sync.Mutex, len(ba)),
+	}
+}
+
+// WriterFor returns the writer to the buffer for key (see
+// BufferArray.WriterFor).
+func (s *ShardWriters) WriterFor(key []byte) io.Writer {
+	return shardWriter{s, shardIndex(key, len(s.ba))}
+}
+
+// RoundRobinWriter returns a writer whose writes go to the buffers in turn
+// (see BufferArray.RoundRobinWriter); the turn is shared by all the writers
+// of s.
+func (s *ShardWriters) RoundRobinWriter() io.Writer {
+	return shardWriter{s, -1}
+}
+
+// shardWriter writes to the buffer i of s, or to the next one in turn
+// if i is negative.
+type shardWriter struct {
+	s *ShardWriters
+	i int
+}
+
+func (w shardWriter) Write(p []byte) (int, error) {
+	i := w.i
+	if i < 0 {
+		i = int((w.s.next.Add(1) - 1) % uint64(len(w.s.ba)))
+	}
+	w.s.locks[i].Lock()
+	defer w.s.locks[i].Unlock()
+	return w.s.ba[i].Write(p)
+}
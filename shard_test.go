@@ -0,0 +1,76 @@
+package ramdiskbuffer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriterFor(t *testing.T) {
+	ba := NewArray(3, false)
+	defer ba.Remove()
+	for i := 0; i < 30; i++ {
+		key := []byte(fmt.Sprint("user", i%5))
+		fmt.Fprintf(ba.WriterFor(key), "%s;", key)
+	}
+	for i, b := range ba {
+		got, _ := b.String()
+		for _, record := range strings.Split(strings.TrimSuffix(got, ";"), ";") {
+			if record != "" && ba.WriterFor([]byte(record)) != b {
+				t.Errorf("buffer %d has a record of another shard: %q", i, record)
+			}
+		}
+	}
+}
+
+func TestRoundRobinWriter(t *testing.T) {
+	ba := NewArray(3, true)
+	defer ba.Remove()
+	w := ba.RoundRobinWriter()
+	for _, record := range []string{"a", "b", "c", "d"} {
+		w.Write([]byte(record))
+	}
+	for i, want := range []string{"ad", "b", "c"} {
+		if got, _ := ba[i].String(); got != want {
+			t.Errorf("buffer %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestShardWriters(t *testing.T) {
+	ba := NewArray(2, false)
+	defer ba.Remove()
+	s := ba.ShardWriters()
+	record := bytes.Repeat([]byte("x"), 99)
+	record = append(record, '\n')
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			w := s.RoundRobinWriter()
+			if g%2 == 0 {
+				w = s.WriterFor([]byte{byte(g)})
+			}
+			for i := 0; i < 100; i++ {
+				w.Write(record)
+			}
+		}(g)
+	}
+	wg.Wait()
+	var total int64
+	for i, b := range ba {
+		got, _ := b.Bytes()
+		for _, line := range bytes.Split(bytes.TrimSuffix(got, []byte("\n")), []byte("\n")) {
+			if len(line) != 99 {
+				t.Fatalf("buffer %d: got a record of %d bytes, want 99", i, len(line))
+			}
+		}
+		total += b.Size()
+	}
+	if total != 8*100*100 {
+		t.Errorf("got %d bytes, want %d", total, 8*100*100)
+	}
+}
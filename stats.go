@@ -0,0 +1,110 @@
+package ramdiskbuffer
+
+import (
+	"time"
+)
+
+// StatsOp is the operation of a StatsEvent.
+type StatsOp int
+
+const (
+	// StatsWrite is a write to the temp file that took longer than the
+	// slow write threshold (see WithSlowWriteThreshold).
+	StatsWrite StatsOp = iota
+	// StatsFsync is an fsync of the temp file.
+	StatsFsync
+	// StatsSpill is the copy of the RAM backing to disk
+	// by SpillToDisk (including when the buffer spills by itself).
+	StatsSpill
+)
+
+func (op StatsOp) String() string {
+	switch op {
+	case StatsWrite:
+		return "write"
+	case StatsFsync:
+		return "fsync"
+	case StatsSpill:
+		return "spill"
+	}
+	return "unknown"
+}
+
+// StatsEvent describes a disk operation of a buffer (see WithStatsHook).
+type StatsEvent struct {
+	Op       StatsOp
+	Duration time.Duration
+	// Bytes is the number of bytes written, for writes; the size of the
+	// buffer, for fsyncs; and the number of bytes copied, for spills.
+	Bytes int64
+	// Err is the error of the operation, if it failed.
+	Err error
+}
+
+// DefaultSlowWriteThreshold is the default duration above which
+// a write is reported to the stats hook (see WithStatsHook).
+const DefaultSlowWriteThreshold = 10 * time.Millisecond
+
+// WithStatsHook makes the buffer call hook, synchronously, after each
+// operation on its temp file that may stall the caller: the copy of the RAM
+// backing to disk when spilling, each fsync, and the writes that take longer
+// than the slow write threshold (see WithSlowWriteThreshold). The hook can
+// be used to build latency histograms of disk interactions. Without hook,
+// the operations are not timed at all.
+func WithStatsHook(hook func(event StatsEvent)) Option {
+	return func(b *Buffer) {
+		b.statsHook = hook
+	}
+}
+
+// WithSlowWriteThreshold sets the duration above which a write is reported
+// to the stats hook (see WithStatsHook); the default is
+// DefaultSlowWriteThreshold.
+func WithSlowWriteThreshold(d time.Duration) Option {
+	return func(b *Buffer) {
+		b.slowWriteThreshold = d
+	}
+}
+
+// emitStats reports an operation that started at start to the stats hook.
+func (b *Buffer) emitStats(op StatsOp, start time.Time, n int64, err error) {
+	event := StatsEvent{
+		Op:       op,
+		Duration: time.Since(start),
+		Bytes:    n,
+		Err:      err,
+	}
+	if op == StatsWrite {
+		threshold := b.slowWriteThreshold
+		if threshold <= 0 {
+			threshold = DefaultSlowWriteThreshold
+		}
+		if event.Duration <= threshold {
+			return
+		}
+	}
+	b.statsHook(event)
+}
+
+// syncFile fsyncs the temp file, reporting it to the stats hook,
+// unless it wasn't modified since it was last fsynced.
+func (b *Buffer) syncFile() error {
+	if err := b.flushWrites(); err != nil {
+		return err
+	}
+	if !b.dirty {
+		return nil
+	}
+	var err error
+	if b.statsHook == nil {
+		err = b.file.Sync()
+	} else {
+		start := time.Now()
+		err = b.file.Sync()
+		b.emitStats(StatsFsync, start, b.length.Load(), err)
+	}
+	if err == nil {
+		b.dirty = false
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+//go:build linux
+// +build linux
+
+package ramdiskbuffer
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// syncFilesystems flushes the filesystems of the OS files among files, with
+// one syncfs per filesystem, and returns the other files, to be fsynced one
+// by one.
+func syncFilesystems(files []File) (rest []File, err error) {
+	synced := make(map[uint64]bool)
+	for _, f := range files {
+		fd, ok := f.(fder)
+		if !ok {
+			rest = append(rest, f)
+			continue
+		}
+		var st unix.Stat_t
+		if err := unix.Fstat(int(fd.Fd()), &st); err != nil {
+			rest = append(rest, f)
+			continue
+		}
+		if synced[uint64(st.Dev)] {
+			continue
+		}
+		if err := unix.Syncfs(int(fd.Fd())); err != nil {
+			return nil, err
+		}
+		synced[uint64(st.Dev)] = true
+	}
+	return rest, nil
+}
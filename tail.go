@@ -0,0 +1,174 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"time"
+)
+
+// DefaultTailPollInterval is the default interval at which the readers
+// returned by TailReader check whether the buffer has grown.
+const DefaultTailPollInterval = 100 * time.Millisecond
+
+// WithTailPollInterval sets the interval at which the readers returned
+// by TailReader check whether the buffer has grown; the default is
+// DefaultTailPollInterval.
+func WithTailPollInterval(d time.Duration) Option {
+	return func(b *Buffer) {
+		b.tailPollInterval = d
+	}
+}
+
+// TailReader returns a reader that follows the contents of a disk-backed
+// buffer as they're written, like tail -f: when it reaches the end of the
+// contents, it waits for more to be written instead of returning io.EOF.
+// It returns io.EOF only once the writer is done with the buffer (i.e. it
+// called CloseWrite, Close or Remove) and all the contents have been read.
+//
+// The reader has its own file descriptor and offset, and it can be used
+// from a goroutine other than the one writing to the buffer; TailReader
+// itself must be called from the writing goroutine.
+// For buffers that are not disk-backed, or that are transformed
+// (see WithWritePipeline), the reader fails with ErrUnsupported.
+func (b *Buffer) TailReader() io.Reader {
+	if b.removed {
+		return errReader{ErrRemoved}
+	}
+	if !b.toDisk || b.sink != nil || b.transformed() {
+		return errReader{ErrUnsupported}
+	}
+	if err := b.ensureFile(); err != nil {
+		return errReader{err}
+	}
+	if err := b.flushWrites(); err != nil {
+		return errReader{err}
+	}
+	file, err := b.fs.Open(b.file.Name())
+	if err != nil {
+		return errReader{err}
+	}
+	interval := b.tailPollInterval
+	if interval <= 0 {
+		interval = DefaultTailPollInterval
+	}
+	return &tailReader{
+		file:     file,
+		done:     b.doneChan(),
+		interval: interval,
+	}
+}
+
+// CloseWrite tells the readers of a buffer that is still being written
+// (see TailReader) that the writer is done, like closing the write half of
+// a pipe: they return io.EOF once they have read all the contents, instead
+// of waiting for more. The buffer stays open for reading; writing to it
+// from then on fails with ErrWriteClosed.
+//
+// CloseWrite first flushes the writes held by the buffer (see
+// WithBlockSize), and closes the write pipeline (see WithWritePipeline), so
+// that the file holds all the contents when the readers are told; it
+// returns the error of doing so, if any, the readers being told anyway.
+func (b *Buffer) CloseWrite() error {
+	if b.removed {
+		return ErrRemoved
+	}
+	var err error
+	if b.transformed() {
+		err = b.closePipeline()
+	} else {
+		err = b.flushWrites()
+	}
+	b.writeClosed = true
+	b.signalDone()
+	return err
+}
+
+// doneChan returns the channel closed when the writer is done with the buffer.
+func (b *Buffer) doneChan() <-chan struct{} {
+	b.doneMu.Lock()
+	defer b.doneMu.Unlock()
+	if b.done == nil {
+		b.done = make(chan struct{})
+		if b.doneClosed {
+			close(b.done)
+		}
+	}
+	return b.done
+}
+
+// signalDone tells the tail readers that the writer is done with the buffer.
+func (b *Buffer) signalDone() {
+	b.doneMu.Lock()
+	defer b.doneMu.Unlock()
+	if b.doneClosed {
+		return
+	}
+	b.doneClosed = true
+	if b.done != nil {
+		close(b.done)
+	}
+}
+
+type tailReader struct {
+	file     File
+	done     <-chan struct{}
+	interval time.Duration
+	// finished is true once done is closed: from then on,
+	// the end of the file is the end of the contents.
+	finished bool
+}
+
+func (r *tailReader) Read(p []byte) (int, error) {
+	if r.file == nil {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var timer *time.Timer
+	for {
+		n, err := r.file.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			r.Close()
+			return 0, err
+		}
+		if r.finished {
+			r.Close()
+			return 0, io.EOF
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(r.interval)
+			defer timer.Stop()
+		} else {
+			timer.Reset(r.interval)
+		}
+		select {
+		case <-r.done:
+			// Read what was written before the writer was done.
+			r.finished = true
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *tailReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// errReader is a reader that always fails with err.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
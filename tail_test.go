@@ -0,0 +1,209 @@
+package ramdiskbuffer
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTailReaderFlushesOnCloseWrite(t *testing.T) {
+	b := New(true, WithBlockSize(4096), WithTailPollInterval(time.Millisecond))
+	defer b.Remove()
+	r := b.TailReader()
+	b.WriteString("hello")
+	if err := b.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("got %q, %v, want %q", got, err, "hello")
+	}
+}
+
+func TestTailReaderFlushesOnClose(t *testing.T) {
+	b := New(true, WithBlockSize(4096), WithTailPollInterval(time.Millisecond))
+	defer b.Remove()
+	r := b.TailReader()
+	b.WriteString("hello")
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("got %q, %v, want %q", got, err, "hello")
+	}
+}
+
+func TestCloseWriteClosesPipeline(t *testing.T) {
+	b := New(true, WithGzip(), WithBlockSize(4096))
+	defer b.Remove()
+	if _, err := io.ReadAll(b.TailReader()); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("TailReader: got %v, want ErrUnsupported", err)
+	}
+	b.WriteString("hello")
+	if err := b.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file holds the whole gzip stream, trailer included.
+	f, err := os.Open(b.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(int64(len(transformedMagic)+1), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("file: got %q, %v, want %q", got, err, "hello")
+	}
+
+	if err := b.PrepareForReading(); err != nil {
+		t.Fatal(err)
+	}
+	got, err = io.ReadAll(b)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("buffer: got %q, %v, want %q", got, err, "hello")
+	}
+}
+
+func TestTailReaderConcurrentWrites(t *testing.T) {
+	b := New(true, WithTailPollInterval(time.Millisecond))
+	defer b.Remove()
+	r := b.TailReader()
+
+	done := make(chan []byte)
+	go func() {
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- got
+	}()
+	var want []byte
+	for i := 0; i < 100; i++ {
+		p := []byte{byte(i), byte(i >> 8), 'x'}
+		if _, err := b.Write(p); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, p...)
+		if i%10 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	b.CloseWrite()
+	if got := <-done; string(got) != string(want) {
+		t.Errorf("got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestTailReaderEOFAfterCloseWrite(t *testing.T) {
+	b := New(true, WithTailPollInterval(time.Hour))
+	defer b.Remove()
+	b.WriteString("abc")
+	r := b.TailReader()
+	b.CloseWrite()
+
+	// Not waiting for the poll interval.
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != "abc" {
+		t.Errorf("got %q, %v, want %q", got, err, "abc")
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("after EOF: got (%d, %v), want (0, EOF)", n, err)
+	}
+	if _, err := b.WriteString("d"); err != ErrWriteClosed {
+		t.Errorf("WriteString after CloseWrite: got %v, want ErrWriteClosed", err)
+	}
+	if _, err := io.ReadAll(b.TailReader()); err != nil {
+		t.Errorf("TailReader after CloseWrite: %v", err)
+	}
+}
+
+func TestTailReaderRemoveWhileTailing(t *testing.T) {
+	b := New(true, WithTailPollInterval(time.Hour))
+	r := b.TailReader()
+	b.WriteString("abc")
+
+	done := make(chan error)
+	go func() {
+		p := make([]byte, 3)
+		if _, err := io.ReadFull(r, p); err != nil || string(p) != "abc" {
+			t.Errorf("got %q, %v, want %q", p, err, "abc")
+		}
+		// Blocks until Remove.
+		_, err := r.Read(p)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := b.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("got %v, want EOF", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the reader is still waiting after Remove")
+	}
+	if _, err := b.TailReader().Read(make([]byte, 1)); err != ErrRemoved {
+		t.Errorf("TailReader after Remove: got %v, want ErrRemoved", err)
+	}
+}
+
+func TestTailPollInterval(t *testing.T) {
+	b := New(true)
+	if r := b.TailReader().(*tailReader); r.interval != DefaultTailPollInterval {
+		t.Errorf("default interval: got %v, want %v", r.interval, DefaultTailPollInterval)
+	}
+	b.Remove()
+
+	// A short interval sees the writes while the writer is still writing.
+	b = New(true, WithTailPollInterval(time.Millisecond))
+	defer b.Remove()
+	r := b.TailReader()
+	got := make(chan string)
+	go func() {
+		p := make([]byte, 3)
+		n, _ := io.ReadFull(r, p)
+		got <- string(p[:n])
+	}()
+	b.WriteString("abc")
+	select {
+	case s := <-got:
+		if s != "abc" {
+			t.Errorf("got %q, want %q", s, "abc")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the write wasn't seen before CloseWrite")
+	}
+
+	// A long one doesn't check again before the writer is done.
+	b2 := New(true, WithTailPollInterval(time.Hour))
+	defer b2.Remove()
+	r2 := b2.TailReader()
+	go func() {
+		p, _ := io.ReadAll(r2)
+		got <- string(p)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b2.WriteString("abc")
+	select {
+	case s := <-got:
+		t.Fatalf("got %q before CloseWrite", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+	b2.CloseWrite()
+	if s := <-got; s != "abc" {
+		t.Errorf("got %q, want %q", s, "abc")
+	}
+}
@@ -0,0 +1,92 @@
+package ramdiskbuffer
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// NewTee returns a RAM-backed buffer whose writes also go to a file that
+// becomes path on Commit, as a durability record of the contents: the reads
+// are served from RAM, like for a mirrored buffer (see NewMirrored), whose
+// mirror is here a temp file in the directory of path (so that Commit can
+// rename it). Commit fsyncs the file and moves it to path; Rollback, or
+// Remove before Commit, deletes it. The other options apply as for New.
+//
+// Each write goes to RAM, then to the file: if writing to the file fails,
+// the write returns the error, and the buffer carries on without the file
+// (see MirrorDegraded), which can't be committed anymore, so that path never
+// holds a partial record. The file is created with the permissions of
+// WithFileMode, or 0600.
+func NewTee(path string, opts ...Option) (*Buffer, error) {
+	b, err := NewBuffer(false, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.acquireFileSlot(); err != nil {
+		b.Remove()
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		b.releaseFileSlot()
+		b.Remove()
+		return nil, err
+	}
+	if err := b.setFileMode(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		b.releaseFileSlot()
+		b.Remove()
+		return nil, err
+	}
+	b.mirror = file
+	b.teePath = path
+	return b, nil
+}
+
+// Commit fsyncs the file of a tee buffer (see NewTee), and renames it to
+// its path, replacing any file there; the buffer stays usable, as a plain
+// RAM-backed buffer. It returns the error that degraded the file, if
+// writing to it failed, and ErrUnsupported for the other buffers (including
+// the tee buffers already committed or rolled back).
+func (b *Buffer) Commit() error {
+	if err := b.checkOpen(); err != nil {
+		return err
+	}
+	if b.teePath == "" || b.mirror == nil {
+		return ErrUnsupported
+	}
+	if b.mirrorErr != nil {
+		return b.mirrorErr
+	}
+	file := b.mirror
+	err := file.Sync()
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), b.teePath)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	} else if b.durableDir {
+		err = syncDir(filepath.Dir(b.teePath))
+	}
+	b.releaseFileSlot()
+	b.mirror = nil
+	b.teePath = ""
+	return err
+}
+
+// Rollback deletes the file of a tee buffer (see NewTee), without touching
+// its path; the buffer stays usable, as a plain RAM-backed buffer. It
+// returns ErrUnsupported for the other buffers, like Commit.
+func (b *Buffer) Rollback() error {
+	if err := b.checkOpen(); err != nil {
+		return err
+	}
+	if b.teePath == "" || b.mirror == nil {
+		return ErrUnsupported
+	}
+	return b.removeMirror()
+}
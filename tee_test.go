@@ -0,0 +1,55 @@
+package ramdiskbuffer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTee(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "record")
+	b, err := NewTee(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.WriteString("durable ")
+	b.Write([]byte("record"))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("got %v before Commit, want no file at path", err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "durable record" {
+		t.Errorf("got %q at path, want %q", got, "durable record")
+	}
+	if got, _ := b.String(); got != "durable record" {
+		t.Errorf("got %q in RAM, want %q", got, "durable record")
+	}
+	if err := b.Commit(); err != ErrUnsupported {
+		t.Errorf("second Commit: got %v, want ErrUnsupported", err)
+	}
+	b.Remove()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("got %v after Remove, want the committed file kept", err)
+	}
+
+	for _, rollback := range []bool{true, false} {
+		path := filepath.Join(dir, "discarded")
+		b, err := NewTee(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.WriteString("discarded")
+		if rollback {
+			if err := b.Rollback(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		b.Remove()
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("rollback %v: got %d files, want only the committed one", rollback, len(entries))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package ramdiskbuffer
+
+import (
+	"sync/atomic"
+)
+
+// diskBytes and ramBytes are the total logical lengths of the live
+// disk-backed and RAM-backed buffers.
+var diskBytes, ramBytes int64
+
+// CurrentDiskBytes returns the number of bytes currently held in temp files
+// by all the live buffers of the package: what was written to them, and not
+// yet removed (by Remove, ResetTo or DropPrefix). For transformed buffers
+// (see WithWritePipeline), it's the number of bytes before the transforms,
+// which may be more than what's on disk.
+func CurrentDiskBytes() int64 {
+	return atomic.LoadInt64(&diskBytes)
+}
+
+// CurrentRAMBytes returns the number of bytes currently held in RAM by all
+// the live RAM-backed buffers of the package, like CurrentDiskBytes. Unlike
+// disk bytes, which are held until Remove, the bytes of a RAM-backed buffer
+// are released by Close too (after which it's not counted anymore).
+// Snapshots (see Snapshot) count the bytes they share with their buffer.
+//
+// Both counters count the buffers until they're removed or closed: the
+// buffers dropped without either stay counted.
+func CurrentRAMBytes() int64 {
+	return atomic.LoadInt64(&ramBytes)
+}
+
+// addLength adds n (which may be negative) to the logical length,
+// and accounts for it in the package-level usage.
+func (b *Buffer) addLength(n int64) {
+	b.length.Add(n)
+	b.accountUsage(n)
+}
+
+// setLength sets the logical length to n, and accounts for the difference
+// in the package-level usage.
+func (b *Buffer) setLength(n int64) {
+	b.accountUsage(n - b.length.Swap(n))
+}
+
+// accountUsage adds n bytes to the usage of the current backing.
+// Sinks don't hold anything, nor closed RAM-backed buffers (see
+// releaseRAMUsage).
+func (b *Buffer) accountUsage(n int64) {
+	switch {
+	case b.sink != nil:
+	case b.file != nil:
+		atomic.AddInt64(&diskBytes, n)
+	case !b.closed:
+		atomic.AddInt64(&ramBytes, n)
+		b.budget.add(n)
+	}
+}
+
+// releaseRAMUsage releases the usage of a RAM-backed buffer being closed:
+// from then on, it's not counted anymore.
+func (b *Buffer) releaseRAMUsage() {
+	if b.sink == nil && b.file == nil {
+		atomic.AddInt64(&ramBytes, -b.length.Load())
+		b.budget.add(-b.length.Load())
+	}
+}
@@ -0,0 +1,37 @@
+package ramdiskbuffer
+
+import (
+	"testing"
+)
+
+func TestUsageCounters(t *testing.T) {
+	disk0, ram0 := CurrentDiskBytes(), CurrentRAMBytes()
+	check := func(step string, disk, ram int64) {
+		t.Helper()
+		if got := CurrentDiskBytes() - disk0; got != disk {
+			t.Errorf("%s: disk bytes %+d, want %+d", step, got, disk)
+		}
+		if got := CurrentRAMBytes() - ram0; got != ram {
+			t.Errorf("%s: RAM bytes %+d, want %+d", step, got, ram)
+		}
+	}
+
+	a, b := New(false), New(true)
+	a.WriteString("hello")
+	b.WriteString("world!")
+	check("write", 6, 5)
+	a.SpillToDisk()
+	check("spill", 11, 0)
+	b.DropPrefix(2)
+	check("drop prefix", 9, 0)
+	a.ResetTo(false)
+	a.WriteString("abc")
+	check("reset to RAM", 4, 3)
+	a.Close()
+	check("close RAM", 4, 0)
+	b.Close()
+	check("close disk", 4, 0)
+	a.Remove()
+	b.Remove()
+	check("remove", 0, 0)
+}
@@ -0,0 +1,243 @@
+package ramdiskbuffer
+
+import (
+	"io"
+	"math"
+)
+
+// ReadAt reads len(p) bytes of the contents starting at offset off, like
+// io.ReaderAt (e.g. for zip.NewReader, or http.ServeContent via
+// io.NewSectionReader), in write mode as well as in read mode, without
+// affecting the read offset. Sink and transformed disk-backed buffers
+// (see WithWritePipeline) don't support it; if off is negative,
+// ErrInvalidSize is returned.
+func (b *Buffer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrInvalidSize
+	}
+	return b.readAt(p, off)
+}
+
+// WriteAt writes p at offset off of the contents, like io.WriterAt,
+// overwriting what's there, like a file: the contents grow if p goes past
+// them, with zeros between the previous end and off if off is past it.
+// The read offset and the write mode of the buffer are not affected, and
+// the writes (see Write) still append at the end of the contents.
+// Sink, transformed (see WithWritePipeline), mirrored (see NewMirrored) and
+// hashed (see WithHash) buffers don't support it; if off is negative,
+// ErrInvalidSize is returned.
+func (b *Buffer) WriteAt(p []byte, off int64) (int, error) {
+	return b.writeAt(p, off)
+}
+
+// writeAt implements WriteAt.
+func (b *Buffer) writeAt(p []byte, off int64) (int, error) {
+	if err := b.checkOpen(); err != nil {
+		return 0, err
+	}
+	if b.writeClosed {
+		return 0, ErrWriteClosed
+	}
+	if b.reading && b.strictLifecycle {
+		return 0, ErrWriteAfterRead
+	}
+	if b.sink != nil || b.transformed() || b.mirror != nil || b.writeHash != nil {
+		return 0, ErrUnsupported
+	}
+	if off < 0 || int64(len(p)) > math.MaxInt64-off {
+		return 0, ErrInvalidSize
+	}
+	end := off + int64(len(p))
+	if b.maxSize > 0 && end > b.maxSize {
+		if off >= b.maxSize {
+			return 0, ErrTooLarge
+		}
+		n, err := b.writeAt(p[:b.maxSize-off], off)
+		if err == nil {
+			err = ErrTooLarge
+		}
+		return n, err
+	}
+	if !b.toDisk && ((b.spills && end > b.spillAbove) || b.overBudget(end-int64(len(b.data)))) {
+		if err := b.SpillToDisk(); err != nil {
+			return 0, err
+		}
+	}
+	if !b.toDisk {
+		return b.writeMemAt(p, off)
+	}
+	if err := b.ensureFile(); err != nil {
+		return 0, err
+	}
+	if err := b.flushWrites(); err != nil {
+		return 0, err
+	}
+	if err := b.unmapFile(); err != nil {
+		return 0, err
+	}
+	b.dirty = true
+	pos := off
+	write := func(p []byte, _ string) (int, error) {
+		n, err := writeFullAt(b.file, p, pos)
+		pos += int64(n)
+		return n, err
+	}
+	var n int
+	var err error
+	if b.limiter != nil {
+		n, err = b.writeLimited(p, "", write)
+	} else {
+		n, err = write(p, "")
+	}
+	if grown := off + int64(n) - b.length.Load(); grown > 0 {
+		b.addLength(grown)
+		if !b.reading {
+			// Writes append at the end of the file.
+			if _, serr := b.file.Seek(0, io.SeekEnd); serr != nil && err == nil {
+				err = serr
+			}
+		}
+	}
+	if b.reading && b.br != nil {
+		// Drop the bytes read ahead, which may be stale.
+		if rerr := b.setReadOffset(b.roff); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	b.countWritten(int64(n))
+	return n, err
+}
+
+// writeFullAt writes all of p to f at offset off, retrying the writes
+// interrupted by a signal (EINTR).
+func writeFullAt(f File, p []byte, off int64) (n int, err error) {
+	for n < len(p) {
+		m, err := f.WriteAt(p[n:], off+int64(n))
+		n += m
+		if isEINTR(err) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// writeMemAt is writeAt for RAM-backed buffers.
+func (b *Buffer) writeMemAt(p []byte, off int64) (int, error) {
+	end := off + int64(len(p))
+	if int64(int(end)) != end {
+		return 0, ErrInvalidSize
+	}
+	if b.shared {
+		// Don't overwrite the bytes seen by the snapshots.
+		b.data = append([]byte(nil), b.data...)
+		b.shared = false
+	}
+	if size := len(b.data); int(end) > size {
+		b.growMem(int(end) - size)
+		b.data = b.data[:end]
+		// The spare capacity may hold old bytes.
+		for i := size; i < int(off); i++ {
+			b.data[i] = 0
+		}
+		b.addLength(end - int64(size))
+	}
+	n := copy(b.data[off:], p)
+	b.countWritten(int64(n))
+	return n, nil
+}
+
+// ReservePlaceholder appends n zero bytes to the buffer, as a placeholder
+// for bytes known only later, e.g. the length of a record written before
+// its body; it returns patch, that overwrites the placeholder with p (of
+// exactly n bytes, otherwise ErrInvalidSize is returned) without affecting
+// the writes appending to the buffer, nor the read offset.
+// A patch after DropPrefix overwrites the bytes now at the offset of
+// the placeholder, and after Remove it returns ErrRemoved.
+//
+// The placeholder needs random access to the backing: sink, transformed
+// (see WithWritePipeline), mirrored (see NewMirrored) and hashed (see
+// WithHash) buffers don't support it (ErrUnsupported).
+func (b *Buffer) ReservePlaceholder(n int) (patch func(p []byte) error, err error) {
+	if n < 0 {
+		return nil, ErrInvalidSize
+	}
+	if b.sink != nil || b.transformed() || b.mirror != nil || b.writeHash != nil {
+		return nil, ErrUnsupported
+	}
+	off := b.Size()
+	if _, err := b.Write(make([]byte, n)); err != nil {
+		return nil, err
+	}
+	return func(p []byte) error {
+		if len(p) != n {
+			return ErrInvalidSize
+		}
+		_, err := b.writeAt(p, off)
+		return err
+	}, nil
+}
+
+// AsReadWriteSeeker returns a view of the buffer as an io.ReadWriteSeeker,
+// e.g. to use it as a BLOB handle for a database driver: the view has its own
+// offset, from 0, that Read, Write and Seek use and move, like the offset of
+// a file (the read offset of the buffer is not affected).
+//
+// Writes overwrite the contents at the offset of the view (they don't
+// insert), and grow them if they go past their end, like for a file: seeking
+// past the end and writing there leaves zeros in between. The writes of the
+// buffer itself still append at the end of the contents.
+//
+// The view works in both write and read mode, for RAM-backed and disk-backed
+// buffers; for sink, transformed (see WithWritePipeline) and mirrored (see
+// NewMirrored) buffers, its writes return ErrUnsupported. Like the buffer,
+// it must not be used concurrently with other methods of the buffer.
+func (b *Buffer) AsReadWriteSeeker() io.ReadWriteSeeker {
+	return &readWriteSeeker{b: b}
+}
+
+type readWriteSeeker struct {
+	b   *Buffer
+	off int64
+}
+
+func (v *readWriteSeeker) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := v.b.readAt(p, v.off)
+	v.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (v *readWriteSeeker) Write(p []byte) (int, error) {
+	n, err := v.b.writeAt(p, v.off)
+	v.off += int64(n)
+	return n, err
+}
+
+// Seek moves the offset of the view, like io.Seeker; it can be past
+// the end of the contents, but not negative (ErrInvalidSize).
+func (v *readWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	var off int64
+	switch whence {
+	case io.SeekStart:
+		off = offset
+	case io.SeekCurrent:
+		off = v.off + offset
+	case io.SeekEnd:
+		off = v.b.Size() + offset
+	default:
+		return 0, ErrInvalidSize
+	}
+	if off < 0 {
+		return 0, ErrInvalidSize
+	}
+	v.off = off
+	return off, nil
+}
@@ -0,0 +1,152 @@
+package ramdiskbuffer
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestAsReadWriteSeeker(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		new  func() *Buffer
+	}{
+		{"ram", func() *Buffer { return New(false) }},
+		{"disk", func() *Buffer { return New(true) }},
+		{"blocks", func() *Buffer { return New(true, WithBlockSize(4)) }},
+		{"spill", func() *Buffer { return NewFromSlice(make([]byte, 0, 8), true) }},
+	} {
+		b := tc.new()
+		b.WriteString("0123456789")
+		v := b.AsReadWriteSeeker()
+
+		// Overwrite in the middle, then read what follows.
+		v.Seek(2, io.SeekStart)
+		v.Write([]byte("ab"))
+		p := make([]byte, 3)
+		if n, err := io.ReadFull(v, p); err != nil || string(p[:n]) != "456" {
+			t.Errorf("%s: read after write: got (%q, %v)", tc.name, p[:n], err)
+		}
+		// Write past the end: zeros in between.
+		if off, _ := v.Seek(2, io.SeekEnd); off != 12 {
+			t.Errorf("%s: Seek(2, io.SeekEnd): got %d, want 12", tc.name, off)
+		}
+		v.Write([]byte("xy"))
+		// The writes of the buffer still append.
+		b.WriteString("!")
+
+		want := "01ab456789\x00\x00xy!"
+		if b.Size() != int64(len(want)) {
+			t.Errorf("%s: Size %d, want %d", tc.name, b.Size(), len(want))
+		}
+		b.PrepareForReading()
+		got, err := ioutil.ReadAll(b)
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got (%q, %v), want %q", tc.name, got, err, want)
+		}
+
+		// In read mode, the read offset of the buffer is not affected.
+		b.PrepareForReading()
+		b.Read(make([]byte, 2))
+		v.Seek(0, io.SeekStart)
+		v.Write([]byte("AB"))
+		got, _ = ioutil.ReadAll(b)
+		if string(got) != want[2:] || b.ReadProgress() != int64(len(want)) {
+			t.Errorf("%s: read mode: got %q, want %q", tc.name, got, want[2:])
+		}
+		if _, err := v.Seek(-1, io.SeekStart); err != ErrInvalidSize {
+			t.Errorf("%s: negative Seek: got %v, want ErrInvalidSize", tc.name, err)
+		}
+		b.Remove()
+	}
+}
+
+func TestAsReadWriteSeekerOfSnapshot(t *testing.T) {
+	b := New(false)
+	defer b.Remove()
+	b.WriteString("abc")
+	s := b.Snapshot()
+	defer s.Remove()
+	b.AsReadWriteSeeker().Write([]byte("x"))
+
+	s.PrepareForReading()
+	if got, _ := ioutil.ReadAll(s); string(got) != "abc" {
+		t.Errorf("snapshot: got %q, want %q", got, "abc")
+	}
+}
+
+func TestReservePlaceholder(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		b.WriteString("header:")
+		patch, err := b.ReservePlaceholder(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.WriteString("body")
+		if err := patch([]byte("0004")); err != nil {
+			t.Fatal(err)
+		}
+		if err := patch([]byte("4")); err != ErrInvalidSize {
+			t.Errorf("toDisk %v: short patch: got %v, want ErrInvalidSize", toDisk, err)
+		}
+		b.WriteString(".")
+		b.PrepareForReading()
+		got, _ := ioutil.ReadAll(b)
+		if want := "header:0004body."; string(got) != want {
+			t.Errorf("toDisk %v: got %q, want %q", toDisk, got, want)
+		}
+		b.Remove()
+		if err := patch([]byte("0005")); err != ErrRemoved {
+			t.Errorf("toDisk %v: patch after Remove: got %v, want ErrRemoved", toDisk, err)
+		}
+	}
+
+	gz := New(true, WithGzip())
+	defer gz.Remove()
+	if _, err := gz.ReservePlaceholder(4); err != ErrUnsupported {
+		t.Errorf("gzip: got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestReadAtWriteAt(t *testing.T) {
+	for _, toDisk := range []bool{false, true} {
+		b := New(toDisk)
+		var _ io.ReaderAt = b
+		var _ io.WriterAt = b
+
+		// Build a zip archive in the buffer, and read it back in place.
+		zw := zip.NewWriter(b)
+		w, _ := zw.Create("hello.txt")
+		w.Write([]byte("hello, world"))
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := zip.NewReader(b, b.Size())
+		if err != nil {
+			t.Fatalf("toDisk %v: %v", toDisk, err)
+		}
+		rc, _ := zr.File[0].Open()
+		got, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if string(got) != "hello, world" {
+			t.Errorf("toDisk %v: got %q from the archive", toDisk, got)
+		}
+
+		if _, err := b.WriteAt([]byte("PK"), 0); err != nil {
+			t.Fatal(err)
+		}
+		p := make([]byte, 4)
+		if n, err := b.ReadAt(p, b.Size()-2); n != 2 || err != io.EOF {
+			t.Errorf("toDisk %v: ReadAt at the end: got (%d, %v), want (2, io.EOF)", toDisk, n, err)
+		}
+		if _, err := b.ReadAt(p, -1); err != ErrInvalidSize {
+			t.Errorf("toDisk %v: negative ReadAt: got %v, want ErrInvalidSize", toDisk, err)
+		}
+		if _, err := b.WriteAt(p, -1); err != ErrInvalidSize {
+			t.Errorf("toDisk %v: negative WriteAt: got %v, want ErrInvalidSize", toDisk, err)
+		}
+		b.Remove()
+	}
+}
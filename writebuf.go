@@ -0,0 +1,100 @@
+package ramdiskbuffer
+
+import (
+	"io"
+)
+
+// WithBlockSize makes a disk-backed buffer write its temp file in chunks
+// aligned on n bytes (e.g. the block size of the storage, or the wsize of
+// a network filesystem), to avoid the read-modify-write cycles of unaligned
+// writes: it enables an internal write buffer, that holds the bytes written
+// until they fill a block, so that all the writes to the file are made of
+// whole blocks, but for the last one (which is not padded). The write
+// buffer is flushed by PrepareForReading, CloseWrite and Close, and by the
+// methods that read the temp file (e.g. Reader); TailReader doesn't see the
+// bytes of a block until it's full, or until CloseWrite. It has no effect on RAM-backed buffers.
+func WithBlockSize(n int) Option {
+	return func(b *Buffer) {
+		if n < 0 {
+			n = 0
+		}
+		b.blockSize = n
+	}
+}
+
+// WithWriteBufferSize makes a disk-backed buffer hold up to n bytes of
+// small writes in memory, and write them to its temp file together, so that
+// workloads issuing many tiny writes don't pay a syscall per write; the
+// bytes are written when the buffer fills, and by Flush. It's the write
+// buffer of WithBlockSize (the writes to the file are aligned on n bytes),
+// of which it's an alias. Use it with WithReadBufferSize for the reads.
+func WithWriteBufferSize(n int) Option {
+	return WithBlockSize(n)
+}
+
+// Flush writes the bytes held by the write buffer (see
+// WithWriteBufferSize) to the temp file, without fsyncing it (see Sync),
+// e.g. before handing the path of the file to another process. It does
+// nothing for the buffers without a write buffer.
+func (b *Buffer) Flush() error {
+	if b.removed {
+		return ErrRemoved
+	}
+	if b.file == nil {
+		return nil
+	}
+	return b.flushWrites()
+}
+
+// writeBlocks appends p, or s if p is nil, to the write buffer, and
+// writes the whole blocks of it to the file. If writing fails, the bytes
+// of p that didn't reach the file are dropped from the write buffer.
+func (b *Buffer) writeBlocks(p []byte, s string) (int, error) {
+	if len(b.wbuf) == 0 {
+		// Writes append at the offset of the file.
+		off, err := b.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		b.wbufOff = off
+	}
+	pending := len(b.wbuf)
+	if p != nil {
+		b.wbuf = append(b.wbuf, p...)
+	} else {
+		b.wbuf = append(b.wbuf, s...)
+	}
+	n := len(b.wbuf) - pending
+
+	end := b.wbufOff + int64(len(b.wbuf))
+	whole := len(b.wbuf) - int(end%int64(b.blockSize))
+	if whole <= 0 {
+		return n, nil
+	}
+	m, err := b.writeFileDirect(b.wbuf[:whole])
+	b.wbufOff += int64(m)
+	if err != nil {
+		keep := pending
+		if m > pending {
+			keep = m
+		}
+		b.wbuf = b.wbuf[:copy(b.wbuf, b.wbuf[m:keep])]
+		if m < pending {
+			return 0, err
+		}
+		return m - pending, err
+	}
+	b.wbuf = b.wbuf[:copy(b.wbuf, b.wbuf[whole:])]
+	return n, nil
+}
+
+// flushWrites writes the write buffer to the file.
+func (b *Buffer) flushWrites() error {
+	if len(b.wbuf) == 0 {
+		return nil
+	}
+	m, err := b.writeFileDirect(b.wbuf)
+	b.wbufOff += int64(m)
+	b.wbuf = b.wbuf[:copy(b.wbuf, b.wbuf[m:])]
+	return err
+}